@@ -0,0 +1,105 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"github.com/evanw/esbuild/pkg/api"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ScriptDirName is the directory under assets holding script entry points,
+// and the output directory of their bundles.
+const ScriptDirName = "js"
+
+// ScriptExts are the entry point extensions esbuild is given.
+var ScriptExts = []string{".js", ".mjs", ".jsx", ".ts", ".tsx"}
+
+// JSBundles maps entry point names to the URLs of their bundles, including
+// a content hash so browsers don't keep stale copies.
+var JSBundles = make(map[string]string)
+
+// BundleScripts bundles every script directly in assets/js, with everything
+// it imports, into js/<name>.js in the output directory. Modules in
+// subdirectories are only included through imports. Bundles are minified,
+// except in development builds which get source maps instead.
+func BundleScripts() error {
+	bundles := make(map[string]string)
+	srcDir := filepath.Join(config.InputPath, AssetDirName, ScriptDirName)
+	files, err := ioutil.ReadDir(srcDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var entries []string
+	for _, fi := range files {
+		if fi.Mode().IsRegular() && config.ContainsFold(ScriptExts, filepath.Ext(fi.Name())) {
+			entries = append(entries, filepath.Join(srcDir, fi.Name()))
+		}
+	}
+	if len(entries) == 0 {
+		JSBundles = bundles
+		return nil
+	}
+
+	opts := api.BuildOptions{
+		EntryPoints:   entries,
+		Bundle:        true,
+		Outdir:        filepath.Join(config.Config.Output, ScriptDirName),
+		Write:         true,
+		LogLevel:      api.LogLevelSilent,
+		AbsWorkingDir: config.InputPath,
+	}
+	if config.Options.Dev {
+		opts.Sourcemap = api.SourceMapLinked
+	} else {
+		opts.MinifyWhitespace = true
+		opts.MinifyIdentifiers = true
+		opts.MinifySyntax = true
+	}
+	result := api.Build(opts)
+	if len(result.Errors) > 0 {
+		var errs output.Errors
+		for _, msg := range result.Errors {
+			errs = append(errs, esbuildError(msg))
+		}
+		return errs
+	}
+	for _, msg := range result.Warnings {
+		output.Report.Warn(esbuildError(msg).Error())
+	}
+
+	for _, out := range result.OutputFiles {
+		if filepath.Ext(out.Path) != ".js" {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(out.Path), ".js")
+		sum := sha256.Sum256(out.Contents)
+		bundles[name] = config.RelURL(path.Join(ScriptDirName, name+".js")) + "?v=" + hex.EncodeToString(sum[:4])
+		config.DebugLogger.Printf("Bundle %s\n", out.Path)
+	}
+	JSBundles = bundles
+	return nil
+}
+
+func esbuildError(msg api.Message) error {
+	if msg.Location == nil {
+		return fmt.Errorf("%s", msg.Text)
+	}
+	return fmt.Errorf("%s:%d:%d: %s", msg.Location.File, msg.Location.Line, msg.Location.Column, msg.Text)
+}
+
+// JSBundle returns the URL of the bundle built from assets/js/<name>.
+func JSBundle(name string) (string, error) {
+	name = strings.TrimSuffix(name, path.Ext(name))
+	u, exist := JSBundles[name]
+	if !exist {
+		return "", fmt.Errorf("no script bundle %q in %s", name, path.Join(AssetDirName, ScriptDirName))
+	}
+	return u, nil
+}
@@ -0,0 +1,111 @@
+package assets
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"github.com/andybalholm/brotli"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCompressExts are the extensions of the files precompressed by
+// default, formats that are text underneath.
+var DefaultCompressExts = []string{".html", ".htm", ".css", ".js", ".mjs", ".json", ".xml", ".svg", ".txt", ".map", ".wasm"}
+
+// DefaultCompressMinSize is the size in bytes below which compressing
+// doesn't pay off.
+const DefaultCompressMinSize = 1024
+
+// CompressOutput writes the precompressed variants of the output files,
+// skipping those already newer than their file.
+func CompressOutput() error {
+	cfg := config.Config.Compress
+	if cfg == nil || (!cfg.Gzip && !cfg.Brotli) {
+		return nil
+	}
+	exts := cfg.Exts
+	if len(exts) == 0 {
+		exts = DefaultCompressExts
+	}
+	minSize := cfg.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressMinSize
+	}
+	type variant struct {
+		ext    string
+		writer func(io.Writer) io.WriteCloser
+	}
+	var variants []variant
+	if cfg.Gzip {
+		variants = append(variants, variant{".gz", func(w io.Writer) io.WriteCloser {
+			zw, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+			return zw
+		}})
+	}
+	if cfg.Brotli {
+		variants = append(variants, variant{".br", func(w io.Writer) io.WriteCloser {
+			return brotli.NewWriterLevel(w, brotli.BestCompression)
+		}})
+	}
+
+	pool := output.NewWorkerPool(config.Config.Concurrency)
+	walkErr := output.Target.Walk(config.Config.Output, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() < minSize || !config.ContainsFold(exts, filepath.Ext(path)) {
+			return nil
+		}
+		for _, v := range variants {
+			dest := path + v.ext
+			if fi, err := output.Target.Stat(dest); err == nil && !fi.ModTime().Before(info.ModTime()) {
+				continue
+			}
+			v := v
+			pool.Submit(func() error {
+				config.DebugLogger.Printf("Compress %s\n", dest)
+				if err := compressFile(path, dest, v.writer); err != nil {
+					return fmt.Errorf("%s: %v", dest, err)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	poolErr := pool.Wait()
+	if walkErr != nil {
+		return walkErr
+	}
+	return poolErr
+}
+
+func compressFile(src, dest string, writer func(io.Writer) io.WriteCloser) error {
+	in, err := output.Target.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := output.Target.Create(dest, 0644)
+	if err != nil {
+		return err
+	}
+	w := writer(out)
+	if _, err := io.Copy(w, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
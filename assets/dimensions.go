@@ -0,0 +1,164 @@
+package assets
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"github.com/rwcarlsen/goexif/exif"
+	"image"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Image sizes are read once per file version
+type imageSizeEntry struct {
+	modTime       time.Time
+	width, height int
+}
+
+var imageSizeMu sync.Mutex
+var imageSizes = make(map[string]imageSizeEntry)
+
+// The images of published static directories are listed once per build,
+// to find the originals of derivatives
+var staticImagesMu sync.Mutex
+var staticImagesCache = make(map[string][]string)
+
+// ResetStaticImages makes the next lookups list the directories again.
+func ResetStaticImages() {
+	staticImagesMu.Lock()
+	staticImagesCache = make(map[string][]string)
+	staticImagesMu.Unlock()
+}
+
+// staticImages lists the names of the images of a directory of the
+// published static files, given relative to the static directory.
+func staticImages(dir string) []string {
+	staticImagesMu.Lock()
+	defer staticImagesMu.Unlock()
+	if names, exist := staticImagesCache[dir]; exist {
+		return names
+	}
+	var names []string
+	if f, err := output.Target.Open(filepath.Join(config.Config.Output, config.StaticDirName, filepath.FromSlash(dir))); err == nil {
+		entries, _ := f.Readdir(-1)
+		f.Close()
+		for _, fi := range entries {
+			if !fi.IsDir() && IsImage(fi.Name()) {
+				names = append(names, fi.Name())
+			}
+		}
+	}
+	staticImagesCache[dir] = names
+	return names
+}
+
+// DerivativeOriginal finds the published original of a derivative, given
+// by its path in the output directory, with the settings it is made with.
+func DerivativeOriginal(rel string) (string, config.Thumbnail, bool) {
+	// A derivative is at dir/name/base under the static directory
+	parts := strings.Split(rel, "/")
+	if len(parts) < 4 || parts[0] != config.StaticDirName {
+		return "", config.Thumbnail{}, false
+	}
+	cfgs, err := ImageDerivatives()
+	if err != nil {
+		return "", config.Thumbnail{}, false
+	}
+	dir := path.Join(parts[1 : len(parts)-2]...)
+	name := parts[len(parts)-2]
+	cfg, exist := cfgs[dir][name]
+	if !exist {
+		return "", config.Thumbnail{}, false
+	}
+	for _, img := range staticImages(dir) {
+		orig := path.Join(config.StaticDirName, dir, img)
+		if DerivativePath(orig, name, cfg) == rel {
+			return orig, cfg, true
+		}
+	}
+	return "", config.Thumbnail{}, false
+}
+
+// OutputImageSize reads the size of an image of the output directory as it
+// displays, rotated by its EXIF orientation.
+func OutputImageSize(rel string) (int, int, error) {
+	name := filepath.Join(config.Config.Output, filepath.FromSlash(rel))
+	f, err := output.Target.Open(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	imageSizeMu.Lock()
+	e, exist := imageSizes[name]
+	imageSizeMu.Unlock()
+	if exist && e.modTime.Equal(info.ModTime()) {
+		return e.width, e.height, nil
+	}
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	e = imageSizeEntry{modTime: info.ModTime(), width: cfg.Width, height: cfg.Height}
+	if _, err := f.Seek(0, io.SeekStart); err == nil {
+		if x, err := exif.Decode(f); err == nil {
+			if tag, err := x.Get(exif.Orientation); err == nil {
+				if o, err := tag.Int(0); err == nil && o >= 5 && o <= 8 {
+					e.width, e.height = e.height, e.width
+				}
+			}
+		}
+	}
+	imageSizeMu.Lock()
+	imageSizes[name] = e
+	imageSizeMu.Unlock()
+	return e.width, e.height, nil
+}
+
+// DerivativeSize works out the size thumbnail gives an image of w by h,
+// rounding the way imaging does. It is 0 by 0 for settings imaging makes
+// an empty image of.
+func DerivativeSize(w, h int, cfg config.Thumbnail) (int, int) {
+	tw, th := cfg.Width, cfg.Height
+	if w <= 0 || h <= 0 || tw < 0 || th < 0 || (tw == 0 && th == 0) {
+		return 0, 0
+	}
+	switch strings.ToLower(cfg.Method) {
+	case "resize":
+		// A missing side keeps the aspect ratio, rounded, at least 1px
+		if tw == 0 {
+			tw = int(math.Max(1, math.Floor(float64(th)*float64(w)/float64(h)+0.5)))
+		}
+		if th == 0 {
+			th = int(math.Max(1, math.Floor(float64(tw)*float64(h)/float64(w)+0.5)))
+		}
+		return tw, th
+	case "fit":
+		if tw == 0 || th == 0 {
+			return 0, 0
+		}
+		if w <= tw && h <= th {
+			return w, h
+		}
+		// Fit truncates the other side, then resizes to exactly that
+		ratio := float64(w) / float64(h)
+		if ratio > float64(tw)/float64(th) {
+			return DerivativeSize(w, h, config.Thumbnail{Method: "resize", Width: tw, Height: int(float64(tw) / ratio)})
+		}
+		return DerivativeSize(w, h, config.Thumbnail{Method: "resize", Width: int(float64(th) * ratio), Height: th})
+	}
+	// fill and thumbnail crop to the exact size
+	if tw == 0 || th == 0 {
+		return 0, 0
+	}
+	return tw, th
+}
@@ -0,0 +1,111 @@
+package assets
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"github.com/disintegration/imaging"
+	"github.com/rwcarlsen/goexif/exif"
+	"image"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// imageMetadata is what templates get from ImageMeta.
+type imageMetadata struct {
+	Width     int
+	Height    int
+	DateTaken time.Time
+	Make      string
+	Model     string
+	HasGPS    bool
+	Latitude  float64
+	Longitude float64
+}
+
+// ImageMeta reads the dimensions and EXIF fields of an image. Paths are
+// resolved against the project directory, so "static/a.jpg" and
+// "/static/a.jpg" are the same file. Missing EXIF fields are left empty, but
+// a missing or unreadable image is an error.
+func ImageMeta(path string) (imageMetadata, error) {
+	var meta imageMetadata
+	path = filepath.Join(config.InputPath, filepath.FromSlash(path))
+
+	f, err := os.Open(path)
+	if err != nil {
+		return meta, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return meta, fmt.Errorf("%s: %v", path, err)
+	}
+	meta.Width, meta.Height = cfg.Width, cfg.Height
+	if _, err := f.Seek(0, 0); err != nil {
+		return meta, err
+	}
+	x, err := exif.Decode(f)
+	if err != nil {
+		// Plenty of images have no EXIF data
+		return meta, nil
+	}
+
+	if t, err := x.DateTime(); err == nil {
+		meta.DateTaken = t
+	}
+	if tag, err := x.Get(exif.Make); err == nil {
+		meta.Make, _ = tag.StringVal()
+	}
+	if tag, err := x.Get(exif.Model); err == nil {
+		meta.Model, _ = tag.StringVal()
+	}
+	if lat, long, err := x.LatLong(); err == nil {
+		meta.HasGPS = true
+		meta.Latitude, meta.Longitude = lat, long
+	}
+	// Rotated images report swapped dimensions
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		if o, err := tag.Int(0); err == nil && o >= 5 && o <= 8 {
+			meta.Width, meta.Height = meta.Height, meta.Width
+		}
+	}
+	return meta, nil
+}
+
+// hasEXIF reports whether the output file at path carries EXIF data.
+func hasEXIF(path string) bool {
+	f, err := output.Target.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = exif.Decode(f)
+	return err == nil
+}
+
+// rewriteOriginal rewrites the published copy of a static image without its
+// metadata, applying the EXIF orientation to the pixels first, and marks it
+// when the watermark is set for originals.
+func rewriteOriginal(src string, cfg config.Thumbnail) error {
+	rel, err := filepath.Rel(filepath.Join(config.InputPath, config.StaticDirName), src)
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(config.Config.Output, config.StaticDirName, filepath.FromSlash(config.OutputName(filepath.ToSlash(rel))))
+	marked := cfg.Watermark.Enabled() && cfg.Watermark.Originals
+	if !marked && !hasEXIF(dest) {
+		return nil
+	}
+	img, err := imaging.Open(src, imaging.AutoOrientation(true))
+	if err != nil {
+		return err
+	}
+	if marked {
+		if img, err = watermark(img, cfg.Watermark); err != nil {
+			return err
+		}
+	}
+	return saveImage(img, dest, cfg)
+}
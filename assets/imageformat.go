@@ -0,0 +1,93 @@
+package assets
+
+import (
+	"github.com/Kagami/go-avif"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+	"image"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// FormatExt returns the file extension for an output format name, or an
+// empty string when the source format should be kept.
+func FormatExt(format string) string {
+	switch strings.ToLower(format) {
+	case "webp":
+		return ".webp"
+	case "avif":
+		return ".avif"
+	case "jpeg", "jpg":
+		return ".jpg"
+	case "png":
+		return ".png"
+	}
+	return ""
+}
+
+// saveImage encodes img in the format implied by the extension of dest,
+// with the quality and compression settings of cfg.
+func saveImage(img image.Image, dest string, cfg config.Thumbnail) error {
+	quality := cfg.Quality
+	switch strings.ToLower(filepath.Ext(dest)) {
+	case ".webp":
+		return encodeFile(dest, func(f io.Writer) error {
+			opts := &webp.Options{Quality: 75}
+			if quality > 0 {
+				opts.Quality = float32(quality)
+			}
+			return webp.Encode(f, img, opts)
+		})
+	case ".avif":
+		return encodeFile(dest, func(f io.Writer) error {
+			opts := &avif.Options{Speed: avif.MaxSpeed, Quality: avif.MaxQuality / 2}
+			if quality > 0 {
+				// AVIF quantizers go the other way: 0 is lossless
+				opts.Quality = (100 - quality) * avif.MaxQuality / 100
+			}
+			return avif.Encode(f, img, opts)
+		})
+	}
+	format, err := imaging.FormatFromFilename(dest)
+	if err != nil {
+		return err
+	}
+	var opts []imaging.EncodeOption
+	switch format {
+	case imaging.JPEG:
+		if quality > 0 {
+			opts = append(opts, imaging.JPEGQuality(quality))
+		}
+	case imaging.PNG:
+		opts = append(opts, imaging.PNGCompressionLevel(PNGCompressionLevels[strings.ToLower(cfg.PNGCompression)]))
+	}
+	return encodeFile(dest, func(f io.Writer) error {
+		return imaging.Encode(f, img, format, opts...)
+	})
+}
+
+// PNGCompressionLevels are the values config.Thumbnail.PNGCompression
+// accepts.
+var PNGCompressionLevels = map[string]png.CompressionLevel{
+	"":        png.DefaultCompression,
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"fast":    png.BestSpeed,
+	"best":    png.BestCompression,
+}
+
+func encodeFile(dest string, encode func(f io.Writer) error) error {
+	f, err := output.Target.Create(dest, 0666)
+	if err != nil {
+		return err
+	}
+	if err := encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,96 @@
+package assets
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var Minifier = newMinifier()
+
+func newMinifier() *minify.M {
+	m := minify.New()
+	m.AddFunc("text/html", html.Minify)
+	m.AddFunc("text/css", css.Minify)
+	m.AddFunc("application/javascript", js.Minify)
+	return m
+}
+
+// minifyEnabled reports whether the master config enables minifying a media
+// type.
+func minifyEnabled(mediatype string) bool {
+	if config.Config.Minify == nil {
+		return false
+	}
+	switch mediatype {
+	case "text/html":
+		return config.Config.Minify.HTML
+	case "text/css":
+		return config.Config.Minify.CSS
+	case "application/javascript":
+		return config.Config.Minify.JS
+	}
+	return false
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// MinifyWriter wraps w with a minifier when it is enabled for mediatype. The
+// returned writer must be closed to flush it.
+func MinifyWriter(mediatype string, w io.Writer) io.WriteCloser {
+	if !minifyEnabled(mediatype) {
+		return nopWriteCloser{w}
+	}
+	return Minifier.Writer(mediatype, w)
+}
+
+// MinifyStatic minifies the stylesheets and scripts synced to the output
+// directory in place. Files already named .min.css or .min.js are skipped.
+func MinifyStatic() error {
+	if !minifyEnabled("text/css") && !minifyEnabled("application/javascript") {
+		return nil
+	}
+	return filepath.Walk(filepath.Join(config.Config.Output, config.StaticDirName), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		var mediatype string
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".css":
+			mediatype = "text/css"
+		case ".js":
+			mediatype = "application/javascript"
+		default:
+			return nil
+		}
+		if !minifyEnabled(mediatype) || strings.HasSuffix(strings.TrimSuffix(path, filepath.Ext(path)), ".min") {
+			return nil
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		minified, err := Minifier.Bytes(mediatype, b)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		config.DebugLogger.Printf("Minify %s\n", path)
+		return output.Target.WriteFile(path, minified, info.Mode())
+	})
+}
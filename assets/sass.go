@@ -0,0 +1,98 @@
+package assets
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const AssetDirName = "assets"
+const DefaultSassCommand = "sass"
+
+// isSassFile reports whether path is a stylesheet for the Sass compiler.
+func isSassFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".scss" || ext == ".sass"
+}
+
+// sassSources maps the stylesheets under root to the CSS files they compile
+// to under dest. Partials, named with a leading underscore, are only imported.
+func sassSources(root, dest string, pairs map[string]string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || !isSassFile(path) || strings.HasPrefix(info.Name(), "_") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		pairs[path] = filepath.Join(dest, strings.TrimSuffix(rel, filepath.Ext(rel))+".css")
+		return nil
+	})
+}
+
+// CompileStylesheets compiles the Sass stylesheets of the static directory
+// next to their synced copies, and those of the assets directory to the
+// matching path in the output root. Development builds get source maps.
+func CompileStylesheets() error {
+	pairs := make(map[string]string)
+	staticDest := filepath.Join(config.Config.Output, config.StaticDirName)
+	if err := sassSources(filepath.Join(config.InputPath, config.StaticDirName), staticDest, pairs); err != nil {
+		return err
+	}
+	if err := sassSources(filepath.Join(config.InputPath, AssetDirName), config.Config.Output, pairs); err != nil {
+		return err
+	}
+
+	// The sources themselves aren't published
+	if err := filepath.Walk(staticDest, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() && isSassFile(path) {
+			return os.Remove(path)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	cfg := config.Sass{}
+	if config.Config.Sass != nil {
+		cfg = *config.Config.Sass
+	}
+	command := cfg.Command
+	if command == "" {
+		command = DefaultSassCommand
+	}
+	var args []string
+	if cfg.Style != "" {
+		args = append(args, "--style="+cfg.Style)
+	}
+	for _, p := range cfg.LoadPaths {
+		args = append(args, "--load-path="+filepath.Join(config.InputPath, p))
+	}
+	if config.Options.Dev {
+		args = append(args, "--embed-sources")
+	} else {
+		args = append(args, "--no-source-map")
+	}
+	for src, dest := range pairs {
+		config.DebugLogger.Printf("Compile %s\n", src)
+		args = append(args, src+":"+dest)
+	}
+	return config.Run(config.InputPath, nil, command, args...)
+}
@@ -0,0 +1,501 @@
+// Package assets processes the static files of a site: image derivatives
+// and watermarks, video posters, stylesheets, script bundles, minifying and
+// compression.
+package assets
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"github.com/disintegration/imaging"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const CacheDirName = ".siteware-cache"
+const ThumbCacheFileName = "thumbnails.json"
+
+// thumbCacheEntry records what a thumbnail was generated from, so it can be
+// skipped when neither the source image nor the settings changed. Entries
+// are keyed by thumbnail, an image having one per derivative.
+type thumbCacheEntry struct {
+	ModTime time.Time
+	Size    int64
+	Config  config.Thumbnail
+	Src     string
+}
+
+type thumbCache struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]thumbCacheEntry
+}
+
+func loadThumbCache() *thumbCache {
+	c := &thumbCache{
+		path:    filepath.Join(config.InputPath, CacheDirName, ThumbCacheFileName),
+		Entries: make(map[string]thumbCacheEntry),
+	}
+	b, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(b, &c.Entries); err != nil {
+		// A broken cache only costs a full regeneration
+		c.Entries = make(map[string]thumbCacheEntry)
+	}
+	return c
+}
+
+// key identifies a thumbnail by its path in the output directory, which
+// stays the same while builds write to a staging directory.
+func (c *thumbCache) key(dest string) string {
+	if rel, err := filepath.Rel(config.Config.Output, dest); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return dest
+}
+
+// fresh reports whether dest is up to date for src.
+func (c *thumbCache) fresh(src string, info os.FileInfo, dest string, cfg config.Thumbnail) bool {
+	c.mu.Lock()
+	e, exist := c.Entries[c.key(dest)]
+	c.mu.Unlock()
+	if !exist || e.Src != src || e.Size != info.Size() || !e.ModTime.Equal(info.ModTime()) || e.Config != cfg {
+		return false
+	}
+	_, err := output.Target.Stat(dest)
+	return err == nil
+}
+
+func (c *thumbCache) put(src string, info os.FileInfo, dest string, cfg config.Thumbnail) {
+	c.mu.Lock()
+	c.Entries[c.key(dest)] = thumbCacheEntry{ModTime: info.ModTime(), Size: info.Size(), Config: cfg, Src: src}
+	c.mu.Unlock()
+}
+
+func (c *thumbCache) save() error {
+	// Thumbnails in memory are gone by the next run
+	if output.InMemory() {
+		return nil
+	}
+	b, err := json.MarshalIndent(c.Entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, b, 0644)
+}
+
+// The image settings are gathered once per build, as template functions
+// look them up for every image
+var derivativesMu sync.Mutex
+var derivativesDone bool
+var derivativesCache map[string]map[string]config.Thumbnail
+var derivativesErr error
+
+// ResetImageDerivatives makes the next lookup read the settings again.
+func ResetImageDerivatives() {
+	derivativesMu.Lock()
+	derivativesDone, derivativesCache, derivativesErr = false, nil, nil
+	derivativesMu.Unlock()
+}
+
+// ImageDerivatives returns the image settings by image directory and
+// derivative name, read by readImageDerivatives the first time in a build.
+// The maps are shared, callers must not modify them.
+func ImageDerivatives() (map[string]map[string]config.Thumbnail, error) {
+	derivativesMu.Lock()
+	defer derivativesMu.Unlock()
+	if !derivativesDone {
+		derivativesCache, derivativesErr = readImageDerivatives()
+		derivativesDone = true
+	}
+	return derivativesCache, derivativesErr
+}
+
+// readImageDerivatives gathers the image settings by image directory and
+// derivative name. The AutoThumbnail and Images settings of the static
+// entries of directory configs under the source directory come first, then
+// the Images of the master config, then the config files of the image
+// directories themselves, which map derivative names to settings.
+func readImageDerivatives() (map[string]map[string]config.Thumbnail, error) {
+	cfgs := make(map[string]map[string]config.Thumbnail)
+	add := func(imgDirPath, name string, cfg config.Thumbnail) {
+		imgDirPath = path.Clean(filepath.ToSlash(imgDirPath))
+		if cfgs[imgDirPath] == nil {
+			cfgs[imgDirPath] = make(map[string]config.Thumbnail)
+		}
+		cfgs[imgDirPath][name] = cfg
+	}
+	err := config.WalkSource(filepath.Join(config.InputPath, config.SourceDirName), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		cfg, err := config.ReadDirConfig(path)
+		if err != nil {
+			return err
+		}
+		for imgDirPath, thumbCfg := range cfg[config.StaticDirName].AutoThumbnail {
+			add(imgDirPath, config.Config.ThumbDirName(), thumbCfg)
+		}
+		for imgDirPath, derivatives := range cfg[config.StaticDirName].Images {
+			for name, thumbCfg := range derivatives {
+				add(imgDirPath, name, thumbCfg)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for imgDirPath, derivatives := range config.Config.Images {
+		for name, thumbCfg := range derivatives {
+			add(imgDirPath, name, thumbCfg)
+		}
+	}
+
+	staticDir := filepath.Join(config.InputPath, config.StaticDirName)
+	err = filepath.Walk(staticDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		cfgPath, err := config.FindConfigFile(path, config.DirConfigBaseName)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		var derivatives map[string]config.Thumbnail
+		if err := config.DecodeConfigFile(cfgPath, &derivatives); err != nil {
+			return fmt.Errorf("%s: %v", cfgPath, err)
+		}
+		imgDirPath, err := filepath.Rel(staticDir, path)
+		if err != nil {
+			return err
+		}
+		for name, thumbCfg := range derivatives {
+			add(imgDirPath, name, thumbCfg)
+		}
+		return nil
+	})
+	return cfgs, err
+}
+
+// DerivativePath maps an image path relative to the project directory,
+// such as "static/gallery/a.jpg", to the published path of its derivative.
+func DerivativePath(rel, name string, cfg config.Thumbnail) string {
+	// An absolute URL, which the URL functions keep as it is
+	rel = filepath.ToSlash(rel)
+	if config.Config.ImageCDN != nil {
+		return cdnURL(rel, cfg)
+	}
+	base := path.Base(rel)
+	if ext := FormatExt(cfg.OutputFormat); ext != "" {
+		base = strings.TrimSuffix(base, path.Ext(base)) + ext
+	}
+	return config.OutputName(path.Join(path.Dir(rel), name, base))
+}
+
+// ImageURL returns the URL of a named derivative of an image of the static
+// directory, e.g. ImageURL "static/gallery/a.jpg" "medium".
+func ImageURL(img, name string) (string, error) {
+	rel := path.Clean(strings.TrimPrefix(filepath.ToSlash(img), "/"))
+	cfgs, err := ImageDerivatives()
+	if err != nil {
+		return "", err
+	}
+	dir := strings.TrimPrefix(path.Dir(rel), config.StaticDirName+"/")
+	cfg, exist := cfgs[dir][name]
+	if !exist {
+		return "", fmt.Errorf("no image derivative %q for %s", name, img)
+	}
+	return config.RelURL(DerivativePath(rel, name, cfg)), nil
+}
+
+// DefaultImageExts are the image extensions processed by default. GIFs
+// only keep their first frame. WebP decodes through the webp package, which
+// registers itself with the image package.
+var DefaultImageExts = []string{".png", ".jpg", ".jpeg", ".gif", ".tif", ".tiff", ".bmp", ".webp"}
+
+// IsImage reports whether path has one of the configured image extensions,
+// in any case.
+func IsImage(path string) bool {
+	exts := config.Config.ImageExts
+	if len(exts) == 0 {
+		exts = DefaultImageExts
+	}
+	return config.ContainsFold(exts, filepath.Ext(path))
+}
+
+// imageJob is an image to process, with the job doing it.
+type imageJob struct {
+	path string
+	run  func() error
+}
+
+// GenerateThumbnails creates thumbnails for every configured image directory,
+// skipping images that haven't changed since the last run.
+func GenerateThumbnails() error {
+	cfgs, err := ImageDerivatives()
+	if err != nil {
+		return err
+	}
+	if len(cfgs) == 0 {
+		return nil
+	}
+	if config.Config.ImageCDN != nil {
+		config.DebugLogger.Println("Images are resized by the image CDN")
+		return nil
+	}
+
+	cache := loadThumbCache()
+	// Pick up a changed watermark when watching
+	watermarkMu.Lock()
+	watermarkImages = make(map[string]image.Image)
+	watermarkMu.Unlock()
+	var jobs []imageJob
+	var walkErr error
+
+	for imgDirPath, derivatives := range cfgs {
+		imgSrcDirPath := filepath.Join(config.InputPath, config.StaticDirName, filepath.FromSlash(imgDirPath))
+		config.InfoLogger.Printf("Generating thumbnails for %s...\n", imgDirPath)
+		names := make([]string, 0, len(derivatives))
+		for name := range derivatives {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if err := config.WalkSource(imgSrcDirPath, func(imgPath string, imgInfo os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if config.IgnoredPath(imgPath, imgInfo) {
+				if imgInfo.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !IsImage(imgPath) {
+				return nil
+			}
+			rel, err := filepath.Rel(config.InputPath, imgPath)
+			if err != nil {
+				return err
+			}
+			// The published original is rewritten once, with the settings
+			// of the first derivative asking for it
+			for _, name := range names {
+				thumbCfg := derivatives[name]
+				if thumbCfg.StripEXIF || thumbCfg.Watermark.Originals {
+					jobs = append(jobs, imageJob{imgPath, func() error {
+						return rewriteOriginal(imgPath, thumbCfg)
+					}})
+					break
+				}
+			}
+			for _, name := range names {
+				thumbCfg := derivatives[name]
+				destImgPath := filepath.Join(config.Config.Output, filepath.FromSlash(DerivativePath(filepath.ToSlash(rel), name, thumbCfg)))
+				if cache.fresh(imgPath, imgInfo, destImgPath, thumbCfg) {
+					config.DebugLogger.Printf("%s is up to date\n", destImgPath)
+					output.Report.AddThumbnail(true)
+					continue
+				}
+				jobs = append(jobs, imageJob{imgPath, func() error {
+					config.DebugLogger.Printf("Create thumbnail %s\n", destImgPath)
+					if err := output.Target.MkdirAll(filepath.Dir(destImgPath), 0755); err != nil {
+						return err
+					}
+					if err := thumbnail(imgPath, destImgPath, thumbCfg); err != nil {
+						return err
+					}
+					cache.put(imgPath, imgInfo, destImgPath, thumbCfg)
+					output.Report.AddThumbnail(false)
+					return nil
+				}})
+			}
+			return nil
+		}); err != nil {
+			walkErr = err
+			break
+		}
+	}
+
+	poolErr := processImages(jobs)
+	// Keep what did succeed for the next run
+	if err := cache.save(); err != nil {
+		config.ErrorLogger.Printf("Error saving thumbnail cache: %v\n", err)
+	}
+	if walkErr != nil {
+		return walkErr
+	}
+	return poolErr
+}
+
+// processImages runs image jobs concurrently, holding back jobs while the
+// images being decoded would take more than the memory budget.
+func processImages(jobs []imageJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	workers := config.Config.ImageConcurrency
+	if workers <= 0 {
+		workers = config.Config.Concurrency
+	}
+	budget := newMemBudget(config.Config.ImageMemory)
+	pool := output.NewWorkerPool(workers)
+	var mu sync.Mutex
+	done, step := 0, len(jobs)/10+1
+	for _, job := range jobs {
+		job := job
+		pool.Submit(func() error {
+			size := decodedSize(job.path)
+			budget.acquire(size)
+			err := job.run()
+			budget.release(size)
+
+			mu.Lock()
+			done++
+			if done%step == 0 || done == len(jobs) {
+				config.InfoLogger.Printf("Processed %d/%d images\n", done, len(jobs))
+			}
+			mu.Unlock()
+			if err != nil {
+				return fmt.Errorf("%s: %v", job.path, err)
+			}
+			return nil
+		})
+	}
+	return pool.Wait()
+}
+
+// decodedSize estimates the memory an image takes once decoded from its
+// header, without decoding the pixels.
+func decodedSize(path string) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0
+	}
+	// Decoding to NRGBA takes 4 bytes a pixel, and orienting can copy it
+	return int64(cfg.Width) * int64(cfg.Height) * 4 * 2
+}
+
+// DefaultImageMemory is the budget in megabytes for decoded images.
+const DefaultImageMemory = 1024
+
+// memBudget is a semaphore weighted by bytes. A request larger than the
+// whole budget waits for everything else to be released and runs alone.
+type memBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	total int64
+	used  int64
+}
+
+func newMemBudget(megabytes int) *memBudget {
+	if megabytes <= 0 {
+		megabytes = DefaultImageMemory
+	}
+	b := &memBudget{total: int64(megabytes) << 20}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *memBudget) acquire(n int64) {
+	if n > b.total {
+		n = b.total
+	}
+	b.mu.Lock()
+	for b.used+n > b.total {
+		b.cond.Wait()
+	}
+	b.used += n
+	b.mu.Unlock()
+}
+
+func (b *memBudget) release(n int64) {
+	if n > b.total {
+		n = b.total
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+func thumbnail(src string, dest string, cfg config.Thumbnail) error {
+	// Photos are often stored sideways with an EXIF orientation tag
+	srcImg, err := imaging.Open(src, imaging.AutoOrientation(true))
+	if err != nil {
+		return err
+	}
+
+	var thumb *image.NRGBA
+	filter := resampleFilter(cfg.Filter)
+
+	switch strings.ToLower(cfg.Method) {
+	case "resize":
+		thumb = imaging.Resize(srcImg, cfg.Width, cfg.Height, filter)
+	case "fit":
+		thumb = imaging.Fit(srcImg, cfg.Width, cfg.Height, filter)
+	case "fill":
+		thumb = imaging.Fill(srcImg, cfg.Width, cfg.Height, imaging.Center, filter)
+	case "thumbnail":
+		fallthrough
+	default:
+		thumb = imaging.Thumbnail(srcImg, cfg.Width, cfg.Height, filter)
+	}
+	if cfg.Sharpen > 0 {
+		thumb = imaging.Sharpen(thumb, cfg.Sharpen)
+	}
+	marked, err := watermark(thumb, cfg.Watermark)
+	if err != nil {
+		return err
+	}
+
+	return saveImage(marked, dest, cfg)
+}
+
+// ResampleFilters are the values config.Thumbnail.Filter accepts.
+var ResampleFilters = map[string]imaging.ResampleFilter{
+	"":                  imaging.Box,
+	"box":               imaging.Box,
+	"nearest":           imaging.NearestNeighbor,
+	"linear":            imaging.Linear,
+	"catmullrom":        imaging.CatmullRom,
+	"mitchellnetravali": imaging.MitchellNetravali,
+	"lanczos":           imaging.Lanczos,
+	"gaussian":          imaging.Gaussian,
+}
+
+func resampleFilter(name string) imaging.ResampleFilter {
+	if f, exist := ResampleFilters[strings.ToLower(name)]; exist {
+		return f
+	}
+	return imaging.Box
+}
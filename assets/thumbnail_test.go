@@ -0,0 +1,32 @@
+package assets
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"runtime"
+	"testing"
+)
+
+func TestDerivativePath(t *testing.T) {
+	// Cases with an OS only run there, as backslashes are plain characters
+	// elsewhere
+	cases := []struct {
+		os                string
+		rel, name, format string
+		want              string
+	}{
+		{rel: "static/gallery/a.jpg", name: "medium", want: "static/gallery/medium/a.jpg"},
+		{rel: "static/gallery/2024/a.jpg", name: ".thumbs", want: "static/gallery/2024/.thumbs/a.jpg"},
+		{rel: "static/gallery/a.jpg", name: "small", format: "webp", want: "static/gallery/small/a.webp"},
+		{os: "windows", rel: `static\gallery\a.jpg`, name: "medium", want: "static/gallery/medium/a.jpg"},
+		{os: "windows", rel: `static\gallery\2024\a.png`, name: "small", format: "webp", want: "static/gallery/2024/small/a.webp"},
+	}
+	for _, c := range cases {
+		if c.os != "" && c.os != runtime.GOOS {
+			continue
+		}
+		// Derivative paths are URL paths, slash separated everywhere
+		if got := DerivativePath(c.rel, c.name, config.Thumbnail{OutputFormat: c.format}); got != c.want {
+			t.Errorf("DerivativePath(%q, %q) = %q, want %q", c.rel, c.name, got, c.want)
+		}
+	}
+}
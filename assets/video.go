@@ -0,0 +1,200 @@
+package assets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const PosterDirName = "posters"
+const DefaultPosterTime = "1"
+
+// DefaultPosterCommand extracts one frame with ffmpeg. The placeholders
+// {src}, {dest} and {time} are replaced in every argument.
+var DefaultPosterCommand = []string{"ffmpeg", "-y", "-loglevel", "error", "-ss", "{time}", "-i", "{src}", "-frames:v", "1", "{dest}"}
+
+// DefaultProbeCommand prints the size and duration of a video as JSON.
+var DefaultProbeCommand = []string{"ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "stream=width,height:format=duration", "-of", "json", "{src}"}
+
+// VideoExts are the extensions of the static files treated as videos.
+var VideoExts = []string{".mp4", ".m4v", ".webm", ".mov", ".ogv"}
+
+// videoMetadata is what templates get from VideoMeta.
+type videoMetadata struct {
+	Width    int
+	Height   int
+	Duration time.Duration
+	// PosterURL links to the poster frame when posters are enabled
+	PosterURL string
+}
+
+func IsVideo(name string) bool {
+	return config.ContainsFold(VideoExts, filepath.Ext(name))
+}
+
+// posterPath maps a video path relative to the project directory to the
+// path of its poster frame.
+func posterPath(rel string) string {
+	base := path.Base(rel)
+	return config.OutputName(path.Join(path.Dir(rel), PosterDirName, strings.TrimSuffix(base, path.Ext(base))+".jpg"))
+}
+
+// PosterURL returns the URL of the poster of a video, or an empty string
+// when posters are disabled.
+func PosterURL(rel string) string {
+	if config.Config.Video == nil || !config.Config.Video.Posters {
+		return ""
+	}
+	return config.RelURL(posterPath(rel))
+}
+
+// ExpandCommand replaces the placeholders of a command.
+func ExpandCommand(command []string, vars map[string]string) []string {
+	args := make([]string, len(command))
+	for i, arg := range command {
+		for k, v := range vars {
+			arg = strings.Replace(arg, "{"+k+"}", v, -1)
+		}
+		args[i] = arg
+	}
+	return args
+}
+
+// GeneratePosters extracts the poster frames of the videos in the static
+// directory, skipping those older than their poster.
+func GeneratePosters() error {
+	if config.Config.Video == nil || !config.Config.Video.Posters {
+		return nil
+	}
+	cfg := *config.Config.Video
+	command := cfg.PosterCommand
+	if len(command) == 0 {
+		command = DefaultPosterCommand
+	}
+	at := cfg.PosterTime
+	if at == "" {
+		at = DefaultPosterTime
+	}
+
+	pool := output.NewWorkerPool(config.Config.Concurrency)
+	walkErr := config.WalkSource(filepath.Join(config.InputPath, config.StaticDirName), func(src string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if config.IgnoredPath(src, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !IsVideo(src) {
+			return nil
+		}
+		rel, err := filepath.Rel(config.InputPath, src)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(config.Config.Output, filepath.FromSlash(posterPath(filepath.ToSlash(rel))))
+		if fi, err := output.Target.Stat(dest); err == nil && fi.ModTime().After(info.ModTime()) {
+			config.DebugLogger.Printf("Poster for %s is up to date\n", src)
+			return nil
+		}
+		pool.Submit(func() error {
+			config.DebugLogger.Printf("Create poster %s\n", dest)
+			if err := output.Target.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return err
+			}
+			return output.WriteExternal(dest, func(out string) error {
+				args := ExpandCommand(command, map[string]string{"src": src, "dest": out, "time": at})
+				if err := config.Run(config.InputPath, nil, args[0], args[1:]...); err != nil {
+					return fmt.Errorf("%s: %v", src, err)
+				}
+				return nil
+			})
+		})
+		return nil
+	})
+	poolErr := pool.Wait()
+	if walkErr != nil {
+		return walkErr
+	}
+	return poolErr
+}
+
+// Probing runs a process, so results are kept until the video changes
+type videoMetaEntry struct {
+	modTime time.Time
+	meta    videoMetadata
+}
+
+var videoMetaMu sync.Mutex
+var videoMetaCache = make(map[string]videoMetaEntry)
+
+// VideoMeta returns the dimensions and duration of a video, given relative
+// to the project directory, e.g. VideoMeta "static/clips/intro.mp4".
+func VideoMeta(p string) (videoMetadata, error) {
+	rel := path.Clean(strings.TrimPrefix(filepath.ToSlash(p), "/"))
+	src := filepath.Join(config.InputPath, filepath.FromSlash(rel))
+	info, err := os.Stat(src)
+	if err != nil {
+		return videoMetadata{}, err
+	}
+	videoMetaMu.Lock()
+	e, exist := videoMetaCache[src]
+	videoMetaMu.Unlock()
+	if exist && e.modTime.Equal(info.ModTime()) {
+		return e.meta, nil
+	}
+
+	command := DefaultProbeCommand
+	if config.Config.Video != nil && len(config.Config.Video.ProbeCommand) > 0 {
+		command = config.Config.Video.ProbeCommand
+	}
+	args := ExpandCommand(command, map[string]string{"src": src})
+	var out bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = config.InputPath
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return videoMetadata{}, fmt.Errorf("%s: %v", strings.Join(args, " "), err)
+	}
+
+	var probe struct {
+		Streams []struct {
+			Width  int
+			Height int
+		}
+		Format struct {
+			Duration string
+		}
+	}
+	if err := json.Unmarshal(out.Bytes(), &probe); err != nil {
+		return videoMetadata{}, fmt.Errorf("%s: %v", src, err)
+	}
+	meta := videoMetadata{PosterURL: PosterURL(rel)}
+	if len(probe.Streams) > 0 {
+		meta.Width, meta.Height = probe.Streams[0].Width, probe.Streams[0].Height
+	}
+	if secs, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		meta.Duration = time.Duration(secs * float64(time.Second))
+	}
+
+	videoMetaMu.Lock()
+	videoMetaCache[src] = videoMetaEntry{info.ModTime(), meta}
+	videoMetaMu.Unlock()
+	return meta, nil
+}
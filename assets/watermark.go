@@ -0,0 +1,118 @@
+package assets
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const DefaultWatermarkOpacity = 0.5
+const DefaultWatermarkMargin = 10
+const DefaultWatermarkTextSize = 24
+
+// WatermarkPositions are the values config.Watermark.Position accepts.
+var WatermarkPositions = map[string]imaging.Anchor{
+	"":            imaging.BottomRight,
+	"center":      imaging.Center,
+	"topleft":     imaging.TopLeft,
+	"top":         imaging.Top,
+	"topright":    imaging.TopRight,
+	"left":        imaging.Left,
+	"right":       imaging.Right,
+	"bottomleft":  imaging.BottomLeft,
+	"bottom":      imaging.Bottom,
+	"bottomright": imaging.BottomRight,
+}
+
+// Watermark images are shared by every image of a build
+var watermarkMu sync.Mutex
+var watermarkImages = make(map[string]image.Image)
+
+// watermark returns img with the watermark of cfg on it.
+func watermark(img image.Image, cfg config.Watermark) (image.Image, error) {
+	if !cfg.Enabled() {
+		return img, nil
+	}
+	mark, err := watermarkImage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opacity := cfg.Opacity
+	if opacity <= 0 {
+		opacity = DefaultWatermarkOpacity
+	}
+	margin := cfg.Margin
+	if margin <= 0 {
+		margin = DefaultWatermarkMargin
+	}
+	pos := anchorPoint(img.Bounds(), mark.Bounds(), WatermarkPositions[strings.ToLower(cfg.Position)], margin)
+	return imaging.Overlay(img, mark, pos, opacity), nil
+}
+
+func watermarkImage(cfg config.Watermark) (image.Image, error) {
+	// Sites of a workspace can have different images of the same name
+	key := filepath.Join(config.InputPath, filepath.FromSlash(cfg.Image))
+	if cfg.Image == "" {
+		key = fmt.Sprintf("text:%d:%s", cfg.TextSize, cfg.Text)
+	}
+	watermarkMu.Lock()
+	defer watermarkMu.Unlock()
+	if mark, exist := watermarkImages[key]; exist {
+		return mark, nil
+	}
+
+	var mark image.Image
+	if cfg.Image != "" {
+		var err error
+		if mark, err = imaging.Open(key); err != nil {
+			return nil, err
+		}
+	} else {
+		mark = textImage(cfg.Text, cfg.TextSize)
+	}
+	watermarkImages[key] = mark
+	return mark, nil
+}
+
+// textImage draws text with the built-in bitmap font and scales it to the
+// given height in pixels.
+func textImage(text string, height int) image.Image {
+	if height <= 0 {
+		height = DefaultWatermarkTextSize
+	}
+	face := basicfont.Face7x13
+	d := &font.Drawer{Src: image.White, Face: face}
+	width := d.MeasureString(text).Ceil()
+	img := image.NewNRGBA(image.Rect(0, 0, width, face.Height))
+	d.Dst = img
+	d.Dot = fixed.P(0, face.Ascent)
+	d.DrawString(text)
+	return imaging.Resize(img, 0, height, imaging.NearestNeighbor)
+}
+
+// anchorPoint places a mark of size m on bounds b at anchor a, margin
+// pixels away from the edges it touches.
+func anchorPoint(b, m image.Rectangle, a imaging.Anchor, margin int) image.Point {
+	x := b.Min.X + (b.Dx()-m.Dx())/2
+	y := b.Min.Y + (b.Dy()-m.Dy())/2
+	switch a {
+	case imaging.TopLeft, imaging.Left, imaging.BottomLeft:
+		x = b.Min.X + margin
+	case imaging.TopRight, imaging.Right, imaging.BottomRight:
+		x = b.Max.X - m.Dx() - margin
+	}
+	switch a {
+	case imaging.TopLeft, imaging.Top, imaging.TopRight:
+		y = b.Min.Y + margin
+	case imaging.BottomLeft, imaging.Bottom, imaging.BottomRight:
+		y = b.Max.Y - m.Dy() - margin
+	}
+	return image.Pt(x, y)
+}
@@ -0,0 +1,294 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severities of accessibility findings, in increasing order
+const (
+	SeverityInfo = iota
+	SeverityWarning
+	SeverityError
+)
+
+// SeverityNames are the values --fail-on accepts, "none" never failing.
+var SeverityNames = []string{"info", "warning", "error", "none"}
+
+// MinContrast is the WCAG AA contrast ratio of normal text.
+const MinContrast = 4.5
+
+type a11yOptions struct {
+	FailOn string
+}
+
+var A11yOptions a11yOptions
+
+// a11yFinding is an accessibility problem of a built page.
+type a11yFinding struct {
+	Page     string
+	Severity int
+	Msg      string
+}
+
+func (f a11yFinding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Page, SeverityNames[f.Severity], f.Msg)
+}
+
+var (
+	imgRe       = regexp.MustCompile(`(?is)<img\b([^>]*)>`)
+	headingRe   = regexp.MustCompile(`(?is)<h([1-6])\b`)
+	labelRe     = regexp.MustCompile(`(?is)<label\b([^>]*)>.*?</label\s*>`)
+	controlRe   = regexp.MustCompile(`(?is)<(input|select|textarea)\b([^>]*)>`)
+	elemIDRe    = regexp.MustCompile(`(?is)<[a-z][^>]*\sid\s*=\s*["']([^"']+)["']`)
+	styledRe    = regexp.MustCompile(`(?is)\sstyle\s*=\s*("[^"]*"|'[^']*')`)
+	colorDeclRe = regexp.MustCompile(`(?i)(?:^|;)\s*(color|background-color|background)\s*:\s*([^;]+)`)
+	hexColorRe  = regexp.MustCompile(`^#([0-9a-f]{3}|[0-9a-f]{6})$`)
+	rgbColorRe  = regexp.MustCompile(`^rgba?\(\s*(\d+)\s*,\s*(\d+)\s*,\s*(\d+)`)
+)
+
+// Colors by name that inline styles commonly use
+var namedColors = map[string][3]int{
+	"black": {0, 0, 0}, "white": {255, 255, 255}, "gray": {128, 128, 128}, "grey": {128, 128, 128},
+	"silver": {192, 192, 192}, "red": {255, 0, 0}, "green": {0, 128, 0}, "blue": {0, 0, 255},
+	"yellow": {255, 255, 0}, "orange": {255, 165, 0},
+}
+
+// Controls that need no label
+var unlabelledInputs = []string{"hidden", "submit", "button", "reset", "image"}
+
+// parseColor reads a CSS color of the forms inline styles tend to use.
+func parseColor(s string) ([3]int, bool) {
+	s = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "!important")))
+	if c, exist := namedColors[s]; exist {
+		return c, true
+	}
+	if m := hexColorRe.FindStringSubmatch(s); m != nil {
+		h := m[1]
+		if len(h) == 3 {
+			h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+		}
+		var c [3]int
+		for i := range c {
+			v, _ := strconv.ParseInt(h[i*2:i*2+2], 16, 0)
+			c[i] = int(v)
+		}
+		return c, true
+	}
+	if m := rgbColorRe.FindStringSubmatch(s); m != nil {
+		var c [3]int
+		for i := range c {
+			c[i], _ = strconv.Atoi(m[i+1])
+		}
+		return c, true
+	}
+	return [3]int{}, false
+}
+
+// luminance is the relative luminance of WCAG.
+func luminance(c [3]int) float64 {
+	var l [3]float64
+	for i, v := range c {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			l[i] = s / 12.92
+		} else {
+			l[i] = math.Pow((s+0.055)/1.055, 2.4)
+		}
+	}
+	return 0.2126*l[0] + 0.7152*l[1] + 0.0722*l[2]
+}
+
+func contrastRatio(a, b [3]int) float64 {
+	la, lb := luminance(a), luminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// checkA11y checks the HTML of the page at rel, a path relative to the
+// output directory.
+func checkA11y(rel, html string) []a11yFinding {
+	var findings []a11yFinding
+	add := func(severity int, format string, args ...interface{}) {
+		findings = append(findings, a11yFinding{Page: rel, Severity: severity, Msg: fmt.Sprintf(format, args...)})
+	}
+	page := &crawledPage{URL: outputURL(rel)}
+
+	for _, m := range imgRe.FindAllStringSubmatch(html, -1) {
+		if _, exist := attrValue(m[1], "alt"); exist {
+			continue
+		}
+		if role, _ := attrValue(m[1], "role"); strings.EqualFold(role, "presentation") {
+			continue
+		}
+		src, _ := attrValue(m[1], "src")
+		// Thumbnails are named after the image they show
+		if _, p, ok := sitePath(page, src); ok {
+			if orig, _, ok := assets.DerivativeOriginal(strings.TrimPrefix(p, "/")); ok {
+				add(SeverityError, "image %s without alt text, a thumbnail of %s", src, orig)
+				continue
+			}
+		}
+		add(SeverityError, "image %s without alt text", src)
+	}
+
+	level, h1s := 0, 0
+	for _, m := range headingRe.FindAllStringSubmatch(html, -1) {
+		n, _ := strconv.Atoi(m[1])
+		if n == 1 {
+			h1s++
+		}
+		if level > 0 && n > level+1 {
+			add(SeverityWarning, "heading h%d follows h%d, skipping a level", n, level)
+		}
+		level = n
+	}
+	if h1s > 1 {
+		add(SeverityInfo, "%d h1 headings", h1s)
+	}
+
+	ids := make(map[string]bool)
+	for _, m := range elemIDRe.FindAllStringSubmatch(html, -1) {
+		ids[m[1]] = true
+	}
+	labelled := make(map[string]bool)
+	labels := labelRe.FindAllStringSubmatchIndex(html, -1)
+	for _, loc := range labels {
+		attrs := html[loc[2]:loc[3]]
+		if id, exist := attrValue(attrs, "for"); exist {
+			labelled[id] = true
+			if !ids[id] {
+				add(SeverityError, "label for %q, which no element has as id", id)
+			}
+		}
+	}
+	for _, loc := range controlRe.FindAllStringSubmatchIndex(html, -1) {
+		tag, attrs := strings.ToLower(html[loc[2]:loc[3]]), html[loc[4]:loc[5]]
+		if typ, _ := attrValue(attrs, "type"); tag == "input" && config.ContainsFold(unlabelledInputs, typ) {
+			continue
+		}
+		if _, exist := attrValue(attrs, "aria-label"); exist {
+			continue
+		}
+		if _, exist := attrValue(attrs, "aria-labelledby"); exist {
+			continue
+		}
+		if id, _ := attrValue(attrs, "id"); id != "" && labelled[id] {
+			continue
+		}
+		wrapped := false
+		for _, l := range labels {
+			if l[0] < loc[0] && loc[1] <= l[1] {
+				wrapped = true
+				break
+			}
+		}
+		if !wrapped {
+			name, _ := attrValue(attrs, "name")
+			add(SeverityError, "%s %q without a label", tag, name)
+		}
+	}
+
+	for _, m := range styledRe.FindAllStringSubmatch(html, -1) {
+		style := strings.Trim(m[1], `"'`)
+		var fg, bg [3]int
+		var hasFg, hasBg bool
+		for _, d := range colorDeclRe.FindAllStringSubmatch(style, -1) {
+			c, ok := parseColor(d[2])
+			if !ok {
+				continue
+			}
+			if strings.EqualFold(d[1], "color") {
+				fg, hasFg = c, true
+			} else {
+				bg, hasBg = c, true
+			}
+		}
+		if hasFg && hasBg {
+			if ratio := contrastRatio(fg, bg); ratio < MinContrast {
+				add(SeverityWarning, "contrast %.1f:1 below %.1f:1 in style %q", ratio, MinContrast, style)
+			}
+		}
+	}
+	return findings
+}
+
+// A11y checks the built pages for common accessibility problems, failing
+// when there is one of at least the --fail-on severity.
+func A11y() error {
+	failOn := -1
+	for i, name := range SeverityNames {
+		if strings.EqualFold(name, A11yOptions.FailOn) {
+			failOn = i
+		}
+	}
+	if failOn < 0 {
+		return fmt.Errorf("Unknown severity %s, use one of %s", A11yOptions.FailOn, strings.Join(SeverityNames, ", "))
+	}
+	if err := config.Load(); err != nil {
+		return err
+	}
+	if config.Config.Output == "" {
+		return errors.New("Output directory unset in configuration")
+	}
+
+	counts := make([]int, SeverityError+1)
+	pages := 0
+	err := filepath.Walk(config.Config.Output, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if config.ContainsFold(output.VCSDirNames, info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !config.IsHTML(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(config.Config.Output, p)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		pages++
+		for _, f := range checkA11y(filepath.ToSlash(rel), string(b)) {
+			counts[f.Severity]++
+			if f.Severity == SeverityError {
+				config.ErrorLogger.Println(f)
+			} else {
+				config.InfoLogger.Println(f)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error reading output directory: %v", err)
+	}
+
+	config.InfoLogger.Printf("Checked %d pages: %d errors, %d warnings, %d notes\n", pages, counts[SeverityError], counts[SeverityWarning], counts[SeverityInfo])
+	failed := 0
+	for severity := failOn; severity < len(counts); severity++ {
+		failed += counts[severity]
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d accessibility problems of severity %s or higher", failed, SeverityNames[failOn])
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"html"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// aliasJob is a page with the old URLs redirecting to it.
+type aliasJob struct {
+	Page    *Page
+	Aliases []string
+}
+
+// aliasRedirects are the aliases of the last build as redirect rules, so
+// the host files include them.
+var aliasRedirects []config.Redirect
+
+// aliasStubs are the stubs the last build wrote by their destination, so
+// rebuilds into the same output replace them but nothing else.
+var aliasStubs = map[string]string{}
+
+const aliasTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%[1]s</title>
+<link rel="canonical" href="%[1]s">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url=%[1]s">
+</head>
+</html>
+`
+
+// aliasOutputPath maps an alias URL path to the stub file it is served
+// from, e.g. "/old/" to "old/index.html".
+func aliasOutputPath(alias string) string {
+	p := path.Clean("/" + alias)
+	if strings.HasSuffix(alias, "/") || path.Ext(p) == "" {
+		p = path.Join(p, "index.html")
+	}
+	return filepath.FromSlash(strings.TrimPrefix(p, "/"))
+}
+
+// generateAliases writes a redirecting stub for every alias and collects
+// them as redirect rules. It runs after everything else GenerateHTML
+// writes, so existing files are the output of this build and aliases must
+// not replace them, except for unchanged stubs of earlier builds into the
+// same output. The host files Build writes later are reserved up front.
+func generateAliases(jobs []aliasJob, pages []*Page) error {
+	aliasRedirects = nil
+	previous := aliasStubs
+	aliasStubs = make(map[string]string)
+	taken := make(map[string]string, len(pages))
+	for _, p := range pages {
+		taken[p.dest] = p.Path
+	}
+	for _, name := range []string{RedirectsFileName, HeadersFileName, VercelFileName, ".nojekyll", "CNAME"} {
+		taken[filepath.Join(config.Config.Output, name)] = "the host files"
+	}
+	for _, job := range jobs {
+		target := job.Page.RelPermalink
+		if job.Page.Permalink != "" {
+			target = job.Page.Permalink
+		}
+		for _, alias := range job.Aliases {
+			dest := filepath.Join(config.Config.Output, aliasOutputPath(alias))
+			if by, exist := taken[dest]; exist {
+				return fmt.Errorf("alias %s of %s would overwrite %s of %s", alias, job.Page.Path, dest, by)
+			}
+			taken[dest] = job.Page.Path
+			if !replaceable(dest, previous[dest]) {
+				return fmt.Errorf("alias %s of %s would overwrite %s", alias, job.Page.Path, dest)
+			}
+			config.DebugLogger.Printf("Create alias %s\n", alias)
+			if err := output.Target.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return err
+			}
+			stub := fmt.Sprintf(aliasTemplate, html.EscapeString(target))
+			if err := output.Target.WriteFile(dest, []byte(stub), 0644); err != nil {
+				return err
+			}
+			aliasStubs[dest] = stub
+			aliasRedirects = append(aliasRedirects, config.Redirect{From: config.RelURL(path.Clean("/" + alias)), To: job.Page.RelPermalink})
+		}
+	}
+	return nil
+}
+
+// replaceable reports whether an alias stub may be written to dest: nothing
+// is there, or the stub an earlier build wrote is.
+func replaceable(dest, stub string) bool {
+	f, err := output.Target.Open(dest)
+	if os.IsNotExist(err) {
+		return true
+	} else if err != nil || stub == "" {
+		return false
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	return err == nil && string(b) == stub
+}
+
+// redirectRules are the configured redirects followed by the aliases.
+func redirectRules() []config.Redirect {
+	return append(append([]config.Redirect(nil), config.Config.Redirects...), aliasRedirects...)
+}
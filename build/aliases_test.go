@@ -0,0 +1,48 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateAliases(t *testing.T) {
+	saved, savedStubs := output.Target, aliasStubs
+	files := output.NewMemFS()
+	output.Target, aliasStubs = files, map[string]string{}
+	defer func() { output.Target, aliasStubs = saved, savedStubs }()
+
+	out := filepath.FromSlash("/out")
+	withConfig(config.Master{Output: out}, func() {
+		page := &Page{Path: "new.md"}
+		page.RelPermalink, page.Permalink = pageURLs("new.html")
+		if err := files.WriteFile(filepath.Join(out, RSSFileName), []byte("<rss/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		jobs := []aliasJob{{Page: page, Aliases: []string{"/old/"}}}
+		if err := generateAliases(jobs, nil); err != nil {
+			t.Fatal(err)
+		}
+		// Rebuilds replace their own stubs
+		if err := generateAliases(jobs, nil); err != nil {
+			t.Errorf("rebuild: %v", err)
+		}
+		// but not other files of the build
+		if err := files.WriteFile(filepath.Join(out, "old", "index.html"), []byte("page"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := generateAliases(jobs, nil); err == nil {
+			t.Error("alias replaced a page written over its stub")
+		}
+		for _, alias := range []string{"/" + RSSFileName, "/" + VercelFileName} {
+			if err := generateAliases([]aliasJob{{Page: page, Aliases: []string{alias}}}, nil); err == nil {
+				t.Errorf("alias %s replaced a file of the build", alias)
+			}
+		}
+		if b, _ := files.ReadFile(filepath.Join(out, RSSFileName)); string(b) != "<rss/>" {
+			t.Errorf("%s = %q after aliasing it", RSSFileName, b)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// archiveJob is a directory whose pages get year and month archive pages.
+type archiveJob struct {
+	// Dir is relative to the source directory, slash separated
+	Dir      string
+	Template string
+}
+
+// archiveYear is a year of the archive tree of a directory, newest month
+// first. Page lists the pages of the year.
+type archiveYear struct {
+	Year   int
+	Page   *Page
+	Months []*archiveMonth
+}
+
+// archiveMonth is a month of an archiveYear.
+type archiveMonth struct {
+	Month time.Month
+	Page  *Page
+}
+
+// archiveTree groups the dated pages of a directory and its subdirectories
+// by year and month, newest first, e.g. /blog/2024/index.html and
+// /blog/2024/05/index.html.
+func archiveTree(ctx *renderContext, job archiveJob) []*archiveYear {
+	var years []*archiveYear
+	// Pages are sorted newest first, so years and months come in order
+	for _, p := range ctx.Index.Pages(job.Dir, true) {
+		if p.Date.IsZero() {
+			continue
+		}
+		y, m := p.Date.Year(), p.Date.Month()
+		if len(years) == 0 || years[len(years)-1].Year != y {
+			dir := path.Join(job.Dir, fmt.Sprint(y))
+			years = append(years, &archiveYear{Year: y, Page: archivePage(ctx, dir, fmt.Sprint(y))})
+		}
+		year := years[len(years)-1]
+		if len(year.Months) == 0 || year.Months[len(year.Months)-1].Month != m {
+			dir := path.Join(job.Dir, fmt.Sprint(y), fmt.Sprintf("%02d", m))
+			year.Months = append(year.Months, &archiveMonth{Month: m, Page: archivePage(ctx, dir, fmt.Sprintf("%s %d", m, y))})
+		}
+		month := year.Months[len(year.Months)-1]
+		year.Page.Pages = append(year.Page.Pages, p)
+		month.Page.Pages = append(month.Page.Pages, p)
+		if year.Page.Date.IsZero() {
+			year.Page.Date = p.Date
+		}
+		if month.Page.Date.IsZero() {
+			month.Page.Date = p.Date
+		}
+	}
+	return years
+}
+
+// archivePage creates the listing page of an archive directory.
+func archivePage(ctx *renderContext, dir, title string) *Page {
+	rel := path.Join(dir, "index.html")
+	p := &Page{
+		Kind:    "archive",
+		Title:   title,
+		Path:    rel,
+		Dir:     dir,
+		Section: ctx.Index.Section(dir),
+		Site:    ctx.Site,
+		dest:    filepath.Join(config.Config.Output, pageOutputPath(rel)),
+	}
+	p.RelPermalink, p.Permalink = pageURLs(pageOutputPath(rel))
+	return p
+}
+
+// archivePages lists the pages of an archive tree, leaving out those of
+// directories with an index page of their own.
+func archivePages(years []*archiveYear) []*Page {
+	var pages []*Page
+	add := func(p *Page) {
+		if p.Section.Index() != nil {
+			config.InfoLogger.Printf("%s has an index page, skipping its archive\n", p.Dir)
+			return
+		}
+		pages = append(pages, p)
+	}
+	for _, y := range years {
+		add(y.Page)
+		for _, m := range y.Months {
+			add(m.Page)
+		}
+	}
+	return pages
+}
+
+// noArchives stands in for the archives template function outside of
+// builds.
+func noArchives(dir string) []*archiveYear {
+	return nil
+}
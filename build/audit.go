@@ -0,0 +1,241 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	scriptRe     = regexp.MustCompile(`(?is)<script\b([^>]*)>(.*?)</script\s*>`)
+	styleRe      = regexp.MustCompile(`(?is)<style\b[^>]*>(.*?)</style\s*>`)
+	styleAttrRe  = regexp.MustCompile(`(?is)<[a-z][^>]*\sstyle\s*=`)
+	handlerRe    = regexp.MustCompile(`(?is)<[a-z][^>]*\son[a-z]+\s*=`)
+	resourceRe   = regexp.MustCompile(`(?is)<(img|iframe|video|audio|source|link|a|form)\b([^>]*)>`)
+	scriptTypeRe = regexp.MustCompile(`(?i)^(|text/javascript|application/javascript|module)$`)
+)
+
+// cspSources collects what each directive of a Content-Security-Policy
+// needs to allow.
+type cspSources map[string]map[string]bool
+
+func (c cspSources) add(directive, source string) {
+	if c[directive] == nil {
+		c[directive] = make(map[string]bool)
+	}
+	c[directive][source] = true
+}
+
+// String orders the directives and their sources.
+func (c cspSources) String() string {
+	directives := []string{"default-src 'self'"}
+	var names []string
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sources := []string{"'self'"}
+		for _, s := range sortedNodes(c[name]) {
+			if s != "'self'" {
+				sources = append(sources, s)
+			}
+		}
+		directives = append(directives, name+" "+strings.Join(sources, " "))
+	}
+	directives = append(directives, "object-src 'none'", "base-uri 'self'")
+	return strings.Join(directives, "; ")
+}
+
+// SecurityHeaders are suggested for every site alongside the policy.
+var SecurityHeaders = [][2]string{
+	{"X-Content-Type-Options", "nosniff"},
+	{"Referrer-Policy", "strict-origin-when-cross-origin"},
+	{"X-Frame-Options", "SAMEORIGIN"},
+	{"Permissions-Policy", "camera=(), microphone=(), geolocation=()"},
+}
+
+// auditFinding is a problem found in a built page.
+type auditFinding struct {
+	Page string
+	Msg  string
+	// Mixed content breaks pages served over HTTPS, the rest are advice
+	Mixed bool
+}
+
+func (f auditFinding) String() string {
+	return fmt.Sprintf("%s: %s", f.Page, f.Msg)
+}
+
+// originOf returns the origin of an absolute URL as CSP writes it, or
+// 'self' for the site's own.
+func originOf(ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return "'self'"
+	}
+	if base, err := url.Parse(config.Config.BaseURL); err == nil && strings.EqualFold(base.Host, u.Host) {
+		return "'self'"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// cspHash is the source allowing an inline script or style.
+func cspHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// auditPage adds what a page needs to csp and returns its findings.
+func auditPage(page, html string, csp cspSources) []auditFinding {
+	var findings []auditFinding
+	insecure := func(ref string) bool {
+		return strings.HasPrefix(strings.ToLower(strings.TrimSpace(ref)), "http://")
+	}
+	mixed := func(kind, ref string) {
+		findings = append(findings, auditFinding{Page: page, Msg: fmt.Sprintf("%s loaded over HTTP: %s", kind, ref), Mixed: true})
+	}
+
+	for _, m := range scriptRe.FindAllStringSubmatch(html, -1) {
+		attrs, body := m[1], m[2]
+		if typ, _ := attrValue(attrs, "type"); !scriptTypeRe.MatchString(strings.TrimSpace(typ)) {
+			// Data blocks such as JSON-LD don't run
+			continue
+		}
+		if src, exist := attrValue(attrs, "src"); exist {
+			csp.add("script-src", originOf(src))
+			if insecure(src) {
+				mixed("script", src)
+			}
+			continue
+		}
+		if strings.TrimSpace(body) != "" {
+			csp.add("script-src", cspHash(body))
+		}
+	}
+	for _, m := range styleRe.FindAllStringSubmatch(html, -1) {
+		if strings.TrimSpace(m[1]) != "" {
+			csp.add("style-src", cspHash(m[1]))
+		}
+	}
+	if styleAttrRe.MatchString(html) {
+		findings = append(findings, auditFinding{Page: page, Msg: "style attributes need 'unsafe-inline' in style-src"})
+		csp.add("style-src", "'unsafe-inline'")
+	}
+	if handlerRe.MatchString(html) {
+		findings = append(findings, auditFinding{Page: page, Msg: "inline event handlers such as onclick need 'unsafe-inline' in script-src, move them to scripts"})
+	}
+
+	for _, m := range resourceRe.FindAllStringSubmatch(html, -1) {
+		tag, attrs := strings.ToLower(m[1]), m[2]
+		switch tag {
+		case "a":
+			href, _ := attrValue(attrs, "href")
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(href)), "javascript:") {
+				findings = append(findings, auditFinding{Page: page, Msg: "javascript: link, which the policy blocks"})
+			} else if insecure(href) {
+				findings = append(findings, auditFinding{Page: page, Msg: "insecure link " + href})
+			}
+		case "form":
+			if action, _ := attrValue(attrs, "action"); insecure(action) {
+				mixed("form target", action)
+			}
+		case "link":
+			rel, _ := attrValue(attrs, "rel")
+			href, _ := attrValue(attrs, "href")
+			if !config.ContainsFold(strings.Fields(rel), "stylesheet") {
+				continue
+			}
+			csp.add("style-src", originOf(href))
+			if insecure(href) {
+				mixed("stylesheet", href)
+			}
+		default:
+			directive := map[string]string{"img": "img-src", "iframe": "frame-src", "video": "media-src", "audio": "media-src", "source": "media-src"}[tag]
+			src, _ := attrValue(attrs, "src")
+			if src == "" || strings.HasPrefix(src, "data:") {
+				if strings.HasPrefix(src, "data:") {
+					csp.add(directive, "data:")
+				}
+				continue
+			}
+			csp.add(directive, originOf(src))
+			if insecure(src) {
+				mixed(tag, src)
+			}
+		}
+	}
+	return findings
+}
+
+// Audit scans the built pages, reporting mixed content and insecure links,
+// and suggests a Content-Security-Policy with other security headers.
+func Audit() error {
+	if err := config.Load(); err != nil {
+		return err
+	}
+	if config.Config.Output == "" {
+		return errors.New("Output directory unset in configuration")
+	}
+	csp := make(cspSources)
+	var findings []auditFinding
+	pages := 0
+	err := filepath.Walk(config.Config.Output, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if config.ContainsFold(output.VCSDirNames, info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !config.IsHTML(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(config.Config.Output, p)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		pages++
+		findings = append(findings, auditPage(filepath.ToSlash(rel), string(b), csp)...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error reading output directory: %v", err)
+	}
+
+	mixed := 0
+	for _, f := range findings {
+		if f.Mixed {
+			mixed++
+			config.ErrorLogger.Println(f)
+		} else {
+			config.InfoLogger.Println(f)
+		}
+	}
+	fmt.Printf("Suggested headers for %d pages:\n\n", pages)
+	fmt.Printf("Content-Security-Policy: %s\n", csp)
+	for _, h := range SecurityHeaders {
+		fmt.Printf("%s: %s\n", h[0], h[1])
+	}
+	fmt.Println("\nSet them for \"/*\" in Headers of the configuration to apply them with the Hosts.")
+	if mixed > 0 {
+		return fmt.Errorf("%d resources loaded over HTTP", mixed)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// autoIndexJob is a directory that gets a generated index page unless it has
+// one of its own.
+type autoIndexJob struct {
+	// Dir is relative to the source directory, slash separated
+	Dir      string
+	Template string
+}
+
+// autoIndexPage creates the index page of a directory without one, listing
+// the pages of the directory. It returns nil if the directory has an index.
+func autoIndexPage(ctx *renderContext, job autoIndexJob) *Page {
+	section := ctx.Index.Section(job.Dir)
+	if section.Index() != nil {
+		return nil
+	}
+	rel := path.Join(job.Dir, "index.html")
+	p := &Page{
+		Kind:    "section",
+		Path:    rel,
+		Dir:     section.Path,
+		Section: section,
+		Pages:   section.Pages(),
+		Site:    ctx.Site,
+		dest:    filepath.Join(config.Config.Output, pageOutputPath(rel)),
+	}
+	if section.Path != "." {
+		p.Title = dirTitle(section.Path)
+	}
+	p.RelPermalink, p.Permalink = pageURLs(pageOutputPath(rel))
+	if len(p.Pages) > 0 {
+		p.Date = p.Pages[0].Date
+	}
+	return p
+}
+
+// dirTitle makes a title of the name of a directory, e.g. "Summer Trip" of
+// "photos/summer-trip".
+func dirTitle(dir string) string {
+	return strings.Title(strings.NewReplacer("-", " ", "_", " ").Replace(path.Base(dir)))
+}
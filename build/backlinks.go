@@ -0,0 +1,143 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// linkRe matches the targets of HTML href attributes and Markdown links.
+var linkRe = regexp.MustCompile(`href\s*=\s*["']([^"']+)["']|\]\(\s*<?([^)\s>]+)`)
+
+// extractLinks collects the site internal links in the source of a page as
+// normalized URL paths. Relative links to Markdown files are resolved to the
+// pages generated from them.
+func extractLinks(p *Page, body []byte) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, m := range linkRe.FindAllSubmatch(body, -1) {
+		target := string(m[1])
+		if target == "" {
+			target = string(m[2])
+		}
+		u, err := url.Parse(target)
+		if err != nil || u.Path == "" {
+			continue
+		}
+		if u.IsAbs() {
+			base, err := url.Parse(config.Config.BaseURL)
+			if err != nil || base.Host == "" || u.Host != base.Host {
+				continue
+			}
+			u.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(u.Path, base.Path), "/")
+		}
+
+		var link string
+		switch {
+		case strings.HasPrefix(u.Path, "/"):
+			link = siteURLPath(u.Path)
+		case strings.EqualFold(path.Ext(u.Path), config.MarkdownExt):
+			link = outputURL(pageOutputPath(path.Join(p.Dir, u.Path)))
+		default:
+			// Relative to the directory the page is served from
+			base := siteURLPath(p.RelPermalink)
+			if !strings.HasSuffix(base, "/") {
+				base = path.Dir(base)
+			}
+			link = path.Join(base, u.Path)
+		}
+		link = NormalizeLink(link)
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// NormalizeLink makes /about/ and /about/index.html the same link.
+func NormalizeLink(link string) string {
+	link = strings.TrimSuffix(link, "index.html")
+	if link != "/" {
+		link = strings.TrimSuffix(link, "/")
+	}
+	return link
+}
+
+// Backlinks returns the pages linking to this one, ordered by title.
+func (p *Page) Backlinks() []*Page {
+	if p.Section == nil {
+		return nil
+	}
+	target := NormalizeLink(siteURLPath(p.RelPermalink))
+	idx := p.Section.index
+	idx.mu.Lock()
+	var pages []*Page
+	for _, other := range idx.pages {
+		if p.is(other) {
+			continue
+		}
+		for _, link := range other.links {
+			if link == target {
+				pages = append(pages, other)
+				break
+			}
+		}
+	}
+	idx.mu.Unlock()
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].Title < pages[j].Title })
+	return pages
+}
+
+// RelatedPages returns the pages sharing taxonomy terms with this one, those
+// sharing the most first and newer ones before older among equals. An
+// optional limit caps the number of pages.
+func (p *Page) RelatedPages(limit ...int) []*Page {
+	if p.Section == nil {
+		return nil
+	}
+	terms := make(map[string]bool)
+	for name, list := range p.Taxonomies {
+		for _, term := range list {
+			terms[name+"/"+slugify(term)] = true
+		}
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	idx := p.Section.index
+	idx.mu.Lock()
+	shared := make(map[*Page]int)
+	var pages []*Page
+	for _, other := range idx.pages {
+		if p.is(other) || other.Kind != "page" {
+			continue
+		}
+		for name, list := range other.Taxonomies {
+			for _, term := range list {
+				if terms[name+"/"+slugify(term)] {
+					shared[other]++
+				}
+			}
+		}
+		if shared[other] > 0 {
+			pages = append(pages, other)
+		}
+	}
+	idx.mu.Unlock()
+
+	sort.SliceStable(pages, func(i, j int) bool {
+		if shared[pages[i]] != shared[pages[j]] {
+			return shared[pages[i]] > shared[pages[j]]
+		}
+		return pages[i].Date.After(pages[j].Date)
+	})
+	if len(limit) > 0 && limit[0] >= 0 && limit[0] < len(pages) {
+		pages = pages[:limit[0]]
+	}
+	return pages
+}
@@ -0,0 +1,155 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const DefaultBenchRuns = 10
+const DefaultBenchTop = 20
+
+// benchOptions are set from the bench command flags.
+type benchOptions struct {
+	Runs int
+	// Top is how many of the slowest pages are listed
+	Top int
+}
+
+var BenchOptions benchOptions
+
+// benchRecorder collects render times while benchmarking. When set,
+// executeTemplate renders to memory instead of the output directory.
+type benchRecorder struct {
+	mu        sync.Mutex
+	templates map[string][]time.Duration
+	pages     map[string][]time.Duration
+}
+
+var Timings *benchRecorder
+
+// render executes a template like executeTemplate, discarding the result.
+func (b *benchRecorder) render(t *template.Template, name, dest string, data interface{}) error {
+	mediatype := "text/plain"
+	if config.IsHTML(dest) {
+		mediatype = "text/html"
+	}
+	start := time.Now()
+	w := assets.MinifyWriter(mediatype, ioutil.Discard)
+	if err := executePage(w, t, name, dest, data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	page := dest
+	if rel, err := filepath.Rel(config.Config.Output, dest); err == nil {
+		page = filepath.ToSlash(rel)
+	}
+	b.mu.Lock()
+	b.templates[name] = append(b.templates[name], elapsed)
+	b.pages[page] = append(b.pages[page], elapsed)
+	b.mu.Unlock()
+	output.Report.AddPage()
+	return nil
+}
+
+// Bench renders the site repeatedly in memory and prints render time
+// percentiles by template and by page.
+func Bench() error {
+	if err := config.Load(); err != nil {
+		return err
+	}
+	runs := BenchOptions.Runs
+	if runs <= 0 {
+		return errors.New("--runs must be at least 1")
+	}
+	defer func() {
+		output.Target = output.OSFS{}
+		Timings = nil
+	}()
+
+	Timings = &benchRecorder{templates: make(map[string][]time.Duration), pages: make(map[string][]time.Duration)}
+	start := time.Now()
+	for i := 0; i < runs; i++ {
+		// Every run starts empty, as aliases refuse to overwrite files
+		output.Target = output.NewMemFS()
+		output.Report = &output.BuildReport{}
+		config.DebugLogger.Printf("Run %d of %d\n", i+1, runs)
+		if err := GenerateHTML(); err != nil {
+			return fmt.Errorf("Error generating HTML:\n%v", err)
+		}
+	}
+	config.InfoLogger.Printf("Rendered %d pages %d times in %.2fs\n", output.Report.Pages, runs, time.Since(start).Seconds())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TEMPLATE\tRENDERS\tP50\tP90\tP99\tMAX\tTOTAL")
+	for _, s := range benchStats(Timings.templates, 0) {
+		fmt.Fprintln(w, s)
+	}
+	fmt.Fprintln(w, "\nPAGE\tRENDERS\tP50\tP90\tP99\tMAX\tTOTAL")
+	for _, s := range benchStats(Timings.pages, BenchOptions.Top) {
+		fmt.Fprintln(w, s)
+	}
+	return w.Flush()
+}
+
+// benchStat sums up the render times of a template or page.
+type benchStat struct {
+	Name               string
+	Renders            int
+	P50, P90, P99, Max time.Duration
+	Total              time.Duration
+}
+
+func (s benchStat) String() string {
+	return fmt.Sprintf("%s\t%d\t%v\t%v\t%v\t%v\t%v", s.Name, s.Renders,
+		s.P50.Round(time.Microsecond), s.P90.Round(time.Microsecond), s.P99.Round(time.Microsecond),
+		s.Max.Round(time.Microsecond), s.Total.Round(time.Microsecond))
+}
+
+// benchStats computes the statistics of every entry, slowest at the 90th
+// percentile first, keeping the first top entries unless top is 0.
+func benchStats(times map[string][]time.Duration, top int) []benchStat {
+	stats := make([]benchStat, 0, len(times))
+	for name, ds := range times {
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		s := benchStat{Name: name, Renders: len(ds), Max: ds[len(ds)-1]}
+		s.P50, s.P90, s.P99 = percentile(ds, 50), percentile(ds, 90), percentile(ds, 99)
+		for _, d := range ds {
+			s.Total += d
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].P90 != stats[j].P90 {
+			return stats[i].P90 > stats[j].P90
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	if top > 0 && len(stats) > top {
+		stats = stats[:top]
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,40 @@
+package build
+
+// breadcrumb is an ancestor of a page. Page is the index page of the
+// directory, nil if it has none, in which case RelPermalink is empty and
+// Title is made of the directory name.
+type breadcrumb struct {
+	Title        string
+	RelPermalink string
+	Page         *Page
+}
+
+// breadcrumbs is the breadcrumbs template function, listing the
+// directories from the root down to the one of the page, e.g.
+//
+//	{{range breadcrumbs .}}<a href="{{.RelPermalink}}">{{.Title}}</a> › {{end}}{{.Title}}
+//
+// The page itself isn't included, nor is the root when it has no index
+// page. An index page's crumbs end with the directory above it.
+func breadcrumbs(p *Page) []breadcrumb {
+	if p == nil {
+		return nil
+	}
+	var crumbs []breadcrumb
+	for s := p.Section; s != nil; s = s.Parent() {
+		index := s.Index()
+		if p.is(index) {
+			continue
+		}
+		c := breadcrumb{Page: index}
+		if index != nil {
+			c.Title, c.RelPermalink = index.Title, index.RelPermalink
+		} else if s.Path != "." {
+			c.Title = dirTitle(s.Path)
+		} else {
+			continue
+		}
+		crumbs = append([]breadcrumb{c}, crumbs...)
+	}
+	return crumbs
+}
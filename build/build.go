@@ -0,0 +1,767 @@
+// Package build generates sites: it renders the pages of the source
+// directory with their templates, publishes the static files and writes
+// feeds, sitemaps and the other files of the output. It also has the
+// commands working on the sources and the output, like check, fetch and
+// deploy.
+package build
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Varjelus/dirsync"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// initOptions are set from the init command flags.
+type initOptions struct {
+	Starter string
+}
+
+var InitOptions initOptions
+
+// Initialize creates a project with the files of a starter kit in the
+// project directory.
+func Initialize() error {
+	config.InfoLogger.Println("Initializing new project...")
+	starter, exist := Starters[InitOptions.Starter]
+	if !exist {
+		return fmt.Errorf("Unknown starter \"%s\"", InitOptions.Starter)
+	}
+	fi, err := os.Stat(config.InputPath)
+	if err != nil {
+		return fmt.Errorf("Error reading parent directory info: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(config.InputPath, config.StaticDirName), fi.Mode()); err != nil {
+		return fmt.Errorf("Error creating static directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(config.InputPath, config.SourceDirName), fi.Mode()); err != nil {
+		return fmt.Errorf("Error creating source directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(config.InputPath, config.TemplateDirName), fi.Mode()); err != nil {
+		return fmt.Errorf("Error creating template directory: %v", err)
+	}
+	if err := writeStarter(starter); err != nil {
+		return fmt.Errorf("Error writing starter files: %v", err)
+	}
+	config.InfoLogger.Println("Done!")
+	return nil
+}
+
+// Options are what a build is of and how it is done.
+type Options struct {
+	// Dir is the project directory, the working directory when empty
+	Dir string
+	// Workspace is the workspace directory when Dir is one of its sites,
+	// which share its templates
+	Workspace string
+	// ConfigFile and OutputDir override the master config file and its
+	// Output directory, like --config and --output
+	ConfigFile string
+	OutputDir  string
+	// Flags are those of the build command
+	Flags config.BuildOptions
+	// Output is where the site is written, the output directory of the
+	// master config when nil. A MemFS keeps the build in memory, leaving
+	// the output directory alone; rebuilding into the same one updates it.
+	Output output.FS
+}
+
+// CommandOptions are the options given on the command line.
+func CommandOptions() Options {
+	return Options{
+		Dir:        config.InputPath,
+		Workspace:  config.WorkspacePath,
+		ConfigFile: config.ConfigPath,
+		OutputDir:  config.OutputPath,
+		Flags:      config.Options,
+	}
+}
+
+// apply makes opts the project and settings the packages work with.
+func (opts Options) apply() {
+	config.InputPath = opts.Dir
+	if config.InputPath == "" {
+		config.InputPath = "."
+	}
+	config.WorkspacePath = opts.Workspace
+	config.ConfigPath, config.OutputPath = opts.ConfigFile, opts.OutputDir
+	config.Options = opts.Flags
+	output.Target = opts.Output
+	if output.Target == nil {
+		output.Target = output.OSFS{}
+	}
+}
+
+// buildMu keeps the builds of a process apart, as they share the state of
+// the packages.
+var buildMu sync.Mutex
+
+// Build generates the whole site of opts and returns the output directory
+// in the FS it was written to. Generating pages and thumbnails doesn't
+// stop at the first failure, the errors of both are returned together.
+// Builds of one process run one at a time, each from its own options, and
+// the incremental rebuilds of the watcher continue from the last one.
+func Build(opts Options) (output.Dir, error) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	opts.apply()
+	if err := buildSite(); err != nil {
+		return output.Dir{}, err
+	}
+	return output.Dir{FS: output.Target, Root: config.Config.Output}, nil
+}
+
+func buildSite() error {
+	start := time.Now()
+	output.Report = &output.BuildReport{}
+
+	// Load config
+	if err := output.Report.Phase("config", config.Load); err != nil {
+		return err
+	}
+
+	if config.Config.Output == "" {
+		return errors.New("Output directory unset in configuration")
+	}
+	if err := output.Report.Phase("validate", validate); err != nil {
+		return fmt.Errorf("Invalid configuration:\n%v", err)
+	}
+	if config.Options.Fetch {
+		if err := output.Report.Phase("fetch", func() error {
+			return fetchSources(nil)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if config.Config.Hooks != nil {
+		if err := output.Report.Phase("pre-build", func() error {
+			return runHooks("pre-build", config.Config.Hooks.PreBuild)
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Build next to the output and swap it in only once everything
+	// succeeded, so a failed build leaves the published site alone. Builds
+	// in memory are only served, so they need no staging.
+	published := config.Config.Output
+	var stage string
+	if !output.InMemory() {
+		var err error
+		if stage, err = output.Stage(published); err != nil {
+			return fmt.Errorf("Error creating staging directory: %v", err)
+		}
+		config.Config.Output = stage
+		defer func() {
+			config.Config.Output = published
+			os.RemoveAll(stage)
+		}()
+	}
+
+	// Sync static files
+	config.InfoLogger.Println("Syncing statics...")
+	if err := output.Report.Phase("static", SyncStatic); err != nil {
+		return fmt.Errorf("Error syncing static files: %v", err)
+	}
+
+	var errs output.Errors
+	// Generate HTML
+	config.InfoLogger.Println("Generating HTML files...")
+	if err := output.Report.Phase("html", GenerateHTML); err != nil {
+		errs = append(errs, fmt.Errorf("Error generating HTML:\n%v", err))
+	}
+
+	// Generate thumbnails
+	if err := output.Report.Phase("thumbnails", assets.GenerateThumbnails); err != nil {
+		errs = append(errs, fmt.Errorf("Error generating thumbnails:\n%v", err))
+	}
+	if err := output.Report.Phase("posters", assets.GeneratePosters); err != nil {
+		errs = append(errs, fmt.Errorf("Error generating video posters:\n%v", err))
+	}
+	if err := generatePagesFiles(); err != nil {
+		errs = append(errs, fmt.Errorf("Error writing GitHub Pages files: %v", err))
+	}
+	if err := generateHostFiles(); err != nil {
+		errs = append(errs, fmt.Errorf("Error writing hosting files: %v", err))
+	}
+	if err := output.Report.Phase("compress", assets.CompressOutput); err != nil {
+		errs = append(errs, fmt.Errorf("Error compressing output: %v", err))
+	}
+
+	if config.Options.Manifest != "" {
+		if err := output.Report.Phase("manifest", func() error {
+			m, err := outputManifest()
+			if err != nil {
+				return err
+			}
+			return m.Write(config.Options.Manifest)
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("Error writing manifest: %v", err))
+		}
+	}
+
+	output.Report.Finish(start)
+	if len(errs) == 0 && stage != "" {
+		if err := output.Swap(stage, published); err != nil {
+			errs = append(errs, fmt.Errorf("Error replacing %s: %v", published, err))
+		}
+	}
+	config.Config.Output = published
+	// Hooks run on the published output, e.g. to commit it
+	if len(errs) == 0 && config.Config.Hooks != nil && !output.InMemory() {
+		if err := output.Report.Phase("post-build", func() error {
+			return runHooks("post-build", config.Config.Hooks.PostBuild)
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// The report is written for failed builds too, CI keeps it either way
+	if config.Options.Report != "" {
+		if err := output.Report.Write(config.Options.Report); err != nil {
+			errs = append(errs, fmt.Errorf("Error writing build report: %v", err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	LastBuild = start
+	return nil
+}
+
+// Clean clears the output directory of the project.
+func Clean() error {
+	if err := config.Load(); err != nil {
+		return err
+	}
+	if config.Config.Output == "" {
+		return errors.New("Output directory unset in configuration")
+	}
+	config.InfoLogger.Println("Clearing output repo...")
+	if err := clearOutput(); err != nil {
+		return err
+	}
+	config.InfoLogger.Println("Done!")
+	return nil
+}
+
+// clearOutput removes everything from the output directory except the
+// entries named in the Preserve list.
+func clearOutput() error {
+	preserve := output.PreservedNames()
+	keep := make(map[string]bool, len(preserve))
+	for _, name := range preserve {
+		keep[name] = true
+	}
+
+	repo, err := os.Open(config.Config.Output)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("Path %s does not exist", config.Config.Output)
+		}
+		return fmt.Errorf("Can't open path %s: %v", config.Config.Output, err)
+	}
+	files, err := repo.Readdir(0)
+	if err != nil {
+		repo.Close()
+		return fmt.Errorf("Can't read path %s: %v", config.Config.Output, err)
+	}
+	if err := repo.Close(); err != nil {
+		return fmt.Errorf("Error closing destination: %v", err)
+	}
+	for _, file := range files {
+		if keep[file.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(config.Config.Output, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncStatic publishes the static directory with its stylesheets and
+// scripts compiled.
+func SyncStatic() error {
+	// Image directories may have new settings
+	assets.ResetImageDerivatives()
+	return output.OnDisk(config.StaticDirName, syncStaticFiles)
+}
+
+func syncStaticFiles() error {
+	if err := output.Report.Phase("sync", func() error {
+		return dirsync.Sync(filepath.Join(config.InputPath, config.StaticDirName), filepath.Join(config.Config.Output, config.StaticDirName))
+	}); err != nil {
+		return err
+	}
+	if err := syncStaticLinks(); err != nil {
+		return err
+	}
+	if err := syncThemeStatic(); err != nil {
+		return fmt.Errorf("Error syncing theme: %v", err)
+	}
+	if err := config.RemoveIgnored(); err != nil {
+		return err
+	}
+	// Image directory configs aren't published
+	if err := filepath.Walk(filepath.Join(config.Config.Output, config.StaticDirName), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() && config.IsConfigFile(info.Name(), config.DirConfigBaseName) {
+			return os.Remove(path)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := output.Report.Phase("stylesheets", assets.CompileStylesheets); err != nil {
+		return err
+	}
+	if err := output.Report.Phase("scripts", assets.BundleScripts); err != nil {
+		return err
+	}
+	if err := normalizeStaticNames(); err != nil {
+		return err
+	}
+	return output.Report.Phase("minify", assets.MinifyStatic)
+}
+
+// GenerateHTML renders the pages of the source directory and writes their
+// feeds, redirects and the sitemap.
+func GenerateHTML() error {
+	configs := make(map[string]config.Dir)
+	var templates *template.Template
+	if err := output.Report.Phase("templates", func() (err error) {
+		templates, err = loadTemplates()
+		return err
+	}); err != nil {
+		return err
+	}
+	// Pages that aren't rendered again keep their dependencies
+	if swappedTemplates != nil && lastGraph != nil {
+		lastGraph.setTemplates(templates)
+	} else {
+		lastGraph = newDepGraph(templates)
+	}
+	resetRemoteData()
+	assets.ResetImageDerivatives()
+	assets.ResetStaticImages()
+	site, err := newSite()
+	if err != nil {
+		return err
+	}
+	shortcodes, err := loadShortcodes()
+	if err != nil {
+		return err
+	}
+	index := &pageIndex{}
+	ctx := &renderContext{Templates: templates, Shortcodes: shortcodes, Index: index, Site: site, Archives: make(map[string][]*archiveYear)}
+	var feeds []feedJob
+	var autoIndexes []autoIndexJob
+	var archives []archiveJob
+	var aliases []aliasJob
+	// Every page is indexed before any is rendered, so pages can list
+	// each other
+	var jobs []func() error
+	var pageErrs output.Errors
+
+	srcRoot := filepath.Join(config.InputPath, config.SourceDirName)
+	walkErr := config.WalkSource(srcRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := sourceRel(srcRoot, path)
+		if err != nil {
+			return err
+		}
+		relPath := filepath.FromSlash(rel)
+		destPath := filepath.Join(config.Config.Output, filepath.FromSlash(config.OutputName(rel)))
+		if config.IgnoredPath(path, info) {
+			config.DebugLogger.Printf("Skipping ignored %s\n", relPath)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Get path of this directory
+		dir := filepath.Dir(path)
+		// See if the config for this dir is already read
+		cfg, exist := configs[dir]
+		// If it is not
+		if !exist {
+			if cfg, err = config.ReadDirConfig(dir); err != nil {
+				return err
+			}
+			configs[dir] = cfg
+		}
+		fcfg, _ := cfg.Lookup(info.Name())
+		config.DebugLogger.Printf("Using configuration %v for %s\n", fcfg.Data, path)
+
+		if info.Mode().IsDir() {
+			config.DebugLogger.Printf("Creating directory %s...\n", relPath)
+			if fcfg.Feed != nil {
+				feeds = append(feeds, feedJob{Dir: path, Dest: destPath, Cfg: *fcfg.Feed})
+			}
+			if fcfg.AutoIndex != "" {
+				autoIndexes = append(autoIndexes, autoIndexJob{Dir: rel, Template: fcfg.AutoIndex})
+			}
+			if fcfg.Archive != "" {
+				archives = append(archives, archiveJob{Dir: rel, Template: fcfg.Archive})
+			}
+			return output.Target.MkdirAll(destPath, info.Mode())
+		} else if config.IsSymlink(info) {
+			// Only seen when links aren't followed
+			if config.SymlinkMode() == config.SymlinksCopy {
+				config.DebugLogger.Printf("Copy symlink %s\n", relPath)
+				return output.CopySymlink(path, destPath)
+			}
+			return nil
+		} else if info.Mode().IsRegular() && config.IsContent(path) {
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			render, split := renderHTMLPage, splitHTMLFrontMatter
+			if config.IsMarkdown(path) {
+				render, split = renderMarkdownPage, splitFrontMatter
+			}
+			// A broken page is reported with the others at the end
+			fm, body, err := split(src)
+			if err != nil {
+				pageErrs = append(pageErrs, fmt.Errorf("%s: %v", path, err))
+				return nil
+			}
+			if fcfg, err = applyFrontMatter(fcfg, fm); err != nil {
+				pageErrs = append(pageErrs, fmt.Errorf("%s: %v", path, err))
+				return nil
+			}
+			if !publishable(fcfg.Draft, fcfg.PublishDate) {
+				config.InfoLogger.Printf("Skipping unpublished %s\n", relPath)
+				return nil
+			}
+			ftmpl := config.DefaultTemplateName
+			if fcfg.Template != "" {
+				ftmpl = fcfg.Template
+			}
+
+			config.DebugLogger.Printf("Create %s\n", relPath)
+			destPath = filepath.Join(config.Config.Output, pageOutputPath(relPath))
+			p := newPage(ctx.Site, path, destPath, mergeData(fcfg.Data, fm), fcfg.PublishDate)
+			p.Section = index.Section(p.Dir)
+			p.Schema = fcfg.Schema
+			p.password = fcfg.Password
+			p.order = fcfg.Order
+			p.links = extractLinks(p, body)
+			p.setContent(body, config.IsMarkdown(path))
+			index.Add(p)
+			if len(fcfg.Aliases) > 0 {
+				aliases = append(aliases, aliasJob{Page: p, Aliases: fcfg.Aliases})
+			}
+			job := func() error {
+				if err := render(ctx, p, ftmpl, fcfg, body); err != nil {
+					return fmt.Errorf("%s: %v", path, err)
+				}
+				return nil
+			}
+			jobs = append(jobs, job)
+		} else if info.Mode().IsRegular() {
+			// Everything else is published as it is, and already was when
+			// only templates changed
+			if swappedTemplates != nil {
+				return nil
+			}
+			if excluded(rel) {
+				config.DebugLogger.Printf("Skipping excluded %s\n", relPath)
+				return nil
+			}
+			mode := info.Mode()
+			jobs = append(jobs, func() error {
+				config.DebugLogger.Printf("Copy %s\n", relPath)
+				if err := output.CopyFile(path, destPath, mode); err != nil {
+					return fmt.Errorf("%s: %v", path, err)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	if walkErr != nil {
+		return walkErr
+	}
+	for _, job := range autoIndexes {
+		job := job
+		p := autoIndexPage(ctx, job)
+		if p == nil {
+			continue
+		}
+		index.Add(p)
+		jobs = append(jobs, func() error {
+			if err := renderListPage(ctx, job.Template, p); err != nil {
+				return fmt.Errorf("index of %s: %v", job.Dir, err)
+			}
+			return nil
+		})
+	}
+	if site.Menus, err = buildMenus(index.All()); err != nil {
+		return err
+	}
+	// The archive trees are complete before any page renders, for
+	// sidebars listing them
+	var archived []*Page
+	for _, job := range archives {
+		job := job
+		years := archiveTree(ctx, job)
+		ctx.Archives[job.Dir] = years
+		if ctx.Templates.Lookup(job.Template) == nil {
+			config.InfoLogger.Printf("No template %s, skipping archive pages of %s\n", job.Template, job.Dir)
+			continue
+		}
+		for _, p := range archivePages(years) {
+			p := p
+			archived = append(archived, p)
+			jobs = append(jobs, func() error {
+				if err := renderListPage(ctx, job.Template, p); err != nil {
+					return fmt.Errorf("archive %s: %v", p.Dir, err)
+				}
+				return nil
+			})
+		}
+	}
+	if err := output.Report.Phase("render", func() error {
+		pool := output.NewWorkerPool(config.Config.Concurrency)
+		for _, job := range jobs {
+			pool.Submit(job)
+		}
+		return pool.Wait()
+	}); err != nil {
+		var errs output.Errors
+		if errors.As(err, &errs) {
+			pageErrs = append(pageErrs, errs...)
+		} else {
+			pageErrs = append(pageErrs, err)
+		}
+	}
+	if len(pageErrs) > 0 {
+		return pageErrs
+	}
+	for _, p := range archived {
+		index.Add(p)
+	}
+
+	// Listings need every page rendered first
+	if err := generateTaxonomies(ctx); err != nil {
+		return err
+	}
+	lastTemplates = templates
+	// Nothing else depends on templates
+	if swappedTemplates != nil {
+		return nil
+	}
+	for _, job := range feeds {
+		if err := generateFeed(job, index.InDir(job.Dir)); err != nil {
+			return fmt.Errorf("%s: %v", job.Dir, err)
+		}
+	}
+
+	if config.Config.BaseURL == "" {
+		config.InfoLogger.Println("BaseURL unset in configuration, skipping sitemap")
+	} else {
+		if err := generateSitemap(index.All()); err != nil {
+			return fmt.Errorf("Error generating sitemap: %v", err)
+		}
+		if config.Config.Robots != nil {
+			if err := generateRobots(*config.Config.Robots); err != nil {
+				return fmt.Errorf("Error generating robots.txt: %v", err)
+			}
+		}
+	}
+	// Aliases come last so they can't replace anything else written
+	return generateAliases(aliases, index.All())
+}
+
+// renderContext is shared by the render jobs of one build.
+type renderContext struct {
+	Templates  *template.Template
+	Shortcodes *template.Template
+	Index      *pageIndex
+	Site       *Site
+	// Archives maps directories with Archive settings to their archive
+	// trees
+	Archives map[string][]*archiveYear
+}
+
+// renderHTMLPage renders an HTML page, which is a template itself. body is
+// the source file without its front matter.
+func renderHTMLPage(ctx *renderContext, p *Page, ftmpl string, fcfg config.File, body []byte) error {
+	// Every page gets its own copy of the shared set so its definitions
+	// don't leak into other pages
+	t, err := ctx.Templates.Clone()
+	if err != nil {
+		return err
+	}
+	if body, err = expandShortcodes(ctx.Shortcodes, p, body); err != nil {
+		return err
+	}
+	if _, err := t.New(filepath.Base(p.source)).Parse(string(body)); err != nil {
+		return err
+	}
+	bindFuncs(t, ctx, p)
+	return renderPaged(ctx, t, ftmpl, p, fcfg.Paginate)
+}
+
+func renderMarkdownPage(ctx *renderContext, p *Page, ftmpl string, fcfg config.File, body []byte) error {
+	// Markdown pages are registered under their file name, the same way
+	// HTML pages are, and as "content" so layouts can include them like
+	// HTML pages that define it
+	t, err := ctx.Templates.Clone()
+	if err != nil {
+		return err
+	}
+	if body, err = expandShortcodes(ctx.Shortcodes, p, body); err != nil {
+		return err
+	}
+	mt, err := t.New(filepath.Base(p.source)).Parse(string(renderMarkdown(body)))
+	if err != nil {
+		return err
+	}
+	if _, err := t.AddParseTree(config.ContentTemplateName, mt.Tree); err != nil {
+		return err
+	}
+	bindFuncs(t, ctx, p)
+	return renderPaged(ctx, t, ftmpl, p, fcfg.Paginate)
+}
+
+// bindFuncs replaces the template functions that depend on the page being
+// rendered in its own template set.
+func bindFuncs(t *template.Template, ctx *renderContext, p *Page) {
+	t.Funcs(template.FuncMap{
+		"T": func(key string, args ...interface{}) string {
+			return translate(p.Lang, key, args...)
+		},
+		"pages": ctx.Index.Pages,
+		"archives": func(dir string) []*archiveYear {
+			return ctx.Archives[path.Clean(strings.Trim(dir, "/"))]
+		},
+	})
+}
+
+// publishable reports whether a page should be built with the current options.
+func publishable(draft bool, publishDate time.Time) bool {
+	if draft && !config.Options.Drafts && !config.Config.Drafts {
+		return false
+	}
+	if publishDate.After(time.Now()) && !config.Options.Future && !config.Config.Future {
+		return false
+	}
+	return true
+}
+
+func executeTemplate(t *template.Template, name, dest string, data interface{}) error {
+	p, _ := data.(*Page)
+	if p != nil {
+		node := lastGraph.addRender(t, name, p)
+		if swappedTemplates != nil && !lastGraph.dependsOn(node, swappedTemplates) {
+			return nil
+		}
+	}
+	if Timings != nil {
+		return Timings.render(t, name, dest, data)
+	}
+	// Pretty URLs and listings put pages in directories of their own
+	if err := output.Target.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	// Create file
+	file, err := output.Target.Create(dest, 0666)
+	if err != nil {
+		return err
+	}
+	mediatype := "text/plain"
+	if config.IsHTML(dest) {
+		mediatype = "text/html"
+	}
+	// Protected pages are rendered in full before encrypting
+	var out io.Writer = file
+	var plain bytes.Buffer
+	if p.Protected() {
+		out = &plain
+	}
+	w := assets.MinifyWriter(mediatype, out)
+	if err := executePage(w, t, name, dest, data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	if p.Protected() {
+		if err := encryptPage(file, p, plain.Bytes()); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	output.Report.AddPage()
+	return nil
+}
+
+// LastBuild is when the site was last built successfully.
+var LastBuild time.Time
+
+// BuildSites builds the selected site, or every site of the workspace with
+// --all.
+func BuildSites() error {
+	opts := CommandOptions()
+	if !opts.Flags.All {
+		_, err := Build(opts)
+		return err
+	}
+	if opts.Flags.Site != "" {
+		return errors.New("--site and --all can't be combined")
+	}
+	if config.OutputPath != "" || config.ConfigPath != "" {
+		return errors.New("--output and --config name one site, they can't be used with --all")
+	}
+	workspace := opts.Dir
+	sites, err := config.WorkspaceSites(workspace)
+	if err != nil {
+		return fmt.Errorf("Error listing sites: %v", err)
+	}
+	if len(sites) == 0 {
+		return fmt.Errorf("No sites in %s", filepath.Join(workspace, config.SitesDirName))
+	}
+	var errs output.Errors
+	for _, site := range sites {
+		config.InfoLogger.Printf("Building site %s...\n", site)
+		opts.Dir, opts.Workspace = filepath.Join(workspace, config.SitesDirName, site), workspace
+		if _, err := Build(opts); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", site, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
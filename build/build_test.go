@@ -0,0 +1,57 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildInMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "siteware-build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"siteware.master.json":       `{"Output": "public"}`,
+		"templates/default.template": `<html><body>{{template "content" .}}</body></html>`,
+		"src/index.html":             `{{define "content"}}<p>hello</p>{{end}}`,
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Builds leave their settings behind for rebuilds
+	saved, savedTarget := CommandOptions(), output.Target
+	defer func() {
+		saved.apply()
+		output.Target = savedTarget
+	}()
+
+	var site output.Dir
+	withConfig(config.Master{}, func() {
+		site, err = Build(Options{Dir: dir, Output: output.NewMemFS()})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := site.ReadFile("index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "<p>hello</p>") {
+		t.Errorf("index.html = %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "public")); !os.IsNotExist(err) {
+		t.Errorf("in-memory build wrote the output directory: %v", err)
+	}
+}
@@ -0,0 +1,444 @@
+package build
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"html/template"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ThumbnailMethods are the values config.Thumbnail.Method accepts.
+var ThumbnailMethods = []string{"", "resize", "fit", "fill", "thumbnail"}
+
+// problem is something wrong with the project configuration. Warnings don't
+// stop a build.
+type problem struct {
+	File    string
+	Msg     string
+	Warning bool
+}
+
+func (p problem) String() string {
+	if p.Warning {
+		return fmt.Sprintf("%s: warning: %s", p.File, p.Msg)
+	}
+	return fmt.Sprintf("%s: %s", p.File, p.Msg)
+}
+
+func Check() error {
+	problems := checkProject()
+	for _, p := range problems {
+		config.ErrorLogger.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	config.InfoLogger.Println("No problems found")
+	return nil
+}
+
+// validate runs the project checks during a build, failing on errors and
+// logging warnings.
+func validate() error {
+	var errs output.Errors
+	for _, p := range checkProject() {
+		if p.Warning {
+			output.Report.Warn(fmt.Sprintf("%s: %s", p.File, p.Msg))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s", p))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkProject validates the master config and every directory config.
+func checkProject() []problem {
+	var problems []problem
+
+	cfgPath, err := config.MasterPath()
+	if err != nil {
+		problems = append(problems, problem{File: filepath.Join(config.InputPath, config.ConfigBaseName+config.ConfigExts[0]), Msg: err.Error()})
+	} else {
+		problems = append(problems, checkConfigFile(cfgPath, reflect.TypeOf(config.Master{}))...)
+		if config.Env != "" {
+			if overlay, err := config.EnvConfigPath(cfgPath); err != nil {
+				problems = append(problems, problem{File: cfgPath, Msg: fmt.Sprintf("no configuration for environment %s", config.Env)})
+			} else {
+				problems = append(problems, checkConfigFile(overlay, reflect.TypeOf(config.Master{}))...)
+			}
+		}
+		if raw, err := config.ReadConfigFile(cfgPath); err == nil {
+			if _, err := config.InterpolateEnv(raw); err != nil {
+				problems = append(problems, problem{File: cfgPath, Msg: err.Error()})
+			}
+		}
+		var cfg config.Master
+		if err := config.DecodeMaster(cfgPath, &cfg); err == nil && cfg.Output == "" && config.OutputPath == "" {
+			problems = append(problems, problem{File: cfgPath, Msg: "Output directory unset"})
+		}
+		for _, host := range cfg.Hosts {
+			if _, exist := Hosts[strings.ToLower(host)]; !exist {
+				problems = append(problems, problem{File: cfgPath, Msg: fmt.Sprintf("unknown host %q", host)})
+			}
+		}
+		for _, r := range cfg.Redirects {
+			if r.From == "" || r.To == "" {
+				problems = append(problems, problem{File: cfgPath, Msg: "redirects need From and To"})
+			}
+			if r.Status != 0 && (r.Status < 300 || r.Status > 399) {
+				problems = append(problems, problem{File: cfgPath, Msg: fmt.Sprintf("%s: redirect status %d is not a 3xx code", r.From, r.Status)})
+			}
+		}
+		if !config.ContainsFold(config.SymlinkModes, cfg.Symlinks) {
+			problems = append(problems, problem{File: cfgPath, Msg: fmt.Sprintf("unknown Symlinks mode %q", cfg.Symlinks)})
+		}
+		if cfg.Slugs != nil && strings.ContainsAny(cfg.Slugs.Spaces, "/\\") {
+			problems = append(problems, problem{File: cfgPath, Msg: "Slugs.Spaces must not contain path separators"})
+		}
+		if cfg.PostProcess != nil {
+			for _, name := range cfg.PostProcess.Chain {
+				if _, exist := HTMLProcessors[strings.ToLower(name)]; !exist {
+					problems = append(problems, problem{File: cfgPath, Msg: fmt.Sprintf("unknown HTML processor %q", name)})
+				}
+			}
+		}
+		for _, inj := range cfg.Injections {
+			if !config.ContainsFold(InjectPositions, inj.Position) {
+				problems = append(problems, problem{File: cfgPath, Msg: fmt.Sprintf("unknown injection Position %q", inj.Position)})
+			}
+		}
+		if cdn := cfg.ImageCDN; cdn != nil {
+			if !config.ContainsFold(assets.ImageCDNServices, cdn.Service) {
+				problems = append(problems, problem{File: cfgPath, Msg: fmt.Sprintf("unknown ImageCDN.Service %q", cdn.Service)})
+			} else if cdn.Service == "" && cdn.URL == "" {
+				problems = append(problems, problem{File: cfgPath, Msg: "ImageCDN needs a Service or a URL"})
+			} else if cdn.Service != "" && cdn.Base == "" {
+				problems = append(problems, problem{File: cfgPath, Msg: "ImageCDN.Base unset"})
+			}
+			if _, err := hex.DecodeString(cdn.Key); err != nil {
+				problems = append(problems, problem{File: cfgPath, Msg: "ImageCDN.Key is not hex encoded"})
+			}
+			if _, err := hex.DecodeString(cdn.Salt); err != nil {
+				problems = append(problems, problem{File: cfgPath, Msg: "ImageCDN.Salt is not hex encoded"})
+			}
+		}
+		if cfg.Proof != nil {
+			for _, dict := range cfg.Proof.Dictionaries {
+				if _, err := os.Stat(filepath.Join(config.InputPath, dict)); err != nil {
+					problems = append(problems, problem{File: cfgPath, Msg: fmt.Sprintf("proof dictionary: %v", err)})
+				}
+			}
+		}
+		for menu, entries := range cfg.Menus {
+			problems = append(problems, checkMenu(cfgPath, "Menus."+menu, entries)...)
+		}
+		if cfg.ThumbDir != "" && !plainName(cfg.ThumbDir) {
+			problems = append(problems, problem{File: cfgPath, Msg: "ThumbDir must be a plain directory name"})
+		}
+		if output := cfg.Output; cfg.ThumbDir == "" && output != "" {
+			if !filepath.IsAbs(output) {
+				output = filepath.Join(config.InputPath, output)
+			}
+			if dir := legacyThumbDir(output); dir != "" {
+				problems = append(problems, problem{File: cfgPath, Msg: fmt.Sprintf("%s holds thumbnails of an older build, which now go to %s directories; set ThumbDir to %q to keep their URLs", dir, config.DefaultThumbDirName, config.LegacyThumbDirName), Warning: true})
+			}
+		}
+		for dir, derivatives := range cfg.Images {
+			problems = append(problems, checkDerivatives(cfgPath, "Images."+dir, derivatives)...)
+		}
+	}
+
+	templates, err := loadTemplates()
+	if err != nil {
+		problems = append(problems, problem{File: filepath.Join(config.InputPath, config.TemplateDirName), Msg: err.Error()})
+	}
+
+	err = config.WalkSource(filepath.Join(config.InputPath, config.SourceDirName), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		cfgPath, err := config.FindConfigFile(path, config.DirConfigBaseName)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		dirProblems := checkConfigFile(cfgPath, reflect.TypeOf(config.Dir{}))
+		problems = append(problems, dirProblems...)
+
+		var cfg config.Dir
+		if err := config.DecodeConfigFile(cfgPath, &cfg); err != nil {
+			// Already reported by checkConfigFile
+			return nil
+		}
+		problems = append(problems, checkDirConfig(cfgPath, cfg, templates)...)
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, problem{File: filepath.Join(config.InputPath, config.SourceDirName), Msg: err.Error()})
+	}
+
+	// Image directories configure their derivatives
+	err = filepath.Walk(filepath.Join(config.InputPath, config.StaticDirName), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		cfgPath, err := config.FindConfigFile(path, config.DirConfigBaseName)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		problems = append(problems, checkConfigFile(cfgPath, reflect.TypeOf(map[string]config.Thumbnail{}))...)
+		var derivatives map[string]config.Thumbnail
+		if err := config.DecodeConfigFile(cfgPath, &derivatives); err != nil {
+			// Already reported by checkConfigFile
+			return nil
+		}
+		problems = append(problems, checkDerivatives(cfgPath, "", derivatives)...)
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, problem{File: filepath.Join(config.InputPath, config.StaticDirName), Msg: err.Error()})
+	}
+	return problems
+}
+
+// checkConfigFile reports syntax errors and keys that don't match any field
+// of t.
+func checkConfigFile(path string, t reflect.Type) []problem {
+	var raw interface{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		m := make(map[string]interface{})
+		if err := config.DecodeFile(path, &m); err != nil {
+			return []problem{{File: path, Msg: err.Error()}}
+		}
+		raw = m
+	} else if err := config.DecodeFile(path, &raw); err != nil {
+		return []problem{{File: path, Msg: err.Error()}}
+	}
+
+	var problems []problem
+	for _, key := range unknownKeys(config.JSONCompatible(raw), t, "") {
+		problems = append(problems, problem{File: path, Msg: fmt.Sprintf("unknown key %q", key), Warning: true})
+	}
+	return problems
+}
+
+// unknownKeys walks decoded config data alongside the type it will be
+// decoded into and returns the dotted paths of keys that would be ignored.
+// Field names match case-insensitively like encoding/json does.
+func unknownKeys(v interface{}, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var keys []string
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		names := make([]string, 0, len(m))
+		for k := range m {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			f, ok := t.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, k) })
+			if !ok || f.PkgPath != "" {
+				keys = append(keys, prefix+k)
+				continue
+			}
+			keys = append(keys, unknownKeys(m[k], f.Type, prefix+k+".")...)
+		}
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for k, val := range m {
+			keys = append(keys, unknownKeys(val, t.Elem(), prefix+k+".")...)
+		}
+	case reflect.Slice:
+		s, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, val := range s {
+			keys = append(keys, unknownKeys(val, t.Elem(), fmt.Sprintf("%s%d.", prefix, i))...)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkDirConfig validates the values of a directory config.
+func checkDirConfig(path string, cfg config.Dir, templates *template.Template) []problem {
+	var problems []problem
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fcfg := cfg[name]
+		if config.IsGlob(name) {
+			if _, err := filepath.Match(name, ""); err != nil {
+				problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: invalid pattern", name)})
+			}
+		}
+		if fcfg.Template != "" && templates != nil && templates.Lookup(fcfg.Template) == nil {
+			problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: template %q not found", name, fcfg.Template)})
+		}
+		if fcfg.AutoIndex != "" && templates != nil && templates.Lookup(fcfg.AutoIndex) == nil {
+			problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: AutoIndex template %q not found", name, fcfg.AutoIndex)})
+		}
+		if fcfg.Archive != "" && templates != nil && templates.Lookup(fcfg.Archive) == nil {
+			problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: Archive template %q not found", name, fcfg.Archive)})
+		}
+		if !config.ContainsFold(PageOrders, fcfg.Order) {
+			problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: unknown Order %q", name, fcfg.Order)})
+		}
+		for _, schema := range fcfg.Schema {
+			if _, exist := SchemaTypes[schema]; !exist {
+				problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: unknown schema type %q", name, schema)})
+			}
+		}
+		if fcfg.Paginate < 0 {
+			problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: Paginate can't be negative", name)})
+		}
+		for dir, thumbCfg := range fcfg.AutoThumbnail {
+			problems = append(problems, checkThumbnailConfig(path, name+"."+dir, thumbCfg)...)
+		}
+		for dir, derivatives := range fcfg.Images {
+			problems = append(problems, checkDerivatives(path, name+"."+dir, derivatives)...)
+		}
+	}
+	return problems
+}
+
+// checkDerivatives validates named derivatives, prefix being the key they
+// are found under.
+func checkDerivatives(path, prefix string, derivatives map[string]config.Thumbnail) []problem {
+	var problems []problem
+	names := make([]string, 0, len(derivatives))
+	for name := range derivatives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		if !plainName(name) {
+			problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: derivative names must be plain directory names", key)})
+		}
+		problems = append(problems, checkThumbnailConfig(path, key, derivatives[name])...)
+	}
+	return problems
+}
+
+func checkThumbnailConfig(path, key string, cfg config.Thumbnail) []problem {
+	var problems []problem
+	if !config.ContainsFold(ThumbnailMethods, cfg.Method) {
+		problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: unknown thumbnail method %q", key, cfg.Method)})
+	}
+	if cfg.OutputFormat != "" && assets.FormatExt(cfg.OutputFormat) == "" {
+		problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: unknown output format %q", key, cfg.OutputFormat)})
+	}
+	if cfg.Width <= 0 && cfg.Height <= 0 {
+		problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: thumbnail Width and Height are both unset", key)})
+	}
+	if cfg.Quality < 0 || cfg.Quality > 100 {
+		problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: Quality must be between 1 and 100", key)})
+	}
+	if _, exist := assets.PNGCompressionLevels[strings.ToLower(cfg.PNGCompression)]; !exist {
+		problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: unknown PNG compression %q", key, cfg.PNGCompression)})
+	}
+	if _, exist := assets.ResampleFilters[strings.ToLower(cfg.Filter)]; !exist {
+		problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: unknown filter %q", key, cfg.Filter)})
+	}
+	if cfg.Sharpen < 0 {
+		problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: Sharpen can't be negative", key)})
+	}
+	if wm := cfg.Watermark; wm.Enabled() {
+		if _, exist := assets.WatermarkPositions[strings.ToLower(wm.Position)]; !exist {
+			problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: unknown watermark position %q", key, wm.Position)})
+		}
+		if wm.Opacity < 0 || wm.Opacity > 1 {
+			problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: watermark Opacity must be between 0 and 1", key)})
+		}
+		if wm.Image != "" {
+			if _, err := os.Stat(filepath.Join(config.InputPath, filepath.FromSlash(wm.Image))); err != nil {
+				problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: watermark image: %v", key, err)})
+			}
+		}
+	}
+	return problems
+}
+
+// checkMenu validates configured menu entries and their children.
+func checkMenu(path, key string, entries []*config.Menu) []problem {
+	var problems []problem
+	for _, e := range entries {
+		if e.Name == "" || e.URL == "" {
+			problems = append(problems, problem{File: path, Msg: fmt.Sprintf("%s: menu entries need Name and URL", key)})
+		}
+		problems = append(problems, checkMenu(path, key+"."+e.Name, e.Children)...)
+	}
+	return problems
+}
+
+// legacyThumbDir returns a thumbnail directory of the old default name in
+// the published static files of output, one that isn't among the static
+// files of the project, or an empty string if there is none.
+func legacyThumbDir(output string) string {
+	root := filepath.Join(output, config.StaticDirName)
+	found := ""
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || found != "" {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() || info.Name() != config.LegacyThumbDirName {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(config.InputPath, config.StaticDirName, rel)); os.IsNotExist(err) {
+			found = p
+		}
+		return filepath.SkipDir
+	})
+	return found
+}
+
+// plainName reports whether name can be used as a single directory name.
+func plainName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,66 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadSiteData reads every data file below the data directory into a map
+// keyed by file name without extension. Subdirectories become nested maps,
+// so data/menu/main.json is .Site.Data.menu.main in templates.
+func loadSiteData() (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	root := filepath.Join(config.InputPath, config.DataDirName)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json", ".yaml", ".yml", ".toml":
+		default:
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		m := data
+		for _, dir := range parts[:len(parts)-1] {
+			sub, ok := m[dir].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				m[dir] = sub
+			}
+			m = sub
+		}
+
+		var v interface{}
+		if strings.EqualFold(filepath.Ext(path), ".toml") {
+			// TOML documents are always tables
+			t := make(map[string]interface{})
+			if err := config.DecodeFile(path, &t); err != nil {
+				return err
+			}
+			v = t
+		} else if err := config.DecodeFile(path, &v); err != nil {
+			return err
+		}
+		name := parts[len(parts)-1]
+		m[strings.TrimSuffix(name, filepath.Ext(name))] = config.JSONCompatible(v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
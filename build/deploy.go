@@ -0,0 +1,130 @@
+package build
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+type deployer func(cfg config.Deploy) error
+
+// Deployers maps deploy targets to their implementations.
+var Deployers = map[string]deployer{
+	"git":   deployGit,
+	"rsync": deployRsync,
+	"s3":    deployS3,
+}
+
+func Deploy() error {
+	if err := config.Load(); err != nil {
+		return err
+	}
+	if config.Config.Output == "" {
+		return errors.New("Output directory unset in configuration")
+	}
+	cfg := config.Config.Deploy
+	if cfg == nil {
+		cfg = &config.Deploy{}
+	}
+	applyDeployEnv(cfg)
+
+	d, exist := Deployers[cfg.Target]
+	if !exist {
+		return fmt.Errorf("Unknown deploy target \"%s\"", cfg.Target)
+	}
+	config.InfoLogger.Printf("Deploying %s with %s...\n", config.Config.Output, cfg.Target)
+	if err := d(*cfg); err != nil {
+		return fmt.Errorf("Error deploying: %v", err)
+	}
+	config.InfoLogger.Println("Done!")
+	return nil
+}
+
+// applyDeployEnv lets environment variables override the deploy config, so
+// credentials can stay out of the project files.
+func applyDeployEnv(cfg *config.Deploy) {
+	for env, field := range map[string]*string{
+		"SITEWARE_DEPLOY_TARGET": &cfg.Target,
+		"SITEWARE_DEPLOY_REMOTE": &cfg.Remote,
+		"SITEWARE_DEPLOY_BRANCH": &cfg.Branch,
+		"SITEWARE_DEPLOY_DEST":   &cfg.Destination,
+		"SITEWARE_DEPLOY_SSHKEY": &cfg.SSHKey,
+		"SITEWARE_DEPLOY_BUCKET": &cfg.Bucket,
+		"AWS_REGION":             &cfg.Region,
+		"AWS_ACCESS_KEY_ID":      &cfg.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY":  &cfg.SecretAccessKey,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*field = v
+		}
+	}
+}
+
+func deployGit(cfg config.Deploy) error {
+	remote := cfg.Remote
+	if remote == "" {
+		remote = "origin"
+	}
+	msg, err := commitMessage(cfg.Message)
+	if err != nil {
+		return fmt.Errorf("Error in commit message: %v", err)
+	}
+
+	if err := config.Run(config.Config.Output, nil, "git", "add", "-A"); err != nil {
+		return err
+	}
+	status, err := exec.Command("git", "-C", config.Config.Output, "status", "--porcelain").Output()
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(status)) == 0 {
+		config.InfoLogger.Println("Nothing to commit")
+	} else if err := config.Run(config.Config.Output, nil, "git", "commit", "-m", msg); err != nil {
+		return err
+	}
+
+	args := []string{"push", remote}
+	if cfg.Branch != "" {
+		args = append(args, "HEAD:"+cfg.Branch)
+	}
+	return config.Run(config.Config.Output, nil, "git", args...)
+}
+
+func deployRsync(cfg config.Deploy) error {
+	if cfg.Destination == "" {
+		return fmt.Errorf("rsync destination unset")
+	}
+	args := []string{"-az", "--delete", "--exclude", ".git"}
+	if cfg.SSHKey != "" {
+		args = append(args, "-e", "ssh -i "+cfg.SSHKey)
+	}
+	// The trailing slash syncs the contents rather than the directory itself
+	args = append(args, strings.TrimSuffix(config.Config.Output, string(os.PathSeparator))+string(os.PathSeparator), cfg.Destination)
+	return config.Run("", nil, "rsync", args...)
+}
+
+func deployS3(cfg config.Deploy) error {
+	if cfg.Bucket == "" {
+		return fmt.Errorf("s3 bucket unset")
+	}
+	dest := "s3://" + cfg.Bucket
+	if cfg.Prefix != "" {
+		dest += "/" + strings.Trim(cfg.Prefix, "/")
+	}
+	args := []string{"s3", "sync", config.Config.Output, dest, "--delete", "--exclude", ".git/*"}
+	if cfg.Endpoint != "" {
+		args = append(args, "--endpoint-url", cfg.Endpoint)
+	}
+	if cfg.Region != "" {
+		args = append(args, "--region", cfg.Region)
+	}
+	var env []string
+	if cfg.AccessKeyID != "" {
+		env = append(env, "AWS_ACCESS_KEY_ID="+cfg.AccessKeyID, "AWS_SECRET_ACCESS_KEY="+cfg.SecretAccessKey)
+	}
+	return config.Run("", env, "aws", args...)
+}
@@ -0,0 +1,69 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// imageDimensions adds the width and height of images to their tags, so
+// browsers reserve the space before they load. Images of other sites and
+// those with either attribute already are left alone.
+func imageDimensions(p *Page, html []byte) ([]byte, error) {
+	return rewriteTags(html, "img", func(attrs string) string {
+		_, hasWidth := attrValue(attrs, "width")
+		_, hasHeight := attrValue(attrs, "height")
+		src, _ := attrValue(attrs, "src")
+		if hasWidth || hasHeight || src == "" {
+			return attrs
+		}
+		w, h, ok := imageSize(p, src)
+		if !ok {
+			return attrs
+		}
+		attrs = setAttr(attrs, "width", strconv.Itoa(w))
+		return setAttr(attrs, "height", strconv.Itoa(h))
+	}), nil
+}
+
+// imageSize finds the size of the image a page links to as src. Originals
+// are read from the output, derivatives, which are generated after pages,
+// are sized from the original and their settings.
+func imageSize(p *Page, src string) (int, int, bool) {
+	ref, err := url.Parse(src)
+	if err != nil || (ref.IsAbs() && !strings.HasPrefix(src, strings.TrimSuffix(config.Config.BaseURL, "/")+"/")) {
+		return 0, 0, false
+	}
+	site := ref.Path
+	if ref.IsAbs() || strings.HasPrefix(site, "/") {
+		prefix := "/"
+		if u, err := url.Parse(config.Config.BaseURL); err == nil && u.Path != "" {
+			prefix = u.Path
+		}
+		site = strings.TrimPrefix(site, strings.TrimSuffix(prefix, "/"))
+	} else if p != nil {
+		base, err := url.Parse(siteURLPath(p.RelPermalink))
+		if err != nil {
+			return 0, 0, false
+		}
+		site = base.ResolveReference(ref).Path
+	}
+	rel := strings.TrimPrefix(path.Clean("/"+site), "/")
+
+	if w, h, err := assets.OutputImageSize(rel); err == nil {
+		return w, h, true
+	}
+	orig, cfg, ok := assets.DerivativeOriginal(rel)
+	if !ok {
+		return 0, 0, false
+	}
+	w, h, err := assets.OutputImageSize(orig)
+	if err != nil {
+		return 0, 0, false
+	}
+	w, h = assets.DerivativeSize(w, h, cfg)
+	return w, h, w > 0 && h > 0
+}
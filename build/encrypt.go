@@ -0,0 +1,110 @@
+package build
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"golang.org/x/crypto/pbkdf2"
+	"html"
+	"io"
+)
+
+// PasswordIterations of PBKDF2 slow down guessing. The browser derives the
+// key the same way with WebCrypto.
+const PasswordIterations = 100000
+
+// encryptPage writes a shell page asking for the password, holding the
+// rendered page encrypted with AES-GCM under a PBKDF2 key. Passwords of
+// directory configs and front matter can read environment variables as
+// "${NAME}" like the master config, so they needn't be committed.
+func encryptPage(w io.Writer, p *Page, plain []byte) error {
+	password, err := config.ExpandEnv(p.password)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, 16)
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(password), salt, PasswordIterations, 32, sha256.New))
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"salt":       base64.StdEncoding.EncodeToString(salt),
+		"nonce":      base64.StdEncoding.EncodeToString(nonce),
+		"data":       base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plain, nil)),
+		"iterations": PasswordIterations,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, passwordShell, html.EscapeString(p.Title), payload)
+	return err
+}
+
+// passwordShell decrypts the page in the browser and replaces itself with
+// it. The password is kept for the session, so a protected section asks
+// once.
+const passwordShell = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>%s</title>
+<style>body{font-family:sans-serif;display:flex;justify-content:center;margin-top:20vh}form{display:flex;gap:.5em}#error{color:#b00}</style>
+</head>
+<body>
+<form id="unlock">
+<input type="password" id="password" placeholder="Password" autofocus required>
+<button>Open</button>
+<p id="error" hidden>Wrong password</p>
+</form>
+<script id="encrypted" type="application/json">%s</script>
+<script>
+(function() {
+	var page = JSON.parse(document.getElementById("encrypted").textContent);
+	function bytes(s) { return Uint8Array.from(atob(s), function(c) { return c.charCodeAt(0); }); }
+	function open(password) {
+		var enc = new TextEncoder();
+		return crypto.subtle.importKey("raw", enc.encode(password), "PBKDF2", false, ["deriveKey"]).then(function(material) {
+			return crypto.subtle.deriveKey({name: "PBKDF2", salt: bytes(page.salt), iterations: page.iterations, hash: "SHA-256"},
+				material, {name: "AES-GCM", length: 256}, false, ["decrypt"]);
+		}).then(function(key) {
+			return crypto.subtle.decrypt({name: "AES-GCM", iv: bytes(page.nonce)}, key, bytes(page.data));
+		}).then(function(plain) {
+			sessionStorage.setItem("siteware-password", password);
+			document.open();
+			document.write(new TextDecoder().decode(plain));
+			document.close();
+		});
+	}
+	var saved = sessionStorage.getItem("siteware-password");
+	if (saved) {
+		open(saved).catch(function() {});
+	}
+	document.getElementById("unlock").addEventListener("submit", function(e) {
+		e.preventDefault();
+		open(document.getElementById("password").value).catch(function() {
+			document.getElementById("error").hidden = false;
+		});
+	});
+})();
+</script>
+</body>
+</html>
+`
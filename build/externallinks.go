@@ -0,0 +1,200 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const LinkCacheFileName = "links.json"
+const DefaultLinkTimeout = 10
+const DefaultLinkConcurrency = 8
+const DefaultLinkCacheHours = 24
+
+// linkCheckOptions are set from the check-links command flags.
+type linkCheckOptions struct {
+	External bool
+	NoCache  bool
+}
+
+var LinkCheckOptions linkCheckOptions
+
+// linkCacheEntry is the last result of checking an outbound URL.
+type linkCacheEntry struct {
+	Checked time.Time
+	Status  int
+	Err     string `json:",omitempty"`
+}
+
+func (e linkCacheEntry) broken() bool {
+	return e.Err != "" || e.Status >= 400
+}
+
+func (e linkCacheEntry) String() string {
+	if e.Err != "" {
+		return e.Err
+	}
+	return fmt.Sprintf("status %d", e.Status)
+}
+
+type linkCache struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]linkCacheEntry
+}
+
+func loadLinkCache() *linkCache {
+	c := &linkCache{
+		path:    filepath.Join(config.InputPath, assets.CacheDirName, LinkCacheFileName),
+		Entries: make(map[string]linkCacheEntry),
+	}
+	if LinkCheckOptions.NoCache {
+		return c
+	}
+	b, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(b, &c.Entries); err != nil {
+		// A broken cache only costs checking every link again
+		c.Entries = make(map[string]linkCacheEntry)
+	}
+	return c
+}
+
+// fresh returns the cached result of a working link checked recently enough.
+func (c *linkCache) fresh(link string, maxAge time.Duration) (linkCacheEntry, bool) {
+	c.mu.Lock()
+	e, exist := c.Entries[link]
+	c.mu.Unlock()
+	if !exist || e.broken() || time.Since(e.Checked) > maxAge {
+		return e, false
+	}
+	return e, true
+}
+
+func (c *linkCache) put(link string, e linkCacheEntry) {
+	c.mu.Lock()
+	c.Entries[link] = e
+	c.mu.Unlock()
+}
+
+func (c *linkCache) save() error {
+	b, err := json.MarshalIndent(c.Entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, b, 0644)
+}
+
+// requestLink asks for the headers of a URL, falling back to GET for
+// servers that don't answer HEAD.
+func requestLink(client *http.Client, link string) linkCacheEntry {
+	e := linkCacheEntry{Checked: time.Now()}
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, link, nil)
+		if err != nil {
+			e.Err = err.Error()
+			return e
+		}
+		req.Header.Set("User-Agent", "siteware-check-links")
+		resp, err := client.Do(req)
+		if err != nil {
+			e.Err = err.Error()
+			return e
+		}
+		resp.Body.Close()
+		e.Status = resp.StatusCode
+		if method == http.MethodHead && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+			continue
+		}
+		break
+	}
+	return e
+}
+
+// brokenExternalLinks requests every outbound http and https URL of the
+// crawled pages once.
+func brokenExternalLinks(pages map[string]*crawledPage) ([]brokenLink, error) {
+	cfg := config.Config.LinkCheck
+	if cfg == nil {
+		cfg = &config.LinkCheck{}
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultLinkTimeout
+	}
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultLinkConcurrency
+	}
+	cacheHours := cfg.CacheHours
+	if cacheHours <= 0 {
+		cacheHours = DefaultLinkCacheHours
+	}
+	maxAge := time.Duration(cacheHours) * time.Hour
+
+	// Pages referencing each URL, so it is requested only once
+	sources := make(map[string][]string)
+	for rel, page := range pages {
+		for _, ref := range page.Refs {
+			u, _, internal := sitePath(page, ref)
+			if internal || u == nil || (u.Scheme != "http" && u.Scheme != "https") || cfg.Allowed(u) {
+				continue
+			}
+			u.Fragment = ""
+			sources[u.String()] = append(sources[u.String()], rel)
+		}
+	}
+
+	cache := loadLinkCache()
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	pool := output.NewWorkerPool(concurrency)
+	for link := range sources {
+		link := link
+		if _, ok := cache.fresh(link, maxAge); ok {
+			config.DebugLogger.Printf("%s checked recently\n", link)
+			continue
+		}
+		pool.Submit(func() error {
+			config.DebugLogger.Printf("Checking %s\n", link)
+			cache.put(link, requestLink(client, link))
+			return nil
+		})
+	}
+	pool.Wait()
+
+	var broken []brokenLink
+	for link, rels := range sources {
+		e := cache.Entries[link]
+		if !e.broken() {
+			continue
+		}
+		for _, rel := range rels {
+			broken = append(broken, brokenLink{Page: rel, Target: link, Msg: e.String()})
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		if broken[i].Page != broken[j].Page {
+			return broken[i].Page < broken[j].Page
+		}
+		return broken[i].Target < broken[j].Target
+	})
+	config.InfoLogger.Printf("Checked %d external links\n", len(sources))
+	if err := cache.save(); err != nil {
+		return broken, fmt.Errorf("Error saving link cache: %v", err)
+	}
+	return broken, nil
+}
@@ -0,0 +1,174 @@
+package build
+
+import (
+	"encoding/xml"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const RSSFileName = "rss.xml"
+const AtomFileName = "atom.xml"
+
+const DefaultFeedLimit = 20
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate,omitempty"`
+	Description string `xml:"description,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+	Summary string   `xml:"summary,omitempty"`
+}
+
+// feedJob is a directory with a feed enabled in its parent's config.
+type feedJob struct {
+	Dir  string
+	Dest string
+	Cfg  config.Feed
+}
+
+// generateFeed writes RSS and Atom feeds for the pages of one directory.
+func generateFeed(job feedJob, pages []*Page) error {
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Date.After(pages[j].Date)
+	})
+	limit := job.Cfg.Limit
+	if limit <= 0 {
+		limit = DefaultFeedLimit
+	}
+	if len(pages) > limit {
+		pages = pages[:limit]
+	}
+
+	siteLink := job.Cfg.Link
+	if siteLink == "" {
+		siteLink = config.Config.BaseURL
+	}
+	base := strings.TrimSuffix(siteLink, "/")
+	updated := time.Now()
+	if len(pages) > 0 && !pages[0].Date.IsZero() {
+		updated = pages[0].Date
+	}
+	dirURL := "/"
+	if rel, err := filepath.Rel(config.Config.Output, job.Dest); err == nil && rel != "." {
+		dirURL = "/" + filepath.ToSlash(rel) + "/"
+	}
+
+	rss := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         job.Cfg.Title,
+			Link:          base + dirURL,
+			Description:   job.Cfg.Description,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+		},
+	}
+	atom := atomFeed{
+		Title:   job.Cfg.Title,
+		ID:      base + dirURL,
+		Link:    []atomLink{{Href: base + dirURL}, {Href: base + dirURL + AtomFileName, Rel: "self"}},
+		Updated: updated.Format(time.RFC3339),
+	}
+	if job.Cfg.Author != "" {
+		atom.Author = &atomAuthor{Name: job.Cfg.Author}
+	}
+
+	for _, p := range pages {
+		link := p.Permalink
+		if job.Cfg.Link != "" {
+			link = base + siteURLPath(p.RelPermalink)
+		}
+		// The summary would give away protected pages
+		summary := p.Summary
+		if p.Protected() {
+			summary = ""
+		}
+		item := rssItem{
+			Title:       p.Title,
+			Link:        link,
+			GUID:        link,
+			Description: summary,
+		}
+		entry := atomEntry{
+			Title:   p.Title,
+			ID:      link,
+			Link:    atomLink{Href: link},
+			Summary: summary,
+			Updated: updated.Format(time.RFC3339),
+		}
+		if !p.Date.IsZero() {
+			item.PubDate = p.Date.Format(time.RFC1123Z)
+			entry.Updated = p.Date.Format(time.RFC3339)
+		}
+		rss.Channel.Items = append(rss.Channel.Items, item)
+		atom.Entries = append(atom.Entries, entry)
+	}
+
+	if err := writeXML(filepath.Join(job.Dest, RSSFileName), rss); err != nil {
+		return err
+	}
+	return writeXML(filepath.Join(job.Dest, AtomFileName), atom)
+}
+
+func writeXML(dest string, v interface{}) error {
+	file, err := output.Target.Create(dest, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, xml.Header); err != nil {
+		file.Close()
+		return err
+	}
+	enc := xml.NewEncoder(file)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,267 @@
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultContentfulURL is the delivery API of Contentful. Other CMSes with
+// the same API take their own URL.
+const DefaultContentfulURL = "https://cdn.contentful.com"
+
+// ContentfulPageSize is the most entries the delivery API returns per
+// request. Larger content types are requested page by page.
+const ContentfulPageSize = 1000
+
+type fetcher func(cfg config.Fetch, dest string) error
+
+// Fetchers maps fetch adapters to their implementations.
+var Fetchers = map[string]fetcher{
+	"rest":       fetchREST,
+	"git":        fetchGit,
+	"contentful": fetchContentful,
+}
+
+// Fetch pulls the content of every source in the master config, or of
+// those named as arguments.
+func Fetch(args []string) error {
+	if err := config.Load(); err != nil {
+		return err
+	}
+	return fetchSources(args)
+}
+
+func fetchSources(names []string) error {
+	if len(config.Config.Fetch) == 0 {
+		return errors.New("No fetch sources in configuration")
+	}
+	if len(names) == 0 {
+		for name := range config.Config.Fetch {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		cfg, exist := config.Config.Fetch[name]
+		if !exist {
+			return fmt.Errorf("Unknown fetch source \"%s\"", name)
+		}
+		f, exist := Fetchers[cfg.Adapter]
+		if !exist {
+			return fmt.Errorf("%s: unknown fetch adapter \"%s\"", name, cfg.Adapter)
+		}
+		dest := filepath.Join(config.InputPath, filepath.FromSlash(cfg.Dest))
+		if cfg.Dest == "" || !(config.IsSubpath(filepath.Join(config.InputPath, config.SourceDirName), dest) || config.IsSubpath(filepath.Join(config.InputPath, config.DataDirName), dest)) {
+			return fmt.Errorf("%s: Dest must be below %s or %s", name, config.SourceDirName, config.DataDirName)
+		}
+		config.InfoLogger.Printf("Fetching %s with %s...\n", name, cfg.Adapter)
+		if err := f(cfg, dest); err != nil {
+			return fmt.Errorf("Error fetching %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// getRemoteJSON requests url with the given headers and decodes the JSON
+// answer.
+func getRemoteJSON(url string, headers map[string]string) (interface{}, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: RemoteTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	var v interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	return v, nil
+}
+
+func fetchREST(cfg config.Fetch, dest string) error {
+	if cfg.URL == "" {
+		return errors.New("URL unset")
+	}
+	v, err := getRemoteJSON(cfg.URL, cfg.Headers)
+	if err != nil {
+		return err
+	}
+	if cfg.Items == "" {
+		b, err := json.MarshalIndent(v, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dest, b, 0644)
+	}
+	for _, key := range strings.Split(cfg.Items, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("no %s in the response", cfg.Items)
+		}
+		v = m[key]
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("%s is not a list", cfg.Items)
+	}
+	var entries []map[string]interface{}
+	for _, item := range list {
+		if entry, ok := item.(map[string]interface{}); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return writeEntries(cfg, dest, entries)
+}
+
+// writeEntries writes each entry as a Markdown page with JSON front matter.
+// Nothing is written when entries lack a name or two share one.
+func writeEntries(cfg config.Fetch, dest string, entries []map[string]interface{}) error {
+	nameField, bodyField := cfg.Name, cfg.Body
+	if nameField == "" {
+		nameField = "slug"
+	}
+	if bodyField == "" {
+		bodyField = "body"
+	}
+	names := make([]string, len(entries))
+	taken := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		name := slugify(fmt.Sprint(entry[nameField]))
+		if entry[nameField] == nil || name == "" {
+			return fmt.Errorf("entry %d has no %s", i+1, nameField)
+		}
+		// Names differing only in what slugify drops would overwrite
+		if j, exist := taken[name]; exist {
+			return fmt.Errorf("entries %d and %d are both written to %s.md", j+1, i+1, name)
+		}
+		taken[name] = i
+		names[i] = name
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		name := names[i]
+		body, _ := entry[bodyField].(string)
+		fm := make(map[string]interface{}, len(entry))
+		for k, v := range entry {
+			if k != bodyField {
+				fm[k] = v
+			}
+		}
+		head, err := json.MarshalIndent(fm, "", "\t")
+		if err != nil {
+			return err
+		}
+		page := append(head, "\n\n"...)
+		page = append(page, body...)
+		config.DebugLogger.Printf("Write %s.md\n", name)
+		if err := ioutil.WriteFile(filepath.Join(dest, name+".md"), page, 0644); err != nil {
+			return err
+		}
+	}
+	config.InfoLogger.Printf("Wrote %d pages to %s\n", len(entries), cfg.Dest)
+	return nil
+}
+
+func fetchGit(cfg config.Fetch, dest string) error {
+	if cfg.Repo == "" {
+		return config.Run(config.InputPath, nil, "git", "submodule", "update", "--init", "--remote", "--", filepath.ToSlash(cfg.Dest))
+	}
+	if _, err := os.Stat(filepath.Join(dest, ".git")); err == nil {
+		return config.Run(dest, nil, "git", "pull", "--ff-only")
+	}
+	args := []string{"clone", "--depth", "1"}
+	if cfg.Branch != "" {
+		args = append(args, "--branch", cfg.Branch)
+	}
+	return config.Run("", nil, "git", append(args, cfg.Repo, dest)...)
+}
+
+func fetchContentful(cfg config.Fetch, dest string) error {
+	if cfg.Space == "" || cfg.ContentType == "" {
+		return errors.New("Space and ContentType must be set")
+	}
+	base, env := cfg.URL, cfg.Environment
+	if base == "" {
+		base = DefaultContentfulURL
+	}
+	if env == "" {
+		env = "master"
+	}
+	type item struct {
+		Sys struct {
+			ID        string
+			CreatedAt string
+			UpdatedAt string
+		}
+		Fields map[string]interface{}
+	}
+	var items []item
+	for {
+		query := url.Values{
+			"content_type": {cfg.ContentType},
+			"limit":        {strconv.Itoa(ContentfulPageSize)},
+			"skip":         {strconv.Itoa(len(items))},
+		}
+		u := fmt.Sprintf("%s/spaces/%s/environments/%s/entries?%s", strings.TrimSuffix(base, "/"), url.PathEscape(cfg.Space), url.PathEscape(env), query.Encode())
+		v, err := getRemoteJSON(u, map[string]string{"Authorization": "Bearer " + cfg.AccessToken})
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Total int
+			Items []item
+		}
+		if err := config.Convert(v, &resp); err != nil {
+			return err
+		}
+		items = append(items, resp.Items...)
+		if len(resp.Items) == 0 || len(items) >= resp.Total {
+			break
+		}
+	}
+	// Entries without a slug are named by their ID
+	nameField := cfg.Name
+	if nameField == "" {
+		nameField = "slug"
+	}
+	var entries []map[string]interface{}
+	for _, item := range items {
+		entry := item.Fields
+		if entry == nil {
+			entry = make(map[string]interface{})
+		}
+		if entry[nameField] == nil {
+			entry[nameField] = item.Sys.ID
+		}
+		if entry["date"] == nil && item.Sys.CreatedAt != "" {
+			entry["date"] = item.Sys.CreatedAt
+		}
+		entries = append(entries, entry)
+	}
+	return writeEntries(cfg, dest, entries)
+}
@@ -0,0 +1,59 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestFetchContentfulPages(t *testing.T) {
+	const total = 5
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server returns fewer entries than asked for, as the API may
+		skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+		var items []interface{}
+		for i := skip; i < total && i < skip+2; i++ {
+			items = append(items, map[string]interface{}{
+				"sys":    map[string]interface{}{"id": fmt.Sprint("entry", i)},
+				"fields": map[string]interface{}{"body": "text"},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"total": total, "items": items})
+	}))
+	defer srv.Close()
+
+	dest, err := ioutil.TempDir("", "siteware-fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	if err := fetchContentful(config.Fetch{URL: srv.URL, Space: "s", ContentType: "post"}, dest); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dest, "*.md"))
+	if len(files) != total {
+		t.Errorf("wrote %d pages, want %d: %q", len(files), total, files)
+	}
+}
+
+func TestWriteEntriesCollision(t *testing.T) {
+	dest, err := ioutil.TempDir("", "siteware-fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	entries := []map[string]interface{}{{"slug": "Hello World"}, {"slug": "hello-world"}}
+	if err := writeEntries(config.Fetch{}, dest, entries); err == nil {
+		t.Error("writeEntries of entries with the same name succeeded")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dest, "*.md")); len(files) != 0 {
+		t.Errorf("writeEntries wrote %q despite the collision", files)
+	}
+}
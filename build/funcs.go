@@ -0,0 +1,282 @@
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"html/template"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TemplateFunctions are the functions available to every template.
+var TemplateFunctions template.FuncMap
+
+func init() {
+	TemplateFunctions = template.FuncMap{
+		"readdir":     readdir,
+		"absURL":      config.AbsURL,
+		"relURL":      config.RelURL,
+		"permalink":   permalink,
+		"jsBundle":    assets.JSBundle,
+		"T":           T,
+		"pages":       noPages,
+		"archives":    noArchives,
+		"breadcrumbs": breadcrumbs,
+		"imageMeta":   assets.ImageMeta,
+		"imageURL":    assets.ImageURL,
+		"videoMeta":   assets.VideoMeta,
+		"ogTags":      ogTags,
+		"jsonld":      jsonld,
+		"getJSON":     getJSON,
+		"getCSV":      getCSV,
+
+		"markdownify": markdownify,
+		"dateFormat":  dateFormat,
+		"safeHTML":    safeHTML,
+		"truncate":    truncate,
+		"slugify":     slugify,
+		"upper":       strings.ToUpper,
+		"lower":       strings.ToLower,
+		"title":       strings.Title,
+		"jsonDecode":  jsonDecode,
+		"dict":        dict,
+		"seq":         seq,
+		"sort":        sortList,
+	}
+}
+
+// markdownify renders a Markdown string as HTML.
+func markdownify(s string) template.HTML {
+	return template.HTML(renderMarkdown([]byte(s)))
+}
+
+// safeHTML marks a string as trusted HTML so it isn't escaped.
+func safeHTML(s string) template.HTML {
+	return template.HTML(s)
+}
+
+// dateFormat formats a time.Time or a date string with a Go time layout.
+func dateFormat(layout string, date interface{}) (string, error) {
+	t, err := parseDate(date)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}
+
+// truncate shortens s to at most n characters, ending it with an ellipsis
+// when something was cut.
+func truncate(n int, s string) string {
+	if n < 0 {
+		n = 0
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimRightFunc(string(runes[:n]), unicode.IsSpace) + "…"
+}
+
+// slugify turns s into a lowercase, URL friendly string.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(config.Transliterate(s)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// jsonDecode parses a JSON string into generic values.
+func jsonDecode(s string) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// dict builds a map from alternating keys and values, which is handy for
+// passing several values to a partial.
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict needs an even number of arguments")
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// seq returns a sequence of integers: "seq last" counts from 1, "seq first
+// last" and "seq first step last" work like the Unix command.
+func seq(args ...int) ([]int, error) {
+	first, step, last := 1, 1, 0
+	switch len(args) {
+	case 1:
+		last = args[0]
+	case 2:
+		first, last = args[0], args[1]
+	case 3:
+		first, step, last = args[0], args[1], args[2]
+	default:
+		return nil, errors.New("seq needs 1 to 3 arguments")
+	}
+	if step == 0 {
+		return nil, errors.New("seq step can't be zero")
+	}
+	if first > last && step > 0 {
+		step = -step
+	}
+	var s []int
+	for i := first; (step > 0 && i <= last) || (step < 0 && i >= last); i += step {
+		s = append(s, i)
+	}
+	return s, nil
+}
+
+// sortList returns a sorted copy of a slice or the values of a map. An
+// optional key sorts by a map key or struct field, and a final "desc"
+// reverses the order.
+func sortList(list interface{}, args ...string) (interface{}, error) {
+	v := reflect.ValueOf(list)
+	var items []reflect.Value
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, v.Index(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			items = append(items, v.MapIndex(k))
+		}
+	case reflect.Invalid:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("can't sort %s", v.Kind())
+	}
+
+	key := ""
+	desc := false
+	for _, a := range args {
+		if strings.EqualFold(a, "desc") {
+			desc = true
+		} else if !strings.EqualFold(a, "asc") {
+			key = a
+		}
+	}
+
+	sortKeys := make([]reflect.Value, len(items))
+	for i, item := range items {
+		sortKeys[i] = sortField(item, key)
+	}
+	idx := make([]int, len(items))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		if desc {
+			return lessValue(sortKeys[idx[b]], sortKeys[idx[a]])
+		}
+		return lessValue(sortKeys[idx[a]], sortKeys[idx[b]])
+	})
+
+	sorted := make([]interface{}, len(items))
+	for i, j := range idx {
+		sorted[i] = items[j].Interface()
+	}
+	return sorted, nil
+}
+
+// sortField resolves key on a map or struct value. An empty key sorts by the
+// value itself.
+func sortField(v reflect.Value, key string) reflect.Value {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return v
+		}
+		v = v.Elem()
+	}
+	if key == "" {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		k := reflect.ValueOf(key)
+		if k.Type().AssignableTo(v.Type().Key()) {
+			return sortField(v.MapIndex(k), "")
+		}
+	case reflect.Struct:
+		// Unexported fields can't be compared by value
+		if sf, exist := v.Type().FieldByName(key); exist && sf.PkgPath == "" {
+			if f := v.FieldByIndex(sf.Index); f.CanInterface() {
+				return sortField(f, "")
+			}
+		}
+	}
+	return reflect.Value{}
+}
+
+// lessValue orders numbers, strings and times. Invalid values sort first.
+func lessValue(a, b reflect.Value) bool {
+	for a.Kind() == reflect.Interface {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Interface {
+		b = b.Elem()
+	}
+	if !a.IsValid() || !b.IsValid() {
+		return !a.IsValid() && b.IsValid()
+	}
+	if ta, ok := a.Interface().(time.Time); ok {
+		if tb, ok := b.Interface().(time.Time); ok {
+			return ta.Before(tb)
+		}
+	}
+	switch {
+	case isNumber(a) && isNumber(b):
+		return toFloat(a) < toFloat(b)
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return a.String() < b.String()
+	}
+	return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+}
+
+func isNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
@@ -0,0 +1,79 @@
+package build
+
+import (
+	"bytes"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const DefaultPagesBranch = "gh-pages"
+const DefaultCommitMessage = "Site update {{.Time.Format \"2006-01-02T15:04:05Z07:00\"}}"
+
+// commitMessageData is passed to commit message templates.
+type commitMessageData struct {
+	Time time.Time
+	// Commit is the short hash of the project HEAD, when it is a git
+	// repository
+	Commit string
+}
+
+// commitMessage renders a commit message template, DefaultCommitMessage
+// when empty.
+func commitMessage(text string) (string, error) {
+	if text == "" {
+		text = DefaultCommitMessage
+	}
+	t, err := template.New("message").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	data := commitMessageData{Time: time.Now()}
+	if out, err := exec.Command("git", "-C", config.InputPath, "rev-parse", "--short", "HEAD").Output(); err == nil {
+		data.Commit = strings.TrimSpace(string(out))
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// generatePagesFiles writes .nojekyll, so files starting with an
+// underscore are published, and CNAME when a domain is configured.
+func generatePagesFiles() error {
+	if config.Config.GitHubPages == nil {
+		return nil
+	}
+	if err := output.Target.WriteFile(filepath.Join(config.Config.Output, ".nojekyll"), nil, 0644); err != nil {
+		return err
+	}
+	if config.Config.GitHubPages.CNAME != "" {
+		return output.Target.WriteFile(filepath.Join(config.Config.Output, "CNAME"), []byte(config.Config.GitHubPages.CNAME+"\n"), 0644)
+	}
+	return nil
+}
+
+// Publish builds the site and pushes the output repository to GitHub Pages.
+func Publish() error {
+	if _, err := Build(CommandOptions()); err != nil {
+		return err
+	}
+	cfg := config.GitHubPages{}
+	if config.Config.GitHubPages != nil {
+		cfg = *config.Config.GitHubPages
+	}
+	if cfg.Branch == "" {
+		cfg.Branch = DefaultPagesBranch
+	}
+	config.InfoLogger.Printf("Publishing %s to %s...\n", config.Config.Output, cfg.Branch)
+	if err := deployGit(config.Deploy{Remote: cfg.Remote, Branch: cfg.Branch, Message: cfg.Message}); err != nil {
+		return err
+	}
+	config.InfoLogger.Println("Done!")
+	return nil
+}
@@ -0,0 +1,349 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template/parse"
+)
+
+// Graph node names start with their kind
+const (
+	PageNode     = "page:"
+	TemplateNode = "template:"
+	DataNode     = "data:"
+)
+
+// GraphFormats are the output formats of the graph command.
+var GraphFormats = []string{"text", "dot"}
+
+type graphOptions struct {
+	Format string
+}
+
+var GraphOptions graphOptions
+
+// depGraph records what the pages of a build are made from: the templates
+// they execute, the templates those include and the data files they read.
+// Data files are found by the .Site.Data and $.Site.Data fields templates
+// use, other ways of reaching them aren't followed.
+type depGraph struct {
+	mu     sync.Mutex
+	shared *template.Template
+	// edges are what each node refers to directly
+	edges map[string]map[string]bool
+	// uses are every template and data file a page was rendered with
+	uses  map[string]map[string]bool
+	files map[string]string
+}
+
+// lastGraph is the dependency graph of the last build.
+var lastGraph *depGraph
+
+func newDepGraph(set *template.Template) *depGraph {
+	g := &depGraph{
+		edges: make(map[string]map[string]bool),
+		uses:  make(map[string]map[string]bool),
+	}
+	g.setTemplates(set)
+	return g
+}
+
+// setTemplates replaces the edges of the shared templates with those of
+// set, keeping what is known about pages.
+func (g *depGraph) setTemplates(set *template.Template) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for node := range g.edges {
+		if strings.HasPrefix(node, TemplateNode) {
+			delete(g.edges, node)
+		}
+	}
+	// Data files may have come and gone too
+	g.files = make(map[string]string)
+	g.shared = set
+	for _, t := range set.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		node := TemplateNode + t.Name()
+		g.edges[node] = make(map[string]bool)
+		g.walk(t.Tree.Root, func(name string) {
+			g.edges[node][TemplateNode+name] = true
+		}, func(file string) {
+			g.edges[node][DataNode+file] = true
+		})
+	}
+}
+
+// pageNodeName names a page by its source path, or by its URL when it was
+// generated.
+func pageNodeName(p *Page) string {
+	if p.source != "" {
+		return PageNode + p.Path
+	}
+	return PageNode + siteURLPath(p.RelPermalink)
+}
+
+// addRender records that p is rendered by executing name in t, its own
+// copy of the shared templates, and returns the node of the page. The
+// templates only the page defines count as part of the page.
+func (g *depGraph) addRender(t *template.Template, name string, p *Page) string {
+	node := pageNodeName(p)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	edges := make(map[string]bool)
+	uses := make(map[string]bool)
+	seen := make(map[string]bool)
+	var visit func(name string, direct bool)
+	visit = func(name string, direct bool) {
+		shared := g.shared.Lookup(name) != nil
+		if shared {
+			uses[TemplateNode+name] = true
+			if direct {
+				edges[TemplateNode+name] = true
+			}
+		}
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		tt := t.Lookup(name)
+		if tt == nil || tt.Tree == nil {
+			return
+		}
+		g.walk(tt.Tree.Root, func(called string) {
+			visit(called, direct && !shared)
+		}, func(file string) {
+			uses[DataNode+file] = true
+			if direct && !shared {
+				edges[DataNode+file] = true
+			}
+		})
+	}
+	visit(name, true)
+	g.edges[node] = edges
+	g.uses[node] = uses
+	return node
+}
+
+// dependsOn reports whether a page was rendered with one of the named
+// templates.
+func (g *depGraph) dependsOn(node string, templates map[string]bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for name := range templates {
+		if g.uses[node][TemplateNode+name] {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls call with the name of every template executed under node and
+// data with the data files read there. The lock must be held.
+func (g *depGraph) walk(node parse.Node, call func(name string), data func(file string)) {
+	field := func(ident []string) {
+		if len(ident) < 3 || ident[0] != "Site" || ident[1] != "Data" {
+			return
+		}
+		if file := g.dataFile(ident[2:]); file != "" {
+			data(file)
+		}
+	}
+	var walk func(parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			call(n.Name)
+			walk(n.Pipe)
+		case *parse.FieldNode:
+			field(n.Ident)
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				field(n.Ident[1:])
+			}
+		}
+	}
+	walk(node)
+}
+
+// dataFile maps the keys after .Site.Data to the file or directory they
+// were read from, relative to the project directory, or returns an empty
+// string if there is none. The lock must be held.
+func (g *depGraph) dataFile(keys []string) string {
+	id := strings.Join(keys, ".")
+	if file, exist := g.files[id]; exist {
+		return file
+	}
+	file := ""
+	dir := filepath.Join(config.InputPath, config.DataDirName)
+	for i, key := range keys {
+		p := filepath.Join(dir, key)
+		if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+			dir = p
+			if i == len(keys)-1 {
+				file = p
+			}
+			continue
+		}
+		for _, ext := range config.ConfigExts {
+			if _, err := os.Stat(p + ext); err == nil {
+				file = p + ext
+				break
+			}
+		}
+		break
+	}
+	if file != "" {
+		if rel, err := filepath.Rel(config.InputPath, file); err == nil {
+			file = filepath.ToSlash(rel)
+		}
+	}
+	g.files[id] = file
+	return file
+}
+
+// subgraph returns the nodes reachable from the pages named by the
+// arguments, matched by source path or URL, or every node without any.
+func (g *depGraph) subgraph(pages []string) (map[string]bool, error) {
+	nodes := make(map[string]bool)
+	var add func(string)
+	add = func(node string) {
+		if nodes[node] {
+			return
+		}
+		nodes[node] = true
+		for next := range g.edges[node] {
+			add(next)
+		}
+	}
+	if len(pages) == 0 {
+		for node := range g.edges {
+			add(node)
+		}
+		return nodes, nil
+	}
+	for _, page := range pages {
+		node := PageNode + strings.TrimPrefix(filepath.ToSlash(page), config.SourceDirName+"/")
+		if _, exist := g.edges[node]; !exist {
+			return nil, fmt.Errorf("No page %s in the site", page)
+		}
+		add(node)
+	}
+	return nodes, nil
+}
+
+func sortedNodes(set map[string]bool) []string {
+	nodes := make([]string, 0, len(set))
+	for node := range set {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// writeText prints every page with what it depends on as an indented tree.
+func (g *depGraph) writeText(w io.Writer, nodes map[string]bool) {
+	var print func(node string, depth int, path map[string]bool)
+	print = func(node string, depth int, path map[string]bool) {
+		kind := node[:strings.Index(node, ":")]
+		fmt.Fprintf(w, "%s%s %s\n", strings.Repeat("  ", depth), kind, node[len(kind)+1:])
+		// Templates can include each other
+		if path[node] {
+			return
+		}
+		path[node] = true
+		for _, next := range sortedNodes(g.edges[node]) {
+			print(next, depth+1, path)
+		}
+		delete(path, node)
+	}
+	for _, node := range sortedNodes(nodes) {
+		if strings.HasPrefix(node, PageNode) {
+			print(node, 0, make(map[string]bool))
+		}
+	}
+}
+
+// writeDot prints the graph in the Graphviz dot language.
+func (g *depGraph) writeDot(w io.Writer, nodes map[string]bool) {
+	shapes := map[string]string{PageNode: "box", TemplateNode: "ellipse", DataNode: "note"}
+	fmt.Fprintln(w, "digraph siteware {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	for _, node := range sortedNodes(nodes) {
+		i := strings.Index(node, ":") + 1
+		fmt.Fprintf(w, "\t%q [label=%q, shape=%s];\n", node, node[i:], shapes[node[:i]])
+	}
+	for _, node := range sortedNodes(nodes) {
+		for _, next := range sortedNodes(g.edges[node]) {
+			fmt.Fprintf(w, "\t%q -> %q;\n", node, next)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// Graph renders the site in memory and prints the dependencies of its
+// pages, or of the pages given as arguments.
+func Graph(args []string) error {
+	if !config.ContainsFold(GraphFormats, GraphOptions.Format) {
+		return fmt.Errorf("Unknown format %s, use one of %s", GraphOptions.Format, strings.Join(GraphFormats, ", "))
+	}
+	if err := config.Load(); err != nil {
+		return err
+	}
+	output.Target = output.NewMemFS()
+	defer func() { output.Target = output.OSFS{} }()
+	if err := GenerateHTML(); err != nil {
+		return fmt.Errorf("Error generating HTML:\n%v", err)
+	}
+	nodes, err := lastGraph.subgraph(args)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(GraphOptions.Format, "dot") {
+		lastGraph.writeDot(os.Stdout, nodes)
+	} else {
+		lastGraph.writeText(os.Stdout, nodes)
+	}
+	return nil
+}
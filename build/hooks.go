@@ -0,0 +1,29 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"runtime"
+)
+
+// runHooks runs hooks in order, stopping at the first failure that isn't
+// ignored.
+func runHooks(stage string, hooks []config.Hook) error {
+	env := []string{"SITEWARE_SOURCE=" + config.InputPath, "SITEWARE_OUTPUT=" + config.Config.Output}
+	for _, hook := range hooks {
+		config.InfoLogger.Printf("Running %s hook: %s\n", stage, hook.Command)
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+		if err := config.Run(config.InputPath, env, shell, flag, hook.Command); err != nil {
+			if hook.IgnoreError {
+				output.Report.Warn(fmt.Sprintf("%s hook: %v", stage, err))
+				continue
+			}
+			return fmt.Errorf("Error running %s hook: %v", stage, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const RedirectsFileName = "_redirects"
+const VercelFileName = "vercel.json"
+
+// Hosts maps the values of config.Hosts to the files they get.
+var Hosts = map[string]func() error{
+	"netlify": writeNetlifyFiles,
+	"vercel":  writeVercelFile,
+}
+
+// generateHostFiles writes the deployment files of the configured hosts.
+func generateHostFiles() error {
+	for _, host := range config.Config.Hosts {
+		write, exist := Hosts[strings.ToLower(host)]
+		if !exist {
+			return fmt.Errorf("unknown host %q", host)
+		}
+		if err := write(); err != nil {
+			return fmt.Errorf("%s: %v", host, err)
+		}
+	}
+	return nil
+}
+
+// HeaderPatterns returns the patterns of config.Headers in a stable order.
+func HeaderPatterns() []string {
+	patterns := make([]string, 0, len(config.Config.Headers))
+	for pattern := range config.Config.Headers {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+func sortedHeaderNames(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeNetlifyFiles() error {
+	if rules := redirectRules(); len(rules) > 0 {
+		var buf bytes.Buffer
+		for _, r := range rules {
+			fmt.Fprintf(&buf, "%s %s %d\n", r.From, r.To, r.StatusCode())
+		}
+		if err := output.Target.WriteFile(filepath.Join(config.Config.Output, RedirectsFileName), buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	if len(config.Config.Headers) > 0 {
+		var buf bytes.Buffer
+		for _, pattern := range HeaderPatterns() {
+			fmt.Fprintln(&buf, pattern)
+			headers := config.Config.Headers[pattern]
+			for _, name := range sortedHeaderNames(headers) {
+				fmt.Fprintf(&buf, "  %s: %s\n", name, headers[name])
+			}
+		}
+		if err := output.Target.WriteFile(filepath.Join(config.Config.Output, HeadersFileName), buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vercelSource turns a pattern with a trailing * into the path-to-regexp
+// syntax of Vercel, naming the rest of the path splat.
+func vercelSource(pattern string) string {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.TrimSuffix(pattern, "*") + ":splat*"
+	}
+	return pattern
+}
+
+func writeVercelFile() error {
+	type header struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	type headerRoute struct {
+		Source  string   `json:"source"`
+		Headers []header `json:"headers"`
+	}
+	type redirect struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+		StatusCode  int    `json:"statusCode"`
+	}
+	var cfg struct {
+		Redirects []redirect    `json:"redirects,omitempty"`
+		Headers   []headerRoute `json:"headers,omitempty"`
+	}
+	for _, r := range redirectRules() {
+		cfg.Redirects = append(cfg.Redirects, redirect{vercelSource(r.From), r.To, r.StatusCode()})
+	}
+	for _, pattern := range HeaderPatterns() {
+		route := headerRoute{Source: vercelSource(pattern)}
+		headers := config.Config.Headers[pattern]
+		for _, name := range sortedHeaderNames(headers) {
+			route.Headers = append(route.Headers, header{name, headers[name]})
+		}
+		cfg.Headers = append(cfg.Headers, route)
+	}
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return output.Target.WriteFile(filepath.Join(config.Config.Output, VercelFileName), append(b, '\n'), 0644)
+}
+
+// Redirect finds the redirect rule for a URL path and returns where it
+// leads.
+func Redirect(p string) (string, int, bool) {
+	for _, r := range redirectRules() {
+		if !MatchURLPattern(r.From, p) {
+			continue
+		}
+		to := r.To
+		if strings.HasSuffix(r.From, "*") {
+			to = strings.Replace(to, ":splat", strings.TrimPrefix(p, strings.TrimSuffix(r.From, "*")), -1)
+		}
+		return to, r.StatusCode(), true
+	}
+	return "", 0, false
+}
+
+// HeadersFileName is a Netlify style headers file in the served directory.
+const HeadersFileName = "_headers"
+
+// MatchURLPattern matches a URL path against a pattern, where a trailing *
+// matches any rest of the path and other wildcards work like path.Match.
+func MatchURLPattern(pattern, p string) bool {
+	if strings.HasSuffix(pattern, "*") && !strings.ContainsAny(strings.TrimSuffix(pattern, "*"), "*?[") {
+		return strings.HasPrefix(p, strings.TrimSuffix(pattern, "*"))
+	}
+	match, _ := path.Match(pattern, p)
+	return match
+}
@@ -0,0 +1,54 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"html/template"
+)
+
+// swappedTemplates limits a build to the pages using one of the named
+// templates. The watcher sets it while swapping in edited templates, so
+// pages that don't use them aren't rendered again.
+var swappedTemplates map[string]bool
+
+// lastTemplates is the shared template set of the last successful build,
+// before pages added their own definitions to their copies.
+var lastTemplates *template.Template
+
+// SwapTemplates reloads the templates and renders the pages the dependency
+// graph shows using those that changed since the last build. Everything
+// else in the output is left as it is.
+func SwapTemplates() error {
+	if lastTemplates == nil {
+		return GenerateHTML()
+	}
+	templates, err := loadTemplates()
+	if err != nil {
+		return err
+	}
+	changed := changedTemplates(lastTemplates, templates)
+	if len(changed) == 0 {
+		config.DebugLogger.Println("No template changed")
+		return nil
+	}
+	swappedTemplates = changed
+	defer func() { swappedTemplates = nil }()
+	return GenerateHTML()
+}
+
+// changedTemplates compares two template sets, returning the names of the
+// templates added, removed or parsed differently.
+func changedTemplates(old, new *template.Template) map[string]bool {
+	changed := make(map[string]bool)
+	for _, t := range new.Templates() {
+		o := old.Lookup(t.Name())
+		if o == nil || o.Tree == nil || t.Tree == nil || o.Tree.Root.String() != t.Tree.Root.String() {
+			changed[t.Name()] = true
+		}
+	}
+	for _, o := range old.Templates() {
+		if new.Lookup(o.Name()) == nil {
+			changed[o.Name()] = true
+		}
+	}
+	return changed
+}
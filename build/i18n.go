@@ -0,0 +1,171 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const I18nDirName = "i18n"
+
+// Translations maps language codes to the strings of i18n/<lang>.json.
+var Translations = make(map[string]map[string]string)
+
+// Translation is a version of a page in another language.
+type Translation struct {
+	Lang         string
+	RelPermalink string
+	Permalink    string
+}
+
+// defaultLanguage is the first of the configured languages. Its pages are
+// written to the output root, the others under a directory named after
+// the language.
+func defaultLanguage() string {
+	if len(config.Config.Languages) == 0 {
+		return ""
+	}
+	return config.Config.Languages[0]
+}
+
+func isLanguage(lang string) bool {
+	for _, l := range config.Config.Languages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// pageLanguage detects the language of a page from its slash separated
+// path relative to the source directory, either from a language directory
+// as in fi/about.html or a suffix as in about.fi.html. The key is shared by
+// the translations of a page.
+func pageLanguage(rel string) (lang, key string) {
+	rel = filepath.ToSlash(rel)
+	key = strings.TrimSuffix(rel, path.Ext(rel))
+	if len(config.Config.Languages) == 0 {
+		return "", key
+	}
+	if parts := strings.SplitN(key, "/", 2); len(parts) == 2 && isLanguage(parts[0]) {
+		return parts[0], parts[1]
+	}
+	if suffix := path.Ext(key); suffix != "" && isLanguage(suffix[1:]) {
+		return suffix[1:], strings.TrimSuffix(key, suffix)
+	}
+	return defaultLanguage(), key
+}
+
+// localizePath moves a page with a language suffix to the directory of its
+// language, so about.fi.html is written to fi/about.html.
+func localizePath(rel string) string {
+	rel = filepath.ToSlash(rel)
+	ext := path.Ext(rel)
+	stem := strings.TrimSuffix(rel, ext)
+	suffix := path.Ext(stem)
+	if suffix == "" || !isLanguage(suffix[1:]) {
+		return rel
+	}
+	rel = strings.TrimSuffix(stem, suffix) + ext
+	if lang := suffix[1:]; lang != defaultLanguage() {
+		rel = path.Join(lang, rel)
+	}
+	return rel
+}
+
+// loadTranslations reads the translation file of every language from the
+// i18n directory.
+func loadTranslations() error {
+	translations := make(map[string]map[string]string)
+	files, err := ioutil.ReadDir(filepath.Join(config.InputPath, I18nDirName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !config.ContainsFold(config.ConfigExts, filepath.Ext(fi.Name())) {
+			continue
+		}
+		lang := strings.TrimSuffix(fi.Name(), filepath.Ext(fi.Name()))
+		strs := make(map[string]string)
+		if err := config.DecodeFile(filepath.Join(config.InputPath, I18nDirName, fi.Name()), &strs); err != nil {
+			return err
+		}
+		translations[lang] = strs
+	}
+	Translations = translations
+	return nil
+}
+
+// translate looks key up in the strings of lang, then in those of the
+// default language, and falls back to the key itself. Arguments are
+// formatted into the string like with printf.
+func translate(lang, key string, args ...interface{}) string {
+	s, ok := Translations[lang][key]
+	if !ok {
+		if s, ok = Translations[defaultLanguage()][key]; !ok {
+			s = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(s, args...)
+	}
+	return s
+}
+
+// T is the translate template function of pages in the default language.
+// Other pages get their own through bindFuncs.
+func T(key string, args ...interface{}) string {
+	return translate(defaultLanguage(), key, args...)
+}
+
+// scanTranslations finds the pages of every language, mapping translation
+// keys to the output paths of the page in each language.
+func scanTranslations() (map[string]map[string]string, error) {
+	pages := make(map[string]map[string]string)
+	if len(config.Config.Languages) == 0 {
+		return pages, nil
+	}
+	root := filepath.Join(config.InputPath, config.SourceDirName)
+	err := config.WalkSource(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !config.IsContent(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		lang, key := pageLanguage(rel)
+		if pages[key] == nil {
+			pages[key] = make(map[string]string)
+		}
+		pages[key][lang] = pageOutputPath(rel)
+		return nil
+	})
+	return pages, err
+}
+
+// pageTranslations lists the other language versions of a page.
+func pageTranslations(site *Site, lang, key string) []Translation {
+	var list []Translation
+	for l, out := range site.translations[key] {
+		if l == lang {
+			continue
+		}
+		rel, abs := pageURLs(out)
+		list = append(list, Translation{
+			Lang:         l,
+			RelPermalink: rel,
+			Permalink:    abs,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Lang < list[j].Lang })
+	return list
+}
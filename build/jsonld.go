@@ -0,0 +1,139 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"html/template"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SchemaTypes maps the schema.org types jsonld supports to their builders.
+var SchemaTypes = map[string]func(p *Page) map[string]interface{}{
+	"Article":        articleSchema,
+	"BreadcrumbList": breadcrumbSchema,
+	"ImageGallery":   gallerySchema,
+}
+
+// jsonld renders JSON-LD script blocks for a page, of the types given or
+// else of the Schema setting of the page, e.g. {{jsonld .}} or
+// {{jsonld . "BreadcrumbList"}}.
+func jsonld(p *Page, types ...string) (template.HTML, error) {
+	if len(types) == 0 {
+		types = p.Schema
+	}
+	var buf bytes.Buffer
+	for _, name := range types {
+		schema, exist := SchemaTypes[name]
+		if !exist {
+			return "", fmt.Errorf("unknown schema type %q", name)
+		}
+		data := schema(p)
+		data["@context"] = "https://schema.org"
+		data["@type"] = name
+		// Marshal escapes <, > and &, so the script can't be closed early
+		b, err := json.Marshal(data)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&buf, "<script type=\"application/ld+json\">%s</script>\n", b)
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// pageString returns a string of the page data, or an empty string.
+func pageString(p *Page, key string) string {
+	m, _ := p.Data.(map[string]interface{})
+	v, _ := frontMatterValue(m, key)
+	s, _ := v.(string)
+	return s
+}
+
+func articleSchema(p *Page) map[string]interface{} {
+	data := map[string]interface{}{
+		"headline": p.Title,
+		"url":      p.Permalink,
+	}
+	if p.Summary != "" {
+		data["description"] = p.Summary
+	}
+	if !p.Date.IsZero() {
+		data["datePublished"] = p.Date.Format(time.RFC3339)
+	}
+	if !p.SourceModTime.IsZero() {
+		data["dateModified"] = p.SourceModTime.Format(time.RFC3339)
+	}
+	if p.Image != "" {
+		data["image"] = ogImageURL(p.Image)
+	}
+	if p.Lang != "" {
+		data["inLanguage"] = p.Lang
+	}
+	if author := pageString(p, "Author"); author != "" {
+		data["author"] = map[string]interface{}{"@type": "Person", "name": author}
+	}
+	return data
+}
+
+// breadcrumbSchema lists the index pages of the sections from the root to
+// the page, then the page itself.
+func breadcrumbSchema(p *Page) map[string]interface{} {
+	var items []interface{}
+	add := func(title, url string) {
+		items = append(items, map[string]interface{}{
+			"@type":    "ListItem",
+			"position": len(items) + 1,
+			"name":     title,
+			"item":     url,
+		})
+	}
+	for _, c := range breadcrumbs(p) {
+		if c.Page != nil {
+			add(c.Title, c.Page.Permalink)
+		}
+	}
+	add(p.Title, p.Permalink)
+	return map[string]interface{}{"itemListElement": items}
+}
+
+// gallerySchema lists the images of the directory named by the Gallery
+// key of the page data, relative to the project directory.
+func gallerySchema(p *Page) map[string]interface{} {
+	data := map[string]interface{}{
+		"name": p.Title,
+		"url":  p.Permalink,
+	}
+	dir := path.Clean(strings.TrimPrefix(pageString(p, "Gallery"), "/"))
+	if dir == "." {
+		return data
+	}
+	files, err := ioutil.ReadDir(filepath.Join(config.InputPath, filepath.FromSlash(dir)))
+	if err != nil {
+		return data
+	}
+	derivatives, _ := assets.ImageDerivatives()
+	thumbCfg, hasThumbs := derivatives[strings.TrimPrefix(dir, config.StaticDirName+"/")][config.Config.ThumbDirName()]
+	var images []interface{}
+	for _, fi := range files {
+		if fi.IsDir() || !assets.IsImage(fi.Name()) {
+			continue
+		}
+		rel := path.Join(dir, fi.Name())
+		img := map[string]interface{}{
+			"@type":      "ImageObject",
+			"contentUrl": config.AbsURL(config.OutputName(rel)),
+		}
+		if hasThumbs {
+			img["thumbnailUrl"] = config.AbsURL(assets.DerivativePath(rel, config.Config.ThumbDirName(), thumbCfg))
+		}
+		images = append(images, img)
+	}
+	data["associatedMedia"] = images
+	return data
+}
@@ -0,0 +1,213 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// refRe matches the attributes of built pages that reference URLs
+	refRe = regexp.MustCompile(`(?i)\s(href|src|srcset|poster)\s*=\s*["']([^"']*)["']`)
+	idRe  = regexp.MustCompile(`(?i)\s(?:id|name)\s*=\s*["']([^"']+)["']`)
+)
+
+// brokenLink is a reference in a built page that leads nowhere.
+type brokenLink struct {
+	Page   string
+	Target string
+	Msg    string
+}
+
+func (l brokenLink) String() string {
+	return fmt.Sprintf("%s: %s: %s", l.Page, l.Target, l.Msg)
+}
+
+// CheckLinks crawls the output directory and reports internal links, images
+// and anchors that don't resolve, and outbound links that fail when checking
+// external links.
+func CheckLinks() error {
+	if err := config.Load(); err != nil {
+		return err
+	}
+	if config.Config.Output == "" {
+		return errors.New("Output directory unset in configuration")
+	}
+	pages, err := crawlOutput(config.Config.Output)
+	if err != nil {
+		return fmt.Errorf("Error reading output directory: %v", err)
+	}
+	broken := brokenInternalLinks(pages)
+	if LinkCheckOptions.External || (config.Config.LinkCheck != nil && config.Config.LinkCheck.External) {
+		external, err := brokenExternalLinks(pages)
+		if err != nil {
+			return err
+		}
+		broken = append(broken, external...)
+	}
+	for _, l := range broken {
+		config.ErrorLogger.Println(l)
+	}
+	if len(broken) > 0 {
+		return fmt.Errorf("%d broken links found", len(broken))
+	}
+	config.InfoLogger.Printf("No broken links in %d pages\n", len(pages))
+	return nil
+}
+
+// crawledPage is a built page and what it references.
+type crawledPage struct {
+	// URL is the site path the page is served at
+	URL  string
+	Refs []string
+	IDs  map[string]bool
+}
+
+// crawlOutput reads every HTML file under root, keyed by its path
+// relative to root.
+func crawlOutput(root string) (map[string]*crawledPage, error) {
+	pages := make(map[string]*crawledPage)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if config.ContainsFold(output.VCSDirNames, info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !config.IsHTML(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		page := &crawledPage{URL: path.Join("/", filepath.ToSlash(rel)), IDs: make(map[string]bool)}
+		for _, m := range refRe.FindAllStringSubmatch(string(body), -1) {
+			if strings.EqualFold(m[1], "srcset") {
+				// Candidates are URLs followed by an optional descriptor
+				for _, c := range strings.Split(m[2], ",") {
+					if fields := strings.Fields(c); len(fields) > 0 {
+						page.Refs = append(page.Refs, fields[0])
+					}
+				}
+				continue
+			}
+			page.Refs = append(page.Refs, m[2])
+		}
+		for _, m := range idRe.FindAllStringSubmatch(string(body), -1) {
+			page.IDs[m[1]] = true
+		}
+		pages[filepath.ToSlash(rel)] = page
+		return nil
+	})
+	return pages, err
+}
+
+// sitePath returns the site path of a reference, without the base path,
+// or false for references outside the site.
+func sitePath(page *crawledPage, ref string) (*url.URL, string, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return nil, "", false
+	}
+	base, _ := url.Parse(config.Config.BaseURL)
+	prefix := "/"
+	if base != nil && base.Path != "" {
+		prefix = base.Path
+	}
+	if u.Scheme != "" || u.Host != "" {
+		if base == nil || base.Host == "" || !strings.EqualFold(u.Host, base.Host) {
+			return u, "", false
+		}
+	}
+	p := u.Path
+	switch {
+	case p == "":
+		return u, page.URL, true
+	case strings.HasPrefix(p, "/"):
+		if !strings.HasPrefix(p, prefix) && p+"/" != prefix {
+			// Outside the base path, so not served by this site
+			return u, "", false
+		}
+		p = "/" + strings.TrimPrefix(p, prefix)
+	default:
+		p = path.Join(path.Dir(page.URL), p)
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return u, cleaned, true
+}
+
+// resolveOutput finds the file serving a site path, relative to the output
+// directory.
+func resolveOutput(pages map[string]*crawledPage, p string) (string, string) {
+	rel := strings.TrimPrefix(p, "/")
+	if strings.HasSuffix(p, "/") {
+		rel = path.Join(rel, "index.html")
+	}
+	if _, crawled := pages[rel]; crawled {
+		return rel, ""
+	}
+	fi, err := os.Stat(filepath.Join(config.Config.Output, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", "not found"
+	}
+	if fi.IsDir() {
+		index := path.Join(rel, "index.html")
+		if _, crawled := pages[index]; crawled {
+			return index, ""
+		}
+		return "", "directory without index.html"
+	}
+	return rel, ""
+}
+
+// brokenInternalLinks resolves the references of the crawled pages against
+// the output directory and the redirect rules.
+func brokenInternalLinks(pages map[string]*crawledPage) []brokenLink {
+	var broken []brokenLink
+	for rel, page := range pages {
+		for _, ref := range page.Refs {
+			u, p, internal := sitePath(page, ref)
+			if !internal {
+				continue
+			}
+			if _, _, exist := Redirect(p); exist {
+				continue
+			}
+			target, msg := resolveOutput(pages, p)
+			if msg != "" {
+				broken = append(broken, brokenLink{Page: rel, Target: ref, Msg: msg})
+				continue
+			}
+			if targetPage := pages[target]; u.Fragment != "" && targetPage != nil && !targetPage.IDs[u.Fragment] {
+				broken = append(broken, brokenLink{Page: rel, Target: ref, Msg: "missing anchor"})
+			}
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		if broken[i].Page != broken[j].Page {
+			return broken[i].Page < broken[j].Page
+		}
+		return broken[i].Target < broken[j].Target
+	})
+	return broken
+}
@@ -0,0 +1,137 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// manifest maps the paths of the output files, slash separated and
+// relative to the output directory, to the SHA-256 of their content.
+type manifest map[string]string
+
+// outputManifest hashes every file of the output directory. Version
+// control directories kept there are left out.
+func outputManifest() (manifest, error) {
+	m := make(manifest)
+	var mu sync.Mutex
+	pool := output.NewWorkerPool(config.Config.Concurrency)
+	walkErr := output.Target.Walk(config.Config.Output, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(config.Config.Output, path)
+		if err != nil {
+			return err
+		}
+		pool.Submit(func() error {
+			f, err := output.Target.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			h := sha256.New()
+			if _, err := io.Copy(h, f); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			mu.Lock()
+			m[filepath.ToSlash(rel)] = hex.EncodeToString(h.Sum(nil))
+			mu.Unlock()
+			return nil
+		})
+		return nil
+	})
+	poolErr := pool.Wait()
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	if poolErr != nil {
+		return nil, poolErr
+	}
+	return m, nil
+}
+
+func (m manifest) Write(path string) error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+func readManifest(path string) (manifest, error) {
+	var m manifest
+	if err := config.DecodeFile(path, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Diff compares the output against an earlier manifest, or two manifests
+// with each other, and prints a line per file added (A), changed (M) or
+// removed (D), e.g. for a deploy script to upload only what changed.
+func Diff(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("Please provide the manifest to compare with")
+	}
+	old, err := readManifest(args[0])
+	if err != nil {
+		return err
+	}
+	var cur manifest
+	if len(args) == 2 {
+		if cur, err = readManifest(args[1]); err != nil {
+			return err
+		}
+	} else {
+		if err := config.Load(); err != nil {
+			return err
+		}
+		if config.Config.Output == "" {
+			return errors.New("Output directory unset in configuration")
+		}
+		if cur, err = outputManifest(); err != nil {
+			return fmt.Errorf("Error hashing output: %v", err)
+		}
+	}
+
+	status := make(map[string]string)
+	for path, hash := range cur {
+		if oldHash, exist := old[path]; !exist {
+			status[path] = "A"
+		} else if oldHash != hash {
+			status[path] = "M"
+		}
+	}
+	for path := range old {
+		if _, exist := cur[path]; !exist {
+			status[path] = "D"
+		}
+	}
+	paths := make([]string, 0, len(status))
+	for path := range status {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	// Like git diff --name-status
+	for _, path := range paths {
+		fmt.Printf("%s\t%s\n", status[path], path)
+	}
+	return nil
+}
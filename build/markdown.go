@@ -0,0 +1,233 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/Varjelus/siteware/config"
+	"github.com/russross/blackfriday"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var yamlDelim = []byte("---")
+var tomlDelim = []byte("+++")
+
+// splitFrontMatter separates an optional front matter block from the body of
+// a source file. YAML front matter is fenced with "---", TOML with "+++" and
+// JSON front matter is a single object at the very start of the file. Bodies
+// starting with something else in braces, like a shortcode or a template
+// action, have no front matter.
+func splitFrontMatter(src []byte) (map[string]interface{}, []byte, error) {
+	fm := make(map[string]interface{})
+	trimmed := bytes.TrimLeft(src, "\r\n\t ")
+
+	switch {
+	case bytes.HasPrefix(trimmed, yamlDelim):
+		head, body, err := cutFence(trimmed, yamlDelim)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := yaml.Unmarshal(head, &fm); err != nil {
+			return nil, nil, err
+		}
+		config.JSONCompatible(fm)
+		return fm, body, nil
+	case bytes.HasPrefix(trimmed, tomlDelim):
+		head, body, err := cutFence(trimmed, tomlDelim)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := toml.Unmarshal(head, &fm); err != nil {
+			return nil, nil, err
+		}
+		return fm, body, nil
+	case isJSONObject(trimmed):
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		if err := dec.Decode(&fm); err != nil {
+			return make(map[string]interface{}), src, nil
+		}
+		return fm, trimmed[dec.InputOffset():], nil
+	}
+
+	return fm, src, nil
+}
+
+// isJSONObject reports whether b starts like a JSON object, a brace followed
+// by a key or by the closing brace.
+func isJSONObject(b []byte) bool {
+	if !bytes.HasPrefix(b, []byte("{")) {
+		return false
+	}
+	rest := bytes.TrimLeft(b[1:], "\r\n\t ")
+	return bytes.HasPrefix(rest, []byte(`"`)) || bytes.HasPrefix(rest, []byte("}"))
+}
+
+// splitHTMLFrontMatter separates front matter from an HTML page. Besides
+// "---" and "+++" fences it can be a YAML or JSON comment at the very start
+// of the file, which keeps the file valid HTML:
+//
+//	<!--
+//	Title: About us
+//	Template: page.template
+//	-->
+//
+// Comments that don't hold a mapping are left alone.
+func splitHTMLFrontMatter(src []byte) (map[string]interface{}, []byte, error) {
+	trimmed := bytes.TrimLeft(src, "\r\n\t ")
+	switch {
+	case bytes.HasPrefix(trimmed, yamlDelim), bytes.HasPrefix(trimmed, tomlDelim):
+		return splitFrontMatter(src)
+	case bytes.HasPrefix(trimmed, []byte("<!--")):
+		end := bytes.Index(trimmed, []byte("-->"))
+		if end < 0 {
+			break
+		}
+		var fm map[string]interface{}
+		if err := yaml.Unmarshal(trimmed[len("<!--"):end], &fm); err != nil || len(fm) == 0 {
+			break
+		}
+		config.JSONCompatible(fm)
+		return fm, trimmed[end+len("-->"):], nil
+	}
+	return make(map[string]interface{}), src, nil
+}
+
+// applyFrontMatter overrides directory config settings of a page with the
+// front matter keys of the same name.
+func applyFrontMatter(fcfg config.File, fm map[string]interface{}) (config.File, error) {
+	if v, ok := frontMatterValue(fm, "Template"); ok {
+		s, ok := v.(string)
+		if !ok {
+			return fcfg, errors.New("Template must be a string")
+		}
+		fcfg.Template = s
+	}
+	if v, ok := frontMatterValue(fm, "Draft"); ok {
+		fcfg.Draft = v == true
+	}
+	if v, ok := frontMatterValue(fm, "PublishDate"); ok {
+		d, err := parseDate(v)
+		if err != nil {
+			return fcfg, err
+		}
+		fcfg.PublishDate = d
+	}
+	if v, ok := frontMatterValue(fm, "Schema"); ok {
+		fcfg.Schema = stringList(v)
+	}
+	if v, ok := frontMatterValue(fm, "Password"); ok {
+		s, ok := v.(string)
+		if !ok {
+			return fcfg, errors.New("Password must be a string")
+		}
+		fcfg.Password = s
+	}
+	if v, ok := frontMatterValue(fm, "Aliases"); ok {
+		fcfg.Aliases = stringList(v)
+	}
+	if v, ok := frontMatterValue(fm, "Paginate"); ok {
+		n := reflect.ValueOf(v)
+		if !isNumber(n) {
+			return fcfg, errors.New("Paginate must be a number")
+		}
+		fcfg.Paginate = int(toFloat(n))
+	}
+	return fcfg, nil
+}
+
+// cutFence returns the text between the opening and closing delimiter lines
+// and everything after the closing one.
+func cutFence(src []byte, delim []byte) ([]byte, []byte, error) {
+	rest := src[len(delim):]
+	nl := bytes.IndexByte(rest, '\n')
+	if nl < 0 {
+		return nil, nil, errors.New("unterminated front matter")
+	}
+	rest = rest[nl+1:]
+
+	closing := append([]byte("\n"), delim...)
+	var head []byte
+	if bytes.HasPrefix(rest, delim) {
+		// Empty front matter
+		head, rest = nil, rest[len(delim):]
+	} else {
+		end := bytes.Index(rest, closing)
+		if end < 0 {
+			return nil, nil, errors.New("unterminated front matter")
+		}
+		head, rest = rest[:end], rest[end+len(closing):]
+	}
+
+	// Drop the remainder of the closing delimiter line
+	if nl := bytes.IndexByte(rest, '\n'); nl >= 0 {
+		rest = rest[nl+1:]
+	} else {
+		rest = nil
+	}
+	return head, rest, nil
+}
+
+// frontMatterValue looks up a front matter key case-insensitively.
+func frontMatterValue(fm map[string]interface{}, key string) (interface{}, bool) {
+	for k, v := range fm {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// parseDate accepts the date representations the front matter decoders
+// produce: TOML gives time.Time while YAML and JSON give strings.
+func parseDate(v interface{}) (time.Time, error) {
+	switch d := v.(type) {
+	case time.Time:
+		return d, nil
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, d); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("can't parse date %q", d)
+	case nil:
+		return time.Time{}, nil
+	}
+	return time.Time{}, fmt.Errorf("can't parse date %v", v)
+}
+
+// renderMarkdown converts Markdown source into HTML.
+func renderMarkdown(src []byte) []byte {
+	return blackfriday.MarkdownCommon(src)
+}
+
+// mergeData combines the Data from a directory config with values read from
+// front matter. Front matter wins when both define the same key.
+func mergeData(data interface{}, fm map[string]interface{}) interface{} {
+	if len(fm) == 0 {
+		return data
+	}
+	base, ok := data.(map[string]interface{})
+	if !ok {
+		if data != nil {
+			// Data is not a map, keep it reachable next to front matter
+			if _, exist := fm["Data"]; !exist {
+				fm["Data"] = data
+			}
+		}
+		return fm
+	}
+	merged := make(map[string]interface{}, len(base)+len(fm))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range fm {
+		merged[k] = v
+	}
+	return merged
+}
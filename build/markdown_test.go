@@ -0,0 +1,33 @@
+package build
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	cases := []struct {
+		src  string
+		fm   map[string]interface{}
+		body string
+	}{
+		{"{\"Title\": \"Post\"}\nText", map[string]interface{}{"Title": "Post"}, "\nText"},
+		{"\n{\n  \"Title\": \"Post\"\n}\nText", map[string]interface{}{"Title": "Post"}, "\nText"},
+		{"{}\nText", map[string]interface{}{}, "\nText"},
+		// Braces that don't open a JSON object are content
+		{"{{< youtube abc >}}\nText", map[string]interface{}{}, "{{< youtube abc >}}\nText"},
+		{"{{ .Title }}\nText", map[string]interface{}{}, "{{ .Title }}\nText"},
+		{"{\"Title\": }\nText", map[string]interface{}{}, "{\"Title\": }\nText"},
+		{"Text", map[string]interface{}{}, "Text"},
+	}
+	for _, c := range cases {
+		fm, body, err := splitFrontMatter([]byte(c.src))
+		if err != nil {
+			t.Errorf("splitFrontMatter(%q): %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(fm, c.fm) || string(body) != c.body {
+			t.Errorf("splitFrontMatter(%q) = %v, %q, want %v, %q", c.src, fm, body, c.fm, c.body)
+		}
+	}
+}
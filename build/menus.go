@@ -0,0 +1,143 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"sort"
+	"strings"
+)
+
+// menuEntry is a link of a navigation menu. Entries are set in Menus of
+// the configuration, nested with Children or Parent, and by pages whose
+// front matter sets Menu to a menu name, a list of them, or a map of menu
+// names to entries without URL, e.g.
+//
+//	Menu:
+//	  main:
+//	    Weight: 2
+//	    Parent: About
+type menuEntry struct {
+	Name string
+	URL  string
+	// Weight orders the entries, lightest first, then by Name
+	Weight int
+	// Parent names the entry this one is nested under
+	Parent   string
+	Children []*menuEntry
+	// Page is set for entries added by pages
+	Page *Page `json:"-"`
+}
+
+// IsActive reports whether the entry or one of its children links to p.
+func (e *menuEntry) IsActive(p *Page) bool {
+	if p != nil && e.URL == p.RelPermalink {
+		return true
+	}
+	for _, c := range e.Children {
+		if c.IsActive(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// pageMenus reads the Menu front matter of a page into the entries it adds
+// by menu name.
+func pageMenus(p *Page) (map[string]*menuEntry, error) {
+	m, _ := p.Data.(map[string]interface{})
+	v, ok := frontMatterValue(m, "Menu")
+	if !ok {
+		return nil, nil
+	}
+	entries := make(map[string]*menuEntry)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, raw := range v {
+			e := &menuEntry{}
+			if raw != nil {
+				if err := config.Convert(raw, e); err != nil {
+					return nil, fmt.Errorf("menu %s: %v", name, err)
+				}
+			}
+			entries[name] = e
+		}
+	default:
+		for _, name := range stringList(v) {
+			entries[name] = &menuEntry{}
+		}
+	}
+	for _, e := range entries {
+		e.Page = p
+		e.URL = p.RelPermalink
+		if e.Name == "" {
+			e.Name = p.Title
+		}
+	}
+	return entries, nil
+}
+
+// buildMenus combines the configured menus with the entries added by pages
+// into the trees exposed as .Site.Menus.
+func buildMenus(pages []*Page) (map[string][]*menuEntry, error) {
+	flat := make(map[string][]*menuEntry)
+	var add func(menu string, entries []*config.Menu, parent string)
+	add = func(menu string, entries []*config.Menu, parent string) {
+		for _, e := range entries {
+			c := &menuEntry{Name: e.Name, URL: e.URL, Weight: e.Weight, Parent: e.Parent}
+			// Configured URLs are site paths, linked like page URLs
+			if c.URL != "" {
+				c.URL = config.RelURL(c.URL)
+			}
+			if parent != "" {
+				c.Parent = parent
+			}
+			flat[menu] = append(flat[menu], c)
+			add(menu, e.Children, c.Name)
+		}
+	}
+	for menu, entries := range config.Config.Menus {
+		add(menu, entries, "")
+	}
+	for _, p := range pages {
+		entries, err := pageMenus(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p.Path, err)
+		}
+		for menu, e := range entries {
+			flat[menu] = append(flat[menu], e)
+		}
+	}
+
+	menus := make(map[string][]*menuEntry, len(flat))
+	for menu, entries := range flat {
+		byName := make(map[string]*menuEntry, len(entries))
+		for _, e := range entries {
+			byName[e.Name] = e
+		}
+		for _, e := range entries {
+			if e.Parent == "" {
+				menus[menu] = append(menus[menu], e)
+			} else if parent, exist := byName[e.Parent]; exist && parent != e {
+				parent.Children = append(parent.Children, e)
+			} else {
+				config.InfoLogger.Printf("Menu %s: no parent %s of %s, adding it at the top\n", menu, e.Parent, e.Name)
+				menus[menu] = append(menus[menu], e)
+			}
+		}
+		sortMenu(menus[menu])
+	}
+	return menus, nil
+}
+
+// sortMenu orders entries and their children by weight, then by name.
+func sortMenu(entries []*menuEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Weight != entries[j].Weight {
+			return entries[i].Weight < entries[j].Weight
+		}
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	for _, e := range entries {
+		sortMenu(e.Children)
+	}
+}
@@ -0,0 +1,72 @@
+package build
+
+import (
+	"sort"
+	"strings"
+)
+
+// PageOrders are the values of the Order setting, "date" being the default.
+var PageOrders = []string{"", "date", "name"}
+
+// NextPage returns the page after p in its directory, or nil for the last.
+// Given a taxonomy name, e.g. .NextPage "series", it navigates the pages
+// sharing the first term of p in that taxonomy instead.
+func (p *Page) NextPage(taxonomy ...string) *Page {
+	return p.neighbour(1, taxonomy)
+}
+
+// PrevPage returns the page before p, the same way NextPage does.
+func (p *Page) PrevPage(taxonomy ...string) *Page {
+	return p.neighbour(-1, taxonomy)
+}
+
+func (p *Page) neighbour(step int, taxonomy []string) *Page {
+	pages := p.siblings(taxonomy)
+	for i, q := range pages {
+		if p.is(q) {
+			if i+step < 0 || i+step >= len(pages) {
+				return nil
+			}
+			return pages[i+step]
+		}
+	}
+	return nil
+}
+
+// siblings lists the pages p is navigated among in reading order: oldest
+// first, or by path with the Order setting "name".
+func (p *Page) siblings(taxonomy []string) []*Page {
+	if p == nil || p.Section == nil {
+		return nil
+	}
+	var pages []*Page
+	if len(taxonomy) == 0 {
+		pages = p.Section.Pages()
+	} else {
+		terms := p.Taxonomies[strings.ToLower(taxonomy[0])]
+		if len(terms) == 0 {
+			return nil
+		}
+		slug := slugify(terms[0])
+		for _, q := range p.Section.index.All() {
+			if q.Kind != "page" {
+				continue
+			}
+			for _, term := range q.Taxonomies[strings.ToLower(taxonomy[0])] {
+				if slugify(term) == slug {
+					pages = append(pages, q)
+					break
+				}
+			}
+		}
+	}
+	byName := strings.EqualFold(p.order, "name")
+	sort.SliceStable(pages, func(i, j int) bool {
+		a, b := pages[i], pages[j]
+		if !byName && !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return a.Path < b.Path
+	})
+	return pages
+}
@@ -0,0 +1,166 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const ArchetypeDirName = "archetypes"
+
+// newPageOptions are set from the new command flags.
+type newPageOptions struct {
+	Template string
+	Entry    bool
+}
+
+var NewPageOptions newPageOptions
+
+// archetypeData is passed to archetype templates.
+type archetypeData struct {
+	Title    string
+	Date     string
+	Template string
+}
+
+// Built-in archetypes by source extension
+var defaultArchetypes = map[string]string{
+	config.MarkdownExt: `---
+Title: {{.Title}}
+PublishDate: {{.Date}}
+Draft: true
+---
+
+`,
+	".html": `{{"{{"}}define "content"{{"}}"}}
+<h1>{{.Title}}</h1>
+{{"{{"}}end{{"}}"}}
+`,
+}
+
+// CreatePage creates the page at the path given as the only argument.
+func CreatePage(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Please provide the path of the page, relative to the source directory")
+	}
+	rel := filepath.FromSlash(args[0])
+	if filepath.Ext(rel) == "" {
+		rel += config.MarkdownExt
+	}
+	dest := filepath.Join(config.InputPath, config.SourceDirName, rel)
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+
+	content, err := archetype(rel)
+	if err != nil {
+		return fmt.Errorf("Error reading archetype: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("Error creating directory: %v", err)
+	}
+	if err := ioutil.WriteFile(dest, content, 0644); err != nil {
+		return fmt.Errorf("Error writing %s: %v", dest, err)
+	}
+	config.InfoLogger.Printf("Created %s\n", dest)
+
+	if NewPageOptions.Entry || NewPageOptions.Template != "" {
+		if err := addDirConfigEntry(filepath.Dir(dest), filepath.Base(dest), config.File{Template: NewPageOptions.Template}); err != nil {
+			return fmt.Errorf("Error updating directory config: %v", err)
+		}
+	}
+	return nil
+}
+
+// archetype renders the starting content of a new page. The archetypes
+// directory is searched for <section><ext> and default<ext> before falling
+// back to the built-in ones, section being the first directory of rel.
+func archetype(rel string) ([]byte, error) {
+	ext := filepath.Ext(rel)
+	var candidates []string
+	if parts := strings.SplitN(filepath.ToSlash(rel), "/", 2); len(parts) == 2 {
+		candidates = append(candidates, parts[0]+ext)
+	}
+	candidates = append(candidates, "default"+ext)
+
+	text, found := "", false
+	for _, name := range candidates {
+		b, err := ioutil.ReadFile(filepath.Join(config.InputPath, ArchetypeDirName, name))
+		if err == nil {
+			text, found = string(b), true
+			break
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if !found {
+		text = defaultArchetypes[strings.ToLower(ext)]
+	}
+
+	t, err := template.New("archetype").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(rel), ext)
+	title := strings.Title(strings.NewReplacer("-", " ", "_", " ").Replace(name))
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, archetypeData{
+		Title:    title,
+		Date:     time.Now().Format("2006-01-02"),
+		Template: NewPageOptions.Template,
+	}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// addDirConfigEntry adds an entry for name to the JSON config of dir,
+// creating the file if needed. Configs in other formats are left for the
+// user to edit, since rewriting them would lose comments.
+func addDirConfigEntry(dir, name string, fcfg config.File) error {
+	path, err := config.FindConfigFile(dir, config.DirConfigBaseName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && filepath.Ext(path) != ".json" {
+		return fmt.Errorf("%s is not JSON, please add an entry for %s by hand", path, name)
+	}
+	if err != nil {
+		path = filepath.Join(dir, config.DirConfigBaseName+".json")
+	}
+
+	// Keep unrelated entries exactly as they are
+	cfg := make(map[string]interface{})
+	if b, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if _, exist := cfg[name]; exist {
+		return fmt.Errorf("%s already has an entry for %s", path, name)
+	}
+	entry := make(map[string]interface{})
+	if fcfg.Template != "" {
+		entry["Template"] = fcfg.Template
+	}
+	cfg[name] = entry
+
+	b, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	config.InfoLogger.Printf("Added %s to %s\n", name, path)
+	return nil
+}
@@ -0,0 +1,81 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"html"
+	"html/template"
+	"path"
+	"strings"
+)
+
+const DefaultOGDerivative = "og"
+
+// ogImageURL resolves the image of a page, given relative to the project
+// directory, to an absolute URL, preferring its Open Graph derivative.
+func ogImageURL(img string) string {
+	if config.IsAbsURL(img) {
+		return img
+	}
+	rel := path.Clean(strings.TrimPrefix(img, "/"))
+	published := config.OutputName(rel)
+	name := DefaultOGDerivative
+	if config.Config.OpenGraph != nil && config.Config.OpenGraph.ImageDerivative != "" {
+		name = config.Config.OpenGraph.ImageDerivative
+	}
+	if cfgs, err := assets.ImageDerivatives(); err == nil {
+		dir := strings.TrimPrefix(path.Dir(rel), config.StaticDirName+"/")
+		if cfg, exist := cfgs[dir][name]; exist {
+			published = assets.DerivativePath(rel, name, cfg)
+		}
+	}
+	return config.AbsURL(published)
+}
+
+// ogTags renders the Open Graph and Twitter card meta tags of a page, e.g.
+// {{ogTags .}} in the head of a template. Title, Description and Image come
+// from the page data.
+func ogTags(p *Page) template.HTML {
+	cfg := config.OpenGraph{}
+	if config.Config.OpenGraph != nil {
+		cfg = *config.Config.OpenGraph
+	}
+	var buf bytes.Buffer
+	tag := func(attr, name, content string) {
+		if content != "" {
+			fmt.Fprintf(&buf, "<meta %s=\"%s\" content=\"%s\">\n", attr, name, html.EscapeString(content))
+		}
+	}
+
+	kind := "website"
+	if p.Kind == "page" && !p.Date.IsZero() {
+		kind = "article"
+	}
+	img := p.Image
+	if img == "" {
+		img = cfg.Image
+	}
+	if img != "" {
+		img = ogImageURL(img)
+	}
+
+	tag("property", "og:type", kind)
+	tag("property", "og:title", p.Title)
+	tag("property", "og:description", p.Summary)
+	tag("property", "og:url", p.Permalink)
+	tag("property", "og:site_name", cfg.SiteName)
+	tag("property", "og:locale", strings.Replace(p.Lang, "-", "_", -1))
+	tag("property", "og:image", img)
+	card := "summary"
+	if img != "" {
+		card = "summary_large_image"
+	}
+	tag("name", "twitter:card", card)
+	tag("name", "twitter:site", cfg.Twitter)
+	tag("name", "twitter:title", p.Title)
+	tag("name", "twitter:description", p.Summary)
+	tag("name", "twitter:image", img)
+	return template.HTML(buf.String())
+}
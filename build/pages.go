@@ -0,0 +1,369 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Page is passed to templates as the dot of every page.
+type Page struct {
+	// Path of the source file relative to the source directory
+	Path string
+	// Dir is the directory part of Path
+	Dir string
+	// RelPermalink is the URL path of the generated page, starting with the
+	// path of the BaseURL like relURL does, Permalink its absolute URL
+	RelPermalink string
+	Permalink    string
+
+	Title string
+	Date  time.Time
+	// Summary is set in front matter as Summary or Description, or else
+	// taken from the content, see contentStats
+	Summary       string
+	SourceModTime time.Time
+	// WordCount counts the words of the content, ReadingTime is how many
+	// minutes reading them takes
+	WordCount   int
+	ReadingTime int
+	// Image represents the page when shared, relative to the project
+	// directory
+	Image string
+	// Schema lists the schema.org types jsonld renders for the page
+	Schema []string
+
+	// Kind is "page" for source pages, "term" for taxonomy term listings
+	// and "taxonomy" for the list of terms
+	Kind string
+	// Taxonomies maps taxonomy names to the terms of the page
+	Taxonomies map[string][]string
+	// Lang is the language code of the page on multilingual sites, and
+	// Translations its versions in the other languages
+	Lang         string
+	Translations []Translation
+
+	// Pages lists the pages of generated listing pages
+	Pages []*Page
+	// Section is the directory of the page
+	Section *Section
+	// Paginator is set on pages whose directory config sets Paginate
+	Paginator *Paginator
+
+	// Data from the directory config, merged with front matter
+	Data interface{}
+	Site *Site
+
+	// Absolute source and destination paths
+	source string
+	dest   string
+	// Internal links in the source, normalized with NormalizeLink
+	links []string
+	// password encrypts the page when set
+	password string
+	// order is the Order setting of the page
+	order string
+}
+
+// Site holds what is shared by every page.
+type Site struct {
+	BaseURL string
+	// Env is the environment given with --env, if any
+	Env    string
+	Config config.Master
+	// Data holds the contents of the data directory
+	Data map[string]interface{}
+	// Languages of a multilingual site, the default first
+	Languages []string
+	// Menus are the navigation menus by name, see menuEntry
+	Menus map[string][]*menuEntry
+
+	// Output paths of the pages by translation key and language
+	translations map[string]map[string]string
+}
+
+func newSite() (*Site, error) {
+	data, err := loadSiteData()
+	if err != nil {
+		return nil, err
+	}
+	if err := loadTranslations(); err != nil {
+		return nil, err
+	}
+	translations, err := scanTranslations()
+	if err != nil {
+		return nil, err
+	}
+	return &Site{
+		BaseURL:      config.Config.BaseURL,
+		Env:          config.Env,
+		Config:       config.Config,
+		Data:         data,
+		Languages:    config.Config.Languages,
+		translations: translations,
+	}, nil
+}
+
+// pageIndex collects the pages rendered during a build. It is safe for
+// concurrent use by the render workers.
+type pageIndex struct {
+	mu    sync.Mutex
+	pages []*Page
+}
+
+func (idx *pageIndex) Add(p *Page) {
+	idx.mu.Lock()
+	idx.pages = append(idx.pages, p)
+	idx.mu.Unlock()
+}
+
+// InDir returns the pages whose source lives directly in dir.
+func (idx *pageIndex) InDir(dir string) []*Page {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	var pages []*Page
+	for _, p := range idx.pages {
+		if filepath.Dir(p.source) == dir {
+			pages = append(pages, p)
+		}
+	}
+	return pages
+}
+
+// Section is a directory of the source tree, listing the pages in it and
+// below it.
+type Section struct {
+	// Path relative to the source directory, "." for the root
+	Path  string
+	index *pageIndex
+}
+
+// Section returns the section of a slash separated directory path relative
+// to the source directory.
+func (idx *pageIndex) Section(dir string) *Section {
+	return &Section{Path: path.Clean(dir), index: idx}
+}
+
+// Pages returns the pages of the section, except its index page, newest
+// first. Pass true to include the pages of subdirectories too.
+func (s *Section) Pages(recursive ...bool) []*Page {
+	deep := len(recursive) > 0 && recursive[0]
+	s.index.mu.Lock()
+	var pages []*Page
+	for _, p := range s.index.pages {
+		if p.Kind != "page" || p == s.indexPage() {
+			continue
+		}
+		if p.Dir == s.Path || (deep && isSubdir(s.Path, p.Dir)) {
+			pages = append(pages, p)
+		}
+	}
+	s.index.mu.Unlock()
+	sortPagesByDate(pages)
+	return pages
+}
+
+// Index returns the index page of the section, or nil if it has none.
+func (s *Section) Index() *Page {
+	s.index.mu.Lock()
+	defer s.index.mu.Unlock()
+	return s.indexPage()
+}
+
+// indexPage looks up the index page, the index mutex held.
+func (s *Section) indexPage() *Page {
+	for _, p := range s.index.pages {
+		if p.Dir == s.Path && strings.TrimSuffix(path.Base(p.Path), path.Ext(p.Path)) == "index" {
+			return p
+		}
+	}
+	return nil
+}
+
+// Sections returns the subdirectories of the section that hold pages.
+func (s *Section) Sections() []*Section {
+	s.index.mu.Lock()
+	dirs := make(map[string]bool)
+	for _, p := range s.index.pages {
+		if p.Kind == "page" && isSubdir(s.Path, p.Dir) {
+			rel := strings.TrimPrefix(p.Dir, s.Path+"/")
+			if s.Path == "." {
+				rel = p.Dir
+			}
+			dirs[path.Join(s.Path, strings.SplitN(rel, "/", 2)[0])] = true
+		}
+	}
+	s.index.mu.Unlock()
+	var sections []*Section
+	for dir := range dirs {
+		sections = append(sections, s.index.Section(dir))
+	}
+	sort.Slice(sections, func(i, j int) bool { return sections[i].Path < sections[j].Path })
+	return sections
+}
+
+// Parent returns the section containing this one, nil for the root.
+func (s *Section) Parent() *Section {
+	if s.Path == "." {
+		return nil
+	}
+	return s.index.Section(path.Dir(s.Path))
+}
+
+// isSubdir reports whether dir is below parent, both slash separated paths
+// relative to the source directory.
+func isSubdir(parent, dir string) bool {
+	if dir == parent {
+		return false
+	}
+	return parent == "." || strings.HasPrefix(dir, parent+"/")
+}
+
+// Pages is the pages template function, listing the pages of a directory
+// relative to the source directory, e.g. pages "blog/". A second argument
+// of true includes subdirectories.
+func (idx *pageIndex) Pages(dir string, recursive ...bool) []*Page {
+	return idx.Section(strings.Trim(dir, "/")).Pages(recursive...)
+}
+
+// noPages stands in for the pages template function outside of builds.
+func noPages(dir string, recursive ...bool) []*Page {
+	return nil
+}
+
+// newPage fills in a page from its paths and template data. Title, date and
+// summary are looked up in the data, which is usually a map decoded from
+// JSON or front matter.
+func newPage(site *Site, source, dest string, data interface{}, publishDate time.Time) *Page {
+	p := &Page{
+		Kind:   "page",
+		Data:   data,
+		Site:   site,
+		source: source,
+		dest:   dest,
+	}
+	if rel, err := filepath.Rel(filepath.Join(config.InputPath, config.SourceDirName), source); err == nil {
+		p.Path = filepath.ToSlash(rel)
+		p.Dir = filepath.ToSlash(filepath.Dir(rel))
+		lang, key := pageLanguage(rel)
+		p.Lang = lang
+		p.Translations = pageTranslations(site, lang, key)
+	}
+	if fi, err := os.Stat(source); err == nil {
+		p.SourceModTime = fi.ModTime()
+	}
+	if rel, err := filepath.Rel(config.Config.Output, dest); err == nil {
+		p.RelPermalink, p.Permalink = pageURLs(rel)
+	}
+
+	m, _ := data.(map[string]interface{})
+	var date time.Time
+	p.Title, p.Summary, date = pageFields(m)
+	p.Date = pageDate(publishDate, date)
+	if p.Title == "" {
+		p.Title = strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	}
+	if v, ok := frontMatterValue(m, "Image"); ok {
+		p.Image, _ = v.(string)
+	}
+	p.Taxonomies = make(map[string][]string)
+	for name := range taxonomies() {
+		if v, ok := frontMatterValue(m, name); ok {
+			p.Taxonomies[name] = stringList(v)
+		}
+	}
+	return p
+}
+
+// setContent fills in the word count, reading time and, unless front
+// matter set it, summary of a page from its body. Protected pages don't
+// give away their content in a summary.
+func (p *Page) setContent(body []byte, markdown bool) {
+	words, summary := contentStats(body, markdown)
+	p.WordCount, p.ReadingTime = words, readingTime(words)
+	if p.Summary == "" && !p.Protected() {
+		p.Summary = summary
+	}
+}
+
+// pageDate is the PublishDate of the directory config of a page, or else
+// the date of its front matter.
+func pageDate(publishDate, date time.Time) time.Time {
+	if publishDate.IsZero() {
+		return date
+	}
+	return publishDate
+}
+
+// pageFields looks up the title, summary and date of a page in its data.
+// The summary can also be given as Description, the date as PublishDate or
+// Date.
+func pageFields(m map[string]interface{}) (title, summary string, date time.Time) {
+	if v, ok := frontMatterValue(m, "Title"); ok {
+		title, _ = v.(string)
+	}
+	if v, ok := frontMatterValue(m, "Summary"); ok {
+		summary, _ = v.(string)
+	} else if v, ok := frontMatterValue(m, "Description"); ok {
+		summary, _ = v.(string)
+	}
+	for _, key := range []string{"PublishDate", "Date"} {
+		if v, ok := frontMatterValue(m, key); ok {
+			if d, err := parseDate(v); err == nil {
+				date = d
+				break
+			}
+		}
+	}
+	return
+}
+
+// is reports whether q is p or a copy of it made for rendering, such as
+// the pages of a paginated listing.
+func (p *Page) is(q *Page) bool {
+	return p == q || (p != nil && q != nil && p.source != "" && p.source == q.source)
+}
+
+// Protected reports whether the page is published encrypted. It is false
+// for a nil page.
+func (p *Page) Protected() bool {
+	return p != nil && p.password != ""
+}
+
+// Tags returns the terms of the tags taxonomy.
+func (p *Page) Tags() []string {
+	return p.Taxonomies["tags"]
+}
+
+// Categories returns the terms of the categories taxonomy.
+func (p *Page) Categories() []string {
+	return p.Taxonomies["categories"]
+}
+
+// stringList converts a decoded list, or a comma separated string, into a
+// slice of strings.
+func stringList(v interface{}) []string {
+	var list []string
+	switch v := v.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	case []string:
+		list = v
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,91 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"html/template"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+const PageDirName = "page"
+
+// Paginator is one page of a paginated listing.
+type Paginator struct {
+	// Pages on this page of the listing
+	Pages      []*Page
+	PageNumber int
+	TotalPages int
+	// URL paths of the neighbouring and outermost pages, Prev and Next are
+	// empty on the first and last page
+	First string
+	Last  string
+	Prev  string
+	Next  string
+}
+
+// renderPaged executes the page template once, or once per page of the
+// listing when perPage is positive. The first page goes to the page's own
+// destination and the rest to page/2/, page/3/… next to it.
+func renderPaged(ctx *renderContext, t *template.Template, name string, p *Page, perPage int) error {
+	if perPage <= 0 {
+		return executeTemplate(t, name, p.dest, p)
+	}
+
+	var pages []*Page
+	for _, other := range ctx.Index.InDir(filepath.Dir(p.source)) {
+		if other.source != p.source {
+			pages = append(pages, other)
+		}
+	}
+	sortPagesByDate(pages)
+
+	total := (len(pages) + perPage - 1) / perPage
+	if total == 0 {
+		total = 1
+	}
+	urls := make([]string, total)
+	permalinks := make([]string, total)
+	dests := make([]string, total)
+	urls[0], permalinks[0], dests[0] = p.RelPermalink, p.Permalink, p.dest
+	for n := 2; n <= total; n++ {
+		dir := path.Join(path.Dir(siteURLPath(p.RelPermalink)), PageDirName, strconv.Itoa(n)) + "/"
+		urls[n-1], permalinks[n-1] = config.RelURL(dir), config.AbsURL(dir)
+		dests[n-1] = filepath.Join(filepath.Dir(p.dest), PageDirName, strconv.Itoa(n), "index.html")
+	}
+
+	for i := 0; i < total; i++ {
+		end := (i + 1) * perPage
+		if end > len(pages) {
+			end = len(pages)
+		}
+		pager := &Paginator{
+			Pages:      pages[i*perPage : end],
+			PageNumber: i + 1,
+			TotalPages: total,
+			First:      urls[0],
+			Last:       urls[total-1],
+		}
+		if i > 0 {
+			pager.Prev = urls[i-1]
+		}
+		if i < total-1 {
+			pager.Next = urls[i+1]
+		}
+
+		// Every pager page is a copy, as other workers may be reading the
+		// indexed page. Later ones get their own location.
+		copied := *p
+		pp := &copied
+		if i > 0 {
+			pp.dest = dests[i]
+			pp.RelPermalink = urls[i]
+			pp.Permalink = permalinks[i]
+		}
+		pp.Paginator = pager
+		if err := executeTemplate(t, name, pp.dest, pp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
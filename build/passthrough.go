@@ -0,0 +1,34 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"golang.org/x/text/unicode/norm"
+	"path"
+)
+
+// DefaultExclude keeps hidden files and editor backups out of the output.
+var DefaultExclude = []string{".*", "*~"}
+
+// excluded reports whether a file of the source directory, given relative
+// to it with slashes, is left out of the output. Patterns match either the
+// name or the whole path. Directory configs are never copied.
+func excluded(rel string) bool {
+	rel = norm.NFC.String(rel)
+	name := path.Base(rel)
+	if config.IsConfigFile(name, config.DirConfigBaseName) {
+		return true
+	}
+	patterns := config.Config.Exclude
+	if patterns == nil {
+		patterns = DefaultExclude
+	}
+	for _, pattern := range patterns {
+		if match, _ := path.Match(pattern, name); match {
+			return true
+		}
+		if match, _ := path.Match(pattern, rel); match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"plugin"
+)
+
+const FunctionsDirName = "functions"
+
+// PluginFuncsSymbol is the variable a function plugin exports, either a
+// map[string]interface{} or a template.FuncMap:
+//
+//	var Funcs = map[string]interface{}{"shout": strings.ToUpper}
+const PluginFuncsSymbol = "Funcs"
+
+// templateFuncs returns the built-in template functions merged with the ones
+// from plugins in the functions directory. Plugins may override built-ins.
+func templateFuncs() (template.FuncMap, error) {
+	funcs := make(template.FuncMap, len(TemplateFunctions))
+	for name, f := range TemplateFunctions {
+		funcs[name] = f
+	}
+
+	dir := filepath.Join(config.InputPath, FunctionsDirName)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return funcs, nil
+		}
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".so" {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		pfuncs, err := loadFuncPlugin(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for name, f := range pfuncs {
+			funcs[name] = f
+		}
+	}
+	return funcs, nil
+}
+
+func loadFuncPlugin(path string) (map[string]interface{}, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(PluginFuncsSymbol)
+	if err != nil {
+		return nil, err
+	}
+	switch funcs := sym.(type) {
+	case *map[string]interface{}:
+		return *funcs, nil
+	case *template.FuncMap:
+		return *funcs, nil
+	}
+	return nil, fmt.Errorf("%s has unsupported type %T", PluginFuncsSymbol, sym)
+}
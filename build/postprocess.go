@@ -0,0 +1,217 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"html/template"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// InjectPositions are the values config.Injection.Position accepts, the
+// empty string meaning "head".
+var InjectPositions = []string{"", "head", "body"}
+
+// htmlProcessor transforms the HTML of a rendered page.
+type htmlProcessor func(p *Page, html []byte) ([]byte, error)
+
+// HTMLProcessors maps the names config.PostProcess.Chain accepts to their
+// implementations.
+var HTMLProcessors = map[string]htmlProcessor{
+	"minify":     minifyHTML,
+	"analytics":  injectAnalytics,
+	"noopener":   noopenerLinks,
+	"lazyload":   lazyLoadImages,
+	"dimensions": imageDimensions,
+	"inject":     injectSnippets,
+}
+
+var (
+	// rewriteTagRe matches the opening tags processors rewrite, with their
+	// attributes
+	rewriteTagRe = regexp.MustCompile(`(?is)<(a|img)(\s[^>]*)?>`)
+	// headEndRe and bodyEndRe find where snippets go
+	headEndRe = regexp.MustCompile(`(?i)</head\s*>`)
+	bodyEndRe = regexp.MustCompile(`(?i)</body\s*>`)
+)
+
+// htmlProcessors returns the chain of processors pages go through. The
+// Injections of the master config are added at the end unless the chain
+// says where.
+func htmlProcessors() []string {
+	var chain []string
+	if config.Config.PostProcess != nil {
+		chain = config.Config.PostProcess.Chain
+	}
+	if len(config.Config.Injections) > 0 && !config.ContainsFold(chain, "inject") {
+		chain = append(chain[:len(chain):len(chain)], "inject")
+	}
+	return chain
+}
+
+// executePage executes a template into w. HTML pages are rendered in full
+// first and passed through the processors.
+func executePage(w io.Writer, t *template.Template, name, dest string, data interface{}) error {
+	chain := htmlProcessors()
+	if len(chain) == 0 || !config.IsHTML(dest) {
+		return t.ExecuteTemplate(w, name, data)
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return err
+	}
+	p, _ := data.(*Page)
+	b := buf.Bytes()
+	for _, name := range chain {
+		process, exist := HTMLProcessors[strings.ToLower(name)]
+		if !exist {
+			return fmt.Errorf("unknown HTML processor %q", name)
+		}
+		var err error
+		if b, err = process(p, b); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// rewriteTags calls fn with the attributes of every opening tag of the
+// given name, replacing them with what it returns. Attributes start with a
+// space unless empty.
+func rewriteTags(html []byte, tag string, fn func(attrs string) string) []byte {
+	return rewriteTagRe.ReplaceAllFunc(html, func(m []byte) []byte {
+		sub := rewriteTagRe.FindSubmatch(m)
+		if !strings.EqualFold(string(sub[1]), tag) {
+			return m
+		}
+		attrs := string(sub[2])
+		selfClosing := strings.HasSuffix(attrs, "/")
+		attrs = strings.TrimSuffix(attrs, "/")
+		attrs = fn(attrs)
+		if selfClosing {
+			attrs += " /"
+		}
+		return []byte("<" + string(sub[1]) + attrs + ">")
+	})
+}
+
+// Attribute patterns are compiled once per name
+var attrRes sync.Map
+
+// attrRe matches an attribute with its value, if it has one.
+func attrRe(name string) *regexp.Regexp {
+	if re, exist := attrRes.Load(name); exist {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(`(?is)\s` + regexp.QuoteMeta(name) + `(?:\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+))?(?:\s|$)`)
+	attrRes.Store(name, re)
+	return re
+}
+
+// attrValue returns the value of an attribute and whether it is there.
+func attrValue(attrs, name string) (string, bool) {
+	m := attrRe(name).FindStringSubmatch(attrs + " ")
+	if m == nil {
+		return "", false
+	}
+	return strings.Trim(m[1], `"'`), true
+}
+
+// setAttr adds or replaces an attribute.
+func setAttr(attrs, name, value string) string {
+	attr := fmt.Sprintf(` %s="%s"`, name, template.HTMLEscapeString(value))
+	padded := attrs + " "
+	if loc := attrRe(name).FindStringIndex(padded); loc != nil {
+		// The match takes the space after the attribute along
+		return strings.TrimRight(padded[:loc[0]]+attr+" "+padded[loc[1]:], " ")
+	}
+	return strings.TrimRight(attrs, " ") + attr
+}
+
+func minifyHTML(p *Page, html []byte) ([]byte, error) {
+	return assets.Minifier.Bytes("text/html", html)
+}
+
+func injectAnalytics(p *Page, html []byte) ([]byte, error) {
+	snippet := config.Config.PostProcess.Analytics
+	if snippet == "" {
+		return html, nil
+	}
+	return insertBefore(html, headEndRe, snippet), nil
+}
+
+// injectSnippets adds the Injections of the master config for the current
+// environment, in the order they are listed.
+func injectSnippets(p *Page, html []byte) ([]byte, error) {
+	for _, inj := range config.Config.Injections {
+		if len(inj.Env) > 0 && !config.ContainsFold(inj.Env, config.Env) {
+			continue
+		}
+		re := headEndRe
+		if strings.EqualFold(inj.Position, "body") {
+			re = bodyEndRe
+		}
+		html = insertBefore(html, re, inj.HTML)
+	}
+	return html, nil
+}
+
+// insertBefore inserts snippet before the first match of re, or appends it
+// when there is none.
+func insertBefore(html []byte, re *regexp.Regexp, snippet string) []byte {
+	loc := re.FindIndex(html)
+	if loc == nil {
+		return append(html, snippet...)
+	}
+	out := make([]byte, 0, len(html)+len(snippet))
+	out = append(out, html[:loc[0]]...)
+	out = append(out, snippet...)
+	return append(out, html[loc[0]:]...)
+}
+
+// isExternalURL reports whether a link leaves the site.
+func isExternalURL(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	base, err := url.Parse(config.Config.BaseURL)
+	return err != nil || !strings.EqualFold(u.Host, base.Host)
+}
+
+// noopenerLinks adds rel="noopener noreferrer" to links leaving the site or
+// opening a new window, keeping other rel values.
+func noopenerLinks(p *Page, html []byte) ([]byte, error) {
+	return rewriteTags(html, "a", func(attrs string) string {
+		href, _ := attrValue(attrs, "href")
+		target, _ := attrValue(attrs, "target")
+		if !isExternalURL(href) && !strings.EqualFold(target, "_blank") {
+			return attrs
+		}
+		rel, _ := attrValue(attrs, "rel")
+		values := strings.Fields(rel)
+		for _, v := range []string{"noopener", "noreferrer"} {
+			if !config.ContainsFold(values, v) {
+				values = append(values, v)
+			}
+		}
+		return setAttr(attrs, "rel", strings.Join(values, " "))
+	}), nil
+}
+
+// lazyLoadImages defers loading images until they are scrolled near,
+// leaving images that say how to load alone.
+func lazyLoadImages(p *Page, html []byte) ([]byte, error) {
+	return rewriteTags(html, "img", func(attrs string) string {
+		if _, exist := attrValue(attrs, "loading"); exist {
+			return attrs
+		}
+		return setAttr(attrs, "loading", "lazy")
+	}), nil
+}
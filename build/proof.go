@@ -0,0 +1,307 @@
+package build
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const DefaultProofLanguage = "en_US"
+
+// DefaultProofCommand runs hunspell in the pipe mode of ispell, which aspell
+// speaks too. The placeholder {lang} is replaced by the language.
+var DefaultProofCommand = []string{"hunspell", "-a", "-d", "{lang}"}
+
+type proofOptions struct {
+	Sources bool
+}
+
+var ProofOptions proofOptions
+
+// proofFinding is a problem at a line of a file.
+type proofFinding struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (f proofFinding) String() string {
+	return fmt.Sprintf("%s:%d: %s", f.File, f.Line, f.Msg)
+}
+
+var (
+	proseSkipRe   = regexp.MustCompile(`(?is)<(script|style|pre|code|kbd|samp)\b.*?</(script|style|pre|code|kbd|samp)\s*>`)
+	fenceRe       = regexp.MustCompile("(?ms)^[ \t]*(```|~~~).*?^[ \t]*(```|~~~)[ \t]*$")
+	inlineCodeRe  = regexp.MustCompile("`[^`\n]*`")
+	linkTargetRe  = regexp.MustCompile(`\]\([^)\n]*\)|\]\[[^\]\n]*\]|^\s*\[[^\]\n]+\]:.*$|<https?://[^>\s]*>`)
+	proseWordRe   = regexp.MustCompile(`\p{L}[\p{L}'’]*`)
+	proseURLRe    = regexp.MustCompile(`\b\w+://\S+`)
+	proseLetterRe = regexp.MustCompile(`\p{L}`)
+)
+
+// blankOut replaces what re matches with the line breaks it spans, so the
+// remaining text keeps its line numbers.
+func blankOut(re *regexp.Regexp, s string) string {
+	return re.ReplaceAllStringFunc(s, func(m string) string {
+		return strings.Repeat("\n", strings.Count(m, "\n")) + " "
+	})
+}
+
+// htmlProse is the text of a page, line by line, without markup or code.
+func htmlProse(src string) []string {
+	s := blankOut(proseSkipRe, src)
+	s = blankOut(tagRe, s)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = html.UnescapeString(l)
+	}
+	return lines
+}
+
+// markdownProse is the text of a Markdown page, line by line, without front
+// matter, code, link targets or shortcodes.
+func markdownProse(src []byte) ([]string, error) {
+	_, body, err := splitFrontMatter(src)
+	if err != nil {
+		return nil, err
+	}
+	s := strings.Repeat("\n", strings.Count(string(src[:len(src)-len(body)]), "\n")) + string(body)
+	for _, re := range []*regexp.Regexp{fenceRe, inlineCodeRe, shortcodeRe, linkTargetRe, proseSkipRe, tagRe} {
+		s = blankOut(re, s)
+	}
+	return strings.Split(s, "\n"), nil
+}
+
+// spellChecker talks to an ispell compatible checker in pipe mode.
+type spellChecker struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Scanner
+}
+
+func startSpellChecker(args []string) (*spellChecker, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = config.InputPath
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %v", strings.Join(args, " "), err)
+	}
+	c := &spellChecker{cmd: cmd, in: in, out: bufio.NewScanner(out)}
+	// The checker greets with its version
+	if !c.out.Scan() {
+		c.Close()
+		return nil, fmt.Errorf("%s: no response", strings.Join(args, " "))
+	}
+	return c, nil
+}
+
+// check returns the misspelled words of a line and their suggestions.
+func (c *spellChecker) check(line string) (map[string]string, error) {
+	// A leading ^ keeps the line from being read as a command
+	if _, err := io.WriteString(c.in, "^"+line+"\n"); err != nil {
+		return nil, err
+	}
+	words := make(map[string]string)
+	for c.out.Scan() {
+		l := c.out.Text()
+		if l == "" {
+			return words, nil
+		}
+		// "& word count offset: suggestions" or "# word offset"
+		if f := strings.Fields(l); len(f) >= 2 && (f[0] == "&" || f[0] == "#") {
+			suggestions := ""
+			if i := strings.Index(l, ": "); f[0] == "&" && i >= 0 {
+				suggestions = l[i+2:]
+			}
+			words[f[1]] = suggestions
+		}
+	}
+	if err := c.out.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+func (c *spellChecker) Close() error {
+	c.in.Close()
+	return c.cmd.Wait()
+}
+
+// readDictionaries reads the words of the project dictionaries.
+func readDictionaries(files []string) (map[string]bool, error) {
+	words := make(map[string]bool)
+	for _, name := range files {
+		b, err := ioutil.ReadFile(filepath.Join(config.InputPath, name))
+		if err != nil {
+			return nil, fmt.Errorf("Error reading dictionary: %v", err)
+		}
+		for _, l := range strings.Split(string(b), "\n") {
+			if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+				words[strings.ToLower(l)] = true
+			}
+		}
+	}
+	return words, nil
+}
+
+// lintLine reports repeated words and phrases to avoid in a line.
+func lintLine(line string, avoid []string) []string {
+	var msgs []string
+	prev := ""
+	for _, w := range proseWordRe.FindAllString(line, -1) {
+		if strings.EqualFold(w, prev) {
+			msgs = append(msgs, fmt.Sprintf("repeated word %q", w))
+		}
+		prev = w
+	}
+	lower := " " + strings.Join(strings.Fields(strings.ToLower(proseURLRe.ReplaceAllString(line, " "))), " ") + " "
+	for _, phrase := range avoid {
+		p := strings.ToLower(strings.TrimSpace(phrase))
+		if p == "" {
+			continue
+		}
+		for _, sep := range []string{" ", ",", ".", ";", ":", "!", "?"} {
+			if strings.Contains(lower, " "+p+sep) {
+				msgs = append(msgs, fmt.Sprintf("avoid %q", phrase))
+				break
+			}
+		}
+	}
+	return msgs
+}
+
+// proofFiles lists the files proof reads, relative to the project.
+func proofFiles() ([]string, error) {
+	var files []string
+	root, accept := config.Config.Output, config.IsHTML
+	if ProofOptions.Sources {
+		root, accept = filepath.Join(config.InputPath, config.SourceDirName), config.IsMarkdown
+	}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if config.ContainsFold(output.VCSDirNames, info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if accept(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Proof spell checks the text of the built pages, or with --sources the
+// Markdown pages, and lints it for repeated words and phrases to avoid.
+func Proof() error {
+	if err := config.Load(); err != nil {
+		return err
+	}
+	if !ProofOptions.Sources && config.Config.Output == "" {
+		return errors.New("Output directory unset in configuration")
+	}
+	var cfg config.Proof
+	if config.Config.Proof != nil {
+		cfg = *config.Config.Proof
+	}
+	if cfg.Language == "" {
+		cfg.Language = DefaultProofLanguage
+	}
+	command := cfg.Command
+	if len(command) == 0 {
+		command = DefaultProofCommand
+	}
+	known, err := readDictionaries(cfg.Dictionaries)
+	if err != nil {
+		return err
+	}
+	files, err := proofFiles()
+	if err != nil {
+		return fmt.Errorf("Error reading files: %v", err)
+	}
+
+	checker, err := startSpellChecker(assets.ExpandCommand(command, map[string]string{"lang": cfg.Language}))
+	if err != nil {
+		return fmt.Errorf("Error starting spell checker: %v", err)
+	}
+	defer checker.Close()
+
+	var findings []proofFinding
+	for _, p := range files {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var lines []string
+		if ProofOptions.Sources {
+			if lines, err = markdownProse(b); err != nil {
+				return fmt.Errorf("Error reading %s: %v", p, err)
+			}
+		} else {
+			lines = htmlProse(string(b))
+		}
+		name, err := filepath.Rel(config.InputPath, p)
+		if err != nil {
+			name = p
+		}
+		name = filepath.ToSlash(name)
+
+		for i, line := range lines {
+			if !proseLetterRe.MatchString(line) {
+				continue
+			}
+			line = strings.TrimSpace(proseURLRe.ReplaceAllString(line, " "))
+			for _, msg := range lintLine(line, cfg.Avoid) {
+				findings = append(findings, proofFinding{File: name, Line: i + 1, Msg: msg})
+			}
+			words, err := checker.check(line)
+			if err != nil {
+				return fmt.Errorf("Error spell checking %s: %v", name, err)
+			}
+			for _, w := range proseWordRe.FindAllString(line, -1) {
+				suggestions, misspelled := words[w]
+				if !misspelled || known[strings.ToLower(w)] {
+					continue
+				}
+				delete(words, w)
+				msg := fmt.Sprintf("misspelled %q", w)
+				if suggestions != "" {
+					msg += ", did you mean " + suggestions
+				}
+				findings = append(findings, proofFinding{File: name, Line: i + 1, Msg: msg})
+			}
+		}
+	}
+
+	for _, f := range findings {
+		fmt.Println(f)
+	}
+	config.InfoLogger.Printf("Proofread %d files: %d findings\n", len(files), len(findings))
+	if len(findings) > 0 {
+		return fmt.Errorf("%d proofreading findings", len(findings))
+	}
+	return nil
+}
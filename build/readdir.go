@@ -0,0 +1,214 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dirEntry describes a file for the readdir template function.
+type dirEntry struct {
+	Name string
+	// Path relative to the project directory
+	Path string
+	// RelURL links to the published file or page, empty when the file is
+	// not published
+	RelURL  string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+
+	// ThumbURL links to the thumbnail of images in directories with
+	// AutoThumbnail settings
+	ThumbURL string
+	// ImageURLs links to the derivatives of images by name
+	ImageURLs map[string]string
+	// PosterURL links to the poster frame of videos when enabled
+	PosterURL string
+
+	// Page metadata, from the directory config and front matter
+	Title   string
+	Date    time.Time
+	Summary string
+	Data    interface{}
+	// WordCount and ReadingTime are those of Page
+	WordCount   int
+	ReadingTime int
+}
+
+// readdir lists a directory of the project. An optional glob pattern
+// filters the entries by name, and the entries can be sorted by "name",
+// "date", "size" or "title", followed by "desc" to reverse the order, e.g.
+// readdir "static/gallery" "*.jpg" "date" "desc". Like builds, it leaves
+// out ignored files and unpublished pages.
+func readdir(dir string, args ...string) ([]dirEntry, error) {
+	pattern, key, desc := "", "name", false
+	if len(args) > 0 {
+		pattern = args[0]
+	}
+	if len(args) > 1 {
+		key = strings.ToLower(args[1])
+	}
+	if len(args) > 2 {
+		desc = strings.EqualFold(args[2], "desc")
+	}
+	if len(args) > 3 {
+		return nil, fmt.Errorf("readdir takes at most 3 arguments after the path")
+	}
+
+	rel := path.Clean(strings.TrimPrefix(filepath.ToSlash(dir), "/"))
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil, fmt.Errorf("readdir %s: outside of the project", dir)
+	}
+	abs := filepath.Join(config.InputPath, filepath.FromSlash(rel))
+	files, err := ioutil.ReadDir(abs)
+	if err != nil {
+		return nil, err
+	}
+	dirCfg, err := config.ReadDirConfig(abs)
+	if err != nil {
+		return nil, err
+	}
+	derivatives, err := assets.ImageDerivatives()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []dirEntry
+	for _, fi := range files {
+		if pattern != "" {
+			match, err := path.Match(pattern, fi.Name())
+			if err != nil {
+				return nil, err
+			}
+			if !match {
+				continue
+			}
+		}
+		if config.IgnoredPath(filepath.Join(abs, fi.Name()), fi) {
+			continue
+		}
+		e := dirEntry{
+			Name:    fi.Name(),
+			Path:    path.Join(rel, fi.Name()),
+			IsDir:   fi.IsDir(),
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+		}
+		e.RelURL, e.ImageURLs = entryURLs(e.Path, e.IsDir, derivatives)
+		e.ThumbURL = e.ImageURLs[config.Config.ThumbDirName()]
+		if !e.IsDir && assets.IsVideo(e.Name) && strings.HasPrefix(e.Path, config.StaticDirName+"/") {
+			e.PosterURL = assets.PosterURL(e.Path)
+		}
+		fcfg, _ := dirCfg.Lookup(fi.Name())
+		publish, err := readPageMeta(&e, abs, fcfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Path, err)
+		}
+		// Unpublished pages are only left out of the source directory
+		if !publish && strings.HasPrefix(e.Path, config.SourceDirName+"/") {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if desc {
+			a, b = b, a
+		}
+		switch key {
+		case "date":
+			return entryDate(a).Before(entryDate(b))
+		case "size":
+			return a.Size < b.Size
+		case "title":
+			return a.Title < b.Title
+		}
+		return a.Name < b.Name
+	})
+	return entries, nil
+}
+
+// entryDate is the page date of an entry, or its modification time.
+func entryDate(e dirEntry) time.Time {
+	if !e.Date.IsZero() {
+		return e.Date
+	}
+	return e.ModTime
+}
+
+// entryURLs maps a project relative path to the URL it is published at and
+// the URLs of its image derivatives.
+func entryURLs(rel string, isDir bool, derivatives map[string]map[string]config.Thumbnail) (string, map[string]string) {
+	parts := strings.SplitN(rel, "/", 2)
+	if len(parts) < 2 {
+		return "", nil
+	}
+	switch parts[0] {
+	case config.StaticDirName:
+		var urls map[string]string
+		if cfgs, exist := derivatives[path.Dir(parts[1])]; exist && !isDir {
+			urls = make(map[string]string, len(cfgs))
+			for name, cfg := range cfgs {
+				urls[name] = config.RelURL(assets.DerivativePath(rel, name, cfg))
+			}
+		}
+		return config.RelURL(config.OutputName(rel)), urls
+	case config.SourceDirName:
+		if isDir {
+			return config.RelURL(config.OutputName(parts[1]) + "/"), nil
+		}
+		if config.IsContent(rel) {
+			return config.RelURL(outputURL(pageOutputPath(parts[1]))), nil
+		}
+		if !excluded(parts[1]) {
+			return config.RelURL(config.OutputName(parts[1])), nil
+		}
+	}
+	return "", nil
+}
+
+// readPageMeta fills in the title, date, summary and data of pages,
+// reporting whether the entry is published.
+func readPageMeta(e *dirEntry, dir string, fcfg config.File) (bool, error) {
+	if e.IsDir || !config.IsContent(e.Name) {
+		return true, nil
+	}
+	split := splitHTMLFrontMatter
+	if config.IsMarkdown(e.Name) {
+		split = splitFrontMatter
+	}
+	src, err := ioutil.ReadFile(filepath.Join(dir, e.Name))
+	if err != nil {
+		return false, err
+	}
+	fm, body, err := split(src)
+	if err != nil {
+		return false, err
+	}
+	if fcfg, err = applyFrontMatter(fcfg, fm); err != nil {
+		return false, err
+	}
+	if !publishable(fcfg.Draft, fcfg.PublishDate) {
+		return false, nil
+	}
+
+	e.Data = mergeData(fcfg.Data, fm)
+	m, _ := e.Data.(map[string]interface{})
+	var date time.Time
+	e.Title, e.Summary, date = pageFields(m)
+	words, summary := contentStats(body, config.IsMarkdown(e.Name))
+	e.WordCount, e.ReadingTime = words, readingTime(words)
+	if e.Summary == "" && fcfg.Password == "" {
+		e.Summary = summary
+	}
+	e.Date = pageDate(fcfg.PublishDate, date)
+	return true, nil
+}
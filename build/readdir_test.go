@@ -0,0 +1,65 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReaddir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "siteware-readdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"src/siteware.json": `{"dated.md": {"PublishDate": "2021-05-06T00:00:00Z"}}`,
+		"src/dated.md":      `{"Date": "2020-01-02"}`,
+		"src/post.md":       `{"Title": "Post"}`,
+		"src/draft.md":      `{"Draft": true}`,
+		"src/future.md":     `{"PublishDate": "2999-01-01"}`,
+		"src/notes.txt":     "notes",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := config.InputPath
+	config.InputPath = dir
+	defer func() { config.InputPath = saved }()
+
+	withConfig(config.Master{Ignore: []string{"*.txt"}}, func() {
+		entries, err := readdir("src", "*.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+			// The directory config date wins as it does for pages
+			if want := time.Date(2021, 5, 6, 0, 0, 0, 0, time.UTC); e.Name == "dated.md" && !e.Date.Equal(want) {
+				t.Errorf("dated.md Date = %v, want %v", e.Date, want)
+			}
+		}
+		if want := []string{"dated.md", "post.md"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("readdir listed %q, want %q", names, want)
+		}
+		if entries, _ := readdir("src", "*.txt"); len(entries) != 0 {
+			t.Errorf("readdir listed ignored files: %v", entries)
+		}
+		for _, outside := range []string{"..", "src/../..", "/../etc"} {
+			if _, err := readdir(outside); err == nil {
+				t.Errorf("readdir(%q) succeeded", outside)
+			}
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package build
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RemoteCacheDirName is where fetched remote data is kept, under the cache
+// directory.
+const RemoteCacheDirName = "remote"
+
+// DefaultRemoteCacheTTL is how long fetched data is used before fetching it
+// again, unless --cache-ttl says otherwise.
+const DefaultRemoteCacheTTL = time.Hour
+
+// RemoteTimeout limits a single request for remote data.
+const RemoteTimeout = 30 * time.Second
+
+// Every URL is fetched once per build however many pages use it
+type remoteFetch struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+var remoteMu sync.Mutex
+var remoteFetches = make(map[string]*remoteFetch)
+
+// resetRemoteData lets the next build use newer data.
+func resetRemoteData() {
+	remoteMu.Lock()
+	remoteFetches = make(map[string]*remoteFetch)
+	remoteMu.Unlock()
+}
+
+// fetchRemote returns the body of url, from the cache when it was fetched
+// within the cache TTL. When fetching fails, data cached earlier is used
+// anyway with a warning, so builds work offline.
+func fetchRemote(url string) ([]byte, error) {
+	remoteMu.Lock()
+	f, exist := remoteFetches[url]
+	if !exist {
+		f = &remoteFetch{}
+		remoteFetches[url] = f
+	}
+	remoteMu.Unlock()
+	f.once.Do(func() {
+		f.data, f.err = fetchRemoteCached(url)
+	})
+	return f.data, f.err
+}
+
+func fetchRemoteCached(url string) ([]byte, error) {
+	sum := sha1.Sum([]byte(url))
+	path := filepath.Join(config.InputPath, assets.CacheDirName, RemoteCacheDirName, hex.EncodeToString(sum[:]))
+	fi, statErr := os.Stat(path)
+	if statErr == nil && time.Since(fi.ModTime()) < config.Options.CacheTTL {
+		config.DebugLogger.Printf("Using cached %s\n", url)
+		return ioutil.ReadFile(path)
+	}
+
+	config.DebugLogger.Printf("Fetching %s\n", url)
+	data, err := requestRemote(url)
+	if err != nil {
+		if statErr != nil {
+			return nil, err
+		}
+		output.Report.Warn(fmt.Sprintf("%v, using data cached %s", err, fi.ModTime().Format(time.RFC3339)))
+		return ioutil.ReadFile(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func requestRemote(url string) ([]byte, error) {
+	client := &http.Client{Timeout: RemoteTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// getJSON fetches and decodes JSON at build time, e.g.
+// {{ range getJSON "https://api.github.com/repos/o/r/releases" }}.
+func getJSON(url string) (interface{}, error) {
+	data, err := fetchRemote(url)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	return v, nil
+}
+
+// getCSV fetches CSV at build time and returns its rows, the header row
+// included. The separator is a comma unless given, e.g.
+// {{ getCSV "https://example.com/stock.csv" ";" }}.
+func getCSV(url string, sep ...string) ([][]string, error) {
+	data, err := fetchRemote(url)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	if len(sep) > 0 && len(sep[0]) > 0 {
+		r.Comma = []rune(sep[0])[0]
+	}
+	// Rows of feeds aren't always the same length
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,176 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const ShortcodeDirName = "shortcodes"
+
+// shortcodeRe matches {{< name args >}} and {{< /name >}}.
+var shortcodeRe = regexp.MustCompile(`\{\{<\s*(/?)([\w-]+)(.*?)>\}\}`)
+
+// shortcode is the data of a shortcode template.
+type shortcode struct {
+	Name string
+	// Args are the positional arguments, Params the key="value" ones
+	Args   []string
+	Params map[string]string
+	// Inner is the content between opening and closing tags
+	Inner template.HTML
+	Page  *Page
+}
+
+// Get returns a positional argument by index or a named one by key, and an
+// empty string for missing ones.
+func (s shortcode) Get(key interface{}) string {
+	switch k := key.(type) {
+	case int:
+		if k >= 0 && k < len(s.Args) {
+			return s.Args[k]
+		}
+	case string:
+		return s.Params[k]
+	}
+	return ""
+}
+
+// loadShortcodes parses the templates of the shortcodes directory, named by
+// their path without the extension, e.g. shortcodes/youtube.html is used as
+// {{< youtube id >}}.
+func loadShortcodes() (*template.Template, error) {
+	funcs, err := templateFuncs()
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Join(config.InputPath, ShortcodeDirName)
+	set := template.New("").Funcs(funcs)
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))
+		if _, err := set.New(name).Parse(string(b)); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// expandShortcodes replaces the shortcodes in the content of a page with
+// their rendered templates. A shortcode wraps content when a matching
+// {{< /name >}} follows it, unless it is closed in place with {{< name />}}.
+func expandShortcodes(set *template.Template, p *Page, src []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for {
+		loc := shortcodeRe.FindSubmatchIndex(src)
+		if loc == nil {
+			out.Write(src)
+			return out.Bytes(), nil
+		}
+		out.Write(src[:loc[0]])
+		name := string(src[loc[4]:loc[5]])
+		if loc[3] > loc[2] {
+			return nil, fmt.Errorf("closing shortcode %s without an opening one", name)
+		}
+		argText := strings.TrimSpace(string(src[loc[6]:loc[7]]))
+		selfClosing := strings.HasSuffix(argText, "/")
+		args, params, err := parseShortcodeArgs(strings.TrimSuffix(argText, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("shortcode %s: %v", name, err)
+		}
+
+		rest := src[loc[1]:]
+		var inner []byte
+		if !selfClosing {
+			closeRe := regexp.MustCompile(`\{\{<\s*/` + regexp.QuoteMeta(name) + `\s*>\}\}`)
+			if c := closeRe.FindIndex(rest); c != nil {
+				if inner, err = expandShortcodes(set, p, rest[:c[0]]); err != nil {
+					return nil, err
+				}
+				rest = rest[c[1]:]
+			}
+		}
+
+		t := set.Lookup(name)
+		if t == nil {
+			return nil, fmt.Errorf("unknown shortcode %s, add %s", name, filepath.Join(ShortcodeDirName, name+".html"))
+		}
+		data := shortcode{Name: name, Args: args, Params: params, Inner: template.HTML(inner), Page: p}
+		if err := t.Execute(&out, data); err != nil {
+			return nil, err
+		}
+		src = rest
+	}
+}
+
+// parseShortcodeArgs splits shortcode arguments on whitespace. Values can be
+// quoted with double quotes, and key=value pairs are named parameters.
+func parseShortcodeArgs(s string) ([]string, map[string]string, error) {
+	var args []string
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return args, params, nil
+		}
+		key := ""
+		if i := strings.IndexAny(s, "= \t\n\""); i > 0 && s[i] == '=' {
+			key, s = s[:i], s[i+1:]
+		}
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := 1
+			for end < len(s) && (s[end] != '"' || s[end-1] == '\\') {
+				end++
+			}
+			if end == len(s) {
+				return nil, nil, fmt.Errorf("unterminated quote in %s", s)
+			}
+			v, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return nil, nil, err
+			}
+			value, s = v, s[end+1:]
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		if key != "" {
+			params[key] = value
+		} else {
+			args = append(args, value)
+		}
+	}
+}
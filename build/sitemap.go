@@ -0,0 +1,72 @@
+package build
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const SitemapFileName = "sitemap.xml"
+const RobotsFileName = "robots.txt"
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// All returns every indexed page sorted by URL.
+func (idx *pageIndex) All() []*Page {
+	idx.mu.Lock()
+	pages := make([]*Page, len(idx.pages))
+	copy(pages, idx.pages)
+	idx.mu.Unlock()
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].RelPermalink < pages[j].RelPermalink
+	})
+	return pages
+}
+
+// generateSitemap writes sitemap.xml listing every generated page.
+func generateSitemap(pages []*Page) error {
+	set := sitemapURLSet{}
+	for _, p := range pages {
+		u := sitemapURL{Loc: p.Permalink}
+		if !p.SourceModTime.IsZero() {
+			u.LastMod = p.SourceModTime.UTC().Format("2006-01-02T15:04:05Z")
+		}
+		set.URLs = append(set.URLs, u)
+	}
+	return writeXML(filepath.Join(config.Config.Output, SitemapFileName), set)
+}
+
+// generateRobots writes robots.txt from the master config, pointing crawlers
+// to the sitemap.
+func generateRobots(cfg config.Robots) error {
+	var buf bytes.Buffer
+	agent := cfg.UserAgent
+	if agent == "" {
+		agent = "*"
+	}
+	fmt.Fprintf(&buf, "User-agent: %s\n", agent)
+	for _, p := range cfg.Allow {
+		fmt.Fprintf(&buf, "Allow: %s\n", p)
+	}
+	for _, p := range cfg.Disallow {
+		fmt.Fprintf(&buf, "Disallow: %s\n", p)
+	}
+	if len(cfg.Disallow) == 0 && len(cfg.Allow) == 0 {
+		buf.WriteString("Disallow:\n")
+	}
+	fmt.Fprintf(&buf, "\nSitemap: %s/%s\n", strings.TrimSuffix(config.Config.BaseURL, "/"), SitemapFileName)
+	return output.Target.WriteFile(filepath.Join(config.Config.Output, RobotsFileName), buf.Bytes(), 0644)
+}
@@ -0,0 +1,65 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSubpathURLs checks that the sitemap and feeds link the pages of a site
+// deployed at a subpath with that path once.
+func TestSubpathURLs(t *testing.T) {
+	saved := output.Target
+	files := output.NewMemFS()
+	output.Target = files
+	defer func() { output.Target = saved }()
+
+	out := filepath.FromSlash("/out")
+	read := func(name string) string {
+		b, err := files.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	contains := func(name, doc, want string) {
+		if !strings.Contains(doc, want) {
+			t.Errorf("%s lacks %s:\n%s", name, want, doc)
+		}
+		if strings.Contains(doc, "/proj/proj/") {
+			t.Errorf("%s has the subpath twice:\n%s", name, doc)
+		}
+	}
+
+	withConfig(config.Master{BaseURL: "https://example.com/proj/", Output: out}, func() {
+		post := &Page{Title: "Post"}
+		post.RelPermalink, post.Permalink = pageURLs(filepath.FromSlash("blog/post.html"))
+		term := listPage("term", "go", "tags/go")
+		if term.RelPermalink != "/proj/tags/go/index.html" {
+			t.Errorf("term RelPermalink = %q, want %q", term.RelPermalink, "/proj/tags/go/index.html")
+		}
+
+		if err := generateSitemap([]*Page{post, term}); err != nil {
+			t.Fatal(err)
+		}
+		sitemap := read(SitemapFileName)
+		contains("sitemap", sitemap, "<loc>https://example.com/proj/blog/post.html</loc>")
+		contains("sitemap", sitemap, "<loc>https://example.com/proj/tags/go/index.html</loc>")
+
+		job := feedJob{Dir: "blog", Dest: filepath.Join(out, "blog")}
+		if err := generateFeed(job, []*Page{post}); err != nil {
+			t.Fatal(err)
+		}
+		contains("RSS feed", read("blog/"+RSSFileName), "<link>https://example.com/proj/blog/post.html</link>")
+		contains("Atom feed", read("blog/"+AtomFileName), `href="https://example.com/proj/blog/post.html"`)
+
+		// A feed Link of its own replaces the BaseURL
+		job.Cfg.Link = "https://mirror.example.org/"
+		if err := generateFeed(job, []*Page{post}); err != nil {
+			t.Fatal(err)
+		}
+		contains("RSS feed", read("blog/"+RSSFileName), "<link>https://mirror.example.org/blog/post.html</link>")
+	})
+}
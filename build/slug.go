@@ -0,0 +1,48 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// normalizeStaticNames renames the synced static files whose published name
+// differs from their source name. Deeper paths go first, so directories are
+// renamed after their contents.
+func normalizeStaticNames() error {
+	root := filepath.Join(config.Config.Output, config.StaticDirName)
+	var renames []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if p != root && config.SlugName(info.Name()) != info.Name() {
+			renames = append(renames, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(renames, func(i, j int) bool {
+		return strings.Count(renames[i], string(filepath.Separator)) > strings.Count(renames[j], string(filepath.Separator))
+	})
+	for _, p := range renames {
+		dest := filepath.Join(filepath.Dir(p), config.SlugName(filepath.Base(p)))
+		config.DebugLogger.Printf("Rename %s to %s\n", p, path.Base(filepath.ToSlash(dest)))
+		// A file of the normalized name from an earlier sync is replaced
+		if err := os.RemoveAll(dest); err != nil {
+			return err
+		}
+		if err := os.Rename(p, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
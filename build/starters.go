@@ -0,0 +1,158 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const DefaultStarter = "basic"
+
+// starterKit maps project relative paths to file contents.
+type starterKit map[string]string
+
+// Starters are the file sets init can write into a new project.
+var Starters = map[string]starterKit{
+	"empty": {},
+	"basic": {
+		"siteware.master.json": starterMasterConfig,
+		".gitignore":           starterGitignore,
+		"templates/" + config.DefaultTemplateName: starterLayout,
+		"src/index.html": starterIndex,
+	},
+	"blog": {
+		"siteware.master.json": starterMasterConfig,
+		".gitignore":           starterGitignore,
+		"templates/" + config.DefaultTemplateName: starterLayout,
+		"templates/post.template":                 starterPostLayout,
+		"src/index.html":                          starterBlogIndex,
+		"src/siteware.json":                       starterBlogConfig,
+		"src/posts/hello-world.md":                starterPost,
+	},
+}
+
+func StarterNames() []string {
+	names := make([]string, 0, len(Starters))
+	for name := range Starters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeStarter writes the files of a starter kit, leaving existing files
+// untouched.
+func writeStarter(kit starterKit) error {
+	paths := make([]string, 0, len(kit))
+	for path := range kit {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		dest := filepath.Join(config.InputPath, filepath.FromSlash(path))
+		if _, err := os.Stat(dest); err == nil {
+			config.InfoLogger.Printf("Keeping existing %s\n", path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.WriteString(kit[path]); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		config.DebugLogger.Printf("Created %s\n", path)
+	}
+	return nil
+}
+
+const starterMasterConfig = `{
+	"Output": "public",
+	"BaseURL": "http://localhost:8080/"
+}
+`
+
+const starterGitignore = `/public/
+/.siteware-cache/
+`
+
+const starterLayout = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>{{.Title}}</title>
+</head>
+<body>
+	<main>
+		{{template "content" .}}
+	</main>
+</body>
+</html>
+`
+
+const starterIndex = `{{define "content"}}
+<h1>It works!</h1>
+<p>Edit src/index.html and templates/default.template to get started.</p>
+{{end}}
+`
+
+const starterPostLayout = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>{{.Title}}</title>
+	<link rel="alternate" type="application/atom+xml" href="{{relURL "/posts/atom.xml"}}">
+</head>
+<body>
+	<article>
+		<h1>{{.Title}}</h1>
+		{{if not .Date.IsZero}}<time>{{dateFormat "2 January 2006" .Date}}</time>{{end}}
+		{{template "content" .}}
+	</article>
+	<a href="{{relURL "/"}}">Home</a>
+</body>
+</html>
+`
+
+const starterBlogIndex = `{{define "content"}}
+<h1>Blog</h1>
+<p>Posts live in src/posts. Run "siteware new posts/my-post.md" to add one.</p>
+{{end}}
+`
+
+const starterBlogConfig = `{
+	"posts": {
+		"Feed": {
+			"Title": "Blog",
+			"Limit": 20
+		}
+	}
+}
+`
+
+const starterPostsConfig = `{
+	"hello-world.md": {
+		"Template": "post.template"
+	}
+}
+`
+
+const starterPost = `---
+Title: Hello, world
+PublishDate: 2016-01-01
+Summary: The first post.
+---
+
+Welcome to your new blog. This post is written in **Markdown**.
+`
@@ -0,0 +1,71 @@
+package build
+
+import (
+	"bytes"
+	"github.com/Varjelus/siteware/config"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// DefaultSummaryLength is how many words automatic summaries take.
+const DefaultSummaryLength = 70
+
+// ReadingSpeed is the words per minute ReadingTime assumes.
+const ReadingSpeed = 200
+
+// MoreMarker ends the summary of a page where it appears.
+const MoreMarker = "<!--more-->"
+
+// actionRe matches template actions of HTML pages.
+var actionRe = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+
+var (
+	skipTagsRe = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>`)
+	tagRe      = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRe    = regexp.MustCompile(`\s+`)
+)
+
+// contentText is the text of a page body without markup, shortcodes or
+// template actions.
+func contentText(body []byte, markdown bool) string {
+	body = shortcodeRe.ReplaceAll(body, nil)
+	if markdown {
+		body = renderMarkdown(body)
+	} else {
+		body = actionRe.ReplaceAll(body, nil)
+	}
+	return HtmlText(body)
+}
+
+// HtmlText is the text of an HTML document without tags, scripts and
+// styles, its whitespace collapsed.
+func HtmlText(b []byte) string {
+	text := tagRe.ReplaceAll(skipTagsRe.ReplaceAll(b, nil), []byte(" "))
+	return strings.TrimSpace(spaceRe.ReplaceAllString(html.UnescapeString(string(text)), " "))
+}
+
+// contentStats counts the words of a page body and summarizes it by the
+// text before MoreMarker, or else by its first words.
+func contentStats(body []byte, markdown bool) (words int, summary string) {
+	fields := strings.Fields(contentText(body, markdown))
+	if i := bytes.Index(body, []byte(MoreMarker)); i >= 0 {
+		return len(fields), contentText(body[:i], markdown)
+	}
+	n := config.Config.SummaryLength
+	if n <= 0 {
+		n = DefaultSummaryLength
+	}
+	if len(fields) <= n {
+		return len(fields), strings.Join(fields, " ")
+	}
+	return len(fields), strings.Join(fields[:n], " ") + "…"
+}
+
+// readingTime is how many minutes reading words takes, at least one.
+func readingTime(words int) int {
+	if words == 0 {
+		return 0
+	}
+	return (words + ReadingSpeed - 1) / ReadingSpeed
+}
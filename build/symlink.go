@@ -0,0 +1,58 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"os"
+	"path/filepath"
+)
+
+// syncStaticLinks applies the symlink mode to the static directory after
+// syncing it: linked content is copied, or the links recreated.
+func syncStaticLinks() error {
+	mode := config.SymlinkMode()
+	if mode == config.SymlinksIgnore {
+		return nil
+	}
+	root := filepath.Join(config.InputPath, config.StaticDirName)
+	destRoot := filepath.Join(config.Config.Output, config.StaticDirName)
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !config.IsSymlink(info) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(destRoot, rel)
+		if mode == config.SymlinksCopy {
+			return output.CopySymlink(path, dest)
+		}
+
+		// Never write through a link the sync may have made
+		if fi, err := os.Lstat(dest); err == nil && config.IsSymlink(fi) {
+			if err := os.Remove(dest); err != nil {
+				return err
+			}
+		}
+		return config.WalkSource(path, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			linkRel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+			return output.CopyFile(p, filepath.Join(dest, linkRel), fi.Mode())
+		})
+	})
+}
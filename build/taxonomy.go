@@ -0,0 +1,133 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const DefaultTaxonomyTemplate = "taxonomy.template"
+const DefaultTermsTemplate = "terms.template"
+
+var DefaultTaxonomies = map[string]config.Taxonomy{
+	"tags":       {},
+	"categories": {},
+}
+
+// taxonomies returns the configured taxonomies with their names lowercased.
+func taxonomies() map[string]config.Taxonomy {
+	if config.Config.Taxonomies == nil {
+		return DefaultTaxonomies
+	}
+	taxes := make(map[string]config.Taxonomy, len(config.Config.Taxonomies))
+	for name, cfg := range config.Config.Taxonomies {
+		taxes[strings.ToLower(name)] = cfg
+	}
+	return taxes
+}
+
+// generateTaxonomies renders a listing page for every term used by the
+// rendered pages, e.g. /tags/go/index.html, and a page listing the terms,
+// e.g. /tags/index.html, when the respective templates exist.
+func generateTaxonomies(ctx *renderContext) error {
+	pages := ctx.Index.All()
+	var generated []*Page
+
+	for name, cfg := range taxonomies() {
+		tmpl := cfg.Template
+		if tmpl == "" {
+			tmpl = DefaultTaxonomyTemplate
+		}
+		termsTmpl := cfg.TermsTemplate
+		if termsTmpl == "" {
+			termsTmpl = DefaultTermsTemplate
+		}
+
+		terms := make(map[string]*Page)
+		for _, p := range pages {
+			for _, term := range p.Taxonomies[name] {
+				slug := slugify(term)
+				if slug == "" {
+					continue
+				}
+				t, exist := terms[slug]
+				if !exist {
+					t = listPage("term", term, path.Join(name, slug))
+					t.Dir = name
+					t.Site = ctx.Site
+					terms[slug] = t
+				}
+				t.Pages = append(t.Pages, p)
+			}
+		}
+		if len(terms) == 0 {
+			continue
+		}
+		if ctx.Templates.Lookup(tmpl) == nil {
+			config.InfoLogger.Printf("No template %s, skipping %s pages\n", tmpl, name)
+			continue
+		}
+
+		list := listPage("taxonomy", strings.Title(name), name)
+		list.Site = ctx.Site
+
+		for _, t := range terms {
+			sortPagesByDate(t.Pages)
+			if err := renderListPage(ctx, tmpl, t); err != nil {
+				return fmt.Errorf("%s %s: %v", name, t.Title, err)
+			}
+			list.Pages = append(list.Pages, t)
+			generated = append(generated, t)
+		}
+		sort.Slice(list.Pages, func(i, j int) bool {
+			return list.Pages[i].Title < list.Pages[j].Title
+		})
+		if ctx.Templates.Lookup(termsTmpl) != nil {
+			if err := renderListPage(ctx, termsTmpl, list); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			generated = append(generated, list)
+		}
+	}
+
+	for _, p := range generated {
+		ctx.Index.Add(p)
+	}
+	return nil
+}
+
+// listPage creates a generated listing page written to the index.html of
+// dir, a slash separated path relative to the output directory. Its URLs
+// follow the Slugs, UglyURLs and BaseURL settings like those of pages.
+func listPage(kind, title, dir string) *Page {
+	rel := pageOutputPath(path.Join(dir, "index.html"))
+	p := &Page{
+		Kind:  kind,
+		Title: title,
+		Path:  dir,
+		dest:  filepath.Join(config.Config.Output, rel),
+	}
+	p.RelPermalink, p.Permalink = pageURLs(rel)
+	return p
+}
+
+// renderListPage renders a generated page that has no source file.
+func renderListPage(ctx *renderContext, tmpl string, p *Page) error {
+	t, err := ctx.Templates.Clone()
+	if err != nil {
+		return err
+	}
+	bindFuncs(t, ctx, p)
+	config.DebugLogger.Printf("Create %s\n", p.RelPermalink)
+	return executeTemplate(t, tmpl, p.dest, p)
+}
+
+// sortPagesByDate orders pages newest first.
+func sortPagesByDate(pages []*Page) {
+	sort.SliceStable(pages, func(i, j int) bool {
+		return pages[i].Date.After(pages[j].Date)
+	})
+}
@@ -0,0 +1,69 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// loadTemplates parses every file below the templates directory into one
+// shared set, so pages and layouts can refer to each other's definitions.
+// Files are named by their path relative to the templates directory, using
+// forward slashes, e.g. "partials/header.html". The templates of the theme
+// come first, then those of the workspace for its sites, and the project's
+// own replace any of the same name.
+func loadTemplates() (*template.Template, error) {
+	funcs, err := templateFuncs()
+	if err != nil {
+		return nil, err
+	}
+	set := template.New("").Funcs(funcs)
+	theme, err := ThemeDir()
+	if err != nil {
+		return nil, fmt.Errorf("Error loading theme: %v", err)
+	}
+	if theme != "" {
+		if err := parseTemplateDir(set, filepath.Join(theme, config.TemplateDirName)); err != nil {
+			return nil, err
+		}
+	}
+	if config.WorkspacePath != "" {
+		if err := parseTemplateDir(set, filepath.Join(config.WorkspacePath, config.TemplateDirName)); err != nil {
+			return nil, err
+		}
+	}
+	if err := parseTemplateDir(set, filepath.Join(config.InputPath, config.TemplateDirName)); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// parseTemplateDir adds the templates below root to set.
+func parseTemplateDir(set *template.Template, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if _, err := set.New(filepath.ToSlash(rel)).Parse(string(b)); err != nil {
+			return err
+		}
+		return nil
+	})
+}
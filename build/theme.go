@@ -0,0 +1,98 @@
+package build
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ThemeCacheDirName is where themes given as git URLs are cloned, under the
+// cache directory.
+const ThemeCacheDirName = "themes"
+
+// IsGitURL reports whether a theme is a repository rather than a directory.
+func IsGitURL(theme string) bool {
+	return strings.Contains(theme, "://") || strings.HasPrefix(theme, "git@") || strings.HasSuffix(theme, ".git")
+}
+
+// ThemeDir returns the directory of the configured theme, or an empty string
+// without one. Git URLs are cloned on first use, checking out the branch or
+// tag after a # if one is given, e.g. "https://example.com/theme.git#v2".
+// Delete the clone from the cache directory to update it.
+func ThemeDir() (string, error) {
+	theme := config.Config.Theme
+	if theme == "" {
+		return "", nil
+	}
+	if !IsGitURL(theme) {
+		if filepath.IsAbs(theme) {
+			return theme, nil
+		}
+		return filepath.Join(config.InputPath, theme), nil
+	}
+
+	url, ref := theme, ""
+	if i := strings.LastIndex(theme, "#"); i >= 0 {
+		url, ref = theme[:i], theme[i+1:]
+	}
+	sum := sha1.Sum([]byte(theme))
+	name := strings.TrimSuffix(path.Base(url), ".git") + "-" + hex.EncodeToString(sum[:4])
+	dir := filepath.Join(config.InputPath, assets.CacheDirName, ThemeCacheDirName, name)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+	config.InfoLogger.Printf("Cloning theme %s...\n", theme)
+	args := []string{"clone", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	if err := config.Run("", nil, "git", append(args, url, dir)...); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// syncThemeStatic copies the static files of the theme the project doesn't
+// have itself.
+func syncThemeStatic() error {
+	dir, err := ThemeDir()
+	if err != nil || dir == "" {
+		return err
+	}
+	root := filepath.Join(dir, config.StaticDirName)
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || config.IsConfigFile(info.Name(), config.DirConfigBaseName) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if config.Ignored(filepath.Join(config.StaticDirName, rel), false) {
+			return nil
+		}
+		// Project files override the theme
+		if _, err := os.Stat(filepath.Join(config.InputPath, config.StaticDirName, rel)); err == nil {
+			return nil
+		}
+		dest := filepath.Join(config.Config.Output, config.StaticDirName, rel)
+		if fi, err := os.Stat(dest); err == nil && !fi.ModTime().Before(info.ModTime()) && fi.Size() == info.Size() {
+			return nil
+		}
+		config.DebugLogger.Printf("Copy theme file %s\n", rel)
+		return output.CopyFile(p, dest, info.Mode())
+	})
+}
@@ -0,0 +1,124 @@
+package build
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"net/url"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// permalink returns the root-relative URL of the page generated from a
+// source file, e.g. "blog/post.md" becomes "/blog/post.html", or "/blog/post/"
+// with UglyURLs off.
+func permalink(src string) string {
+	return config.RelURL(outputURL(pageOutputPath(src)))
+}
+
+// pathSyntax is how an OS writes paths. Path mapping takes it as input so
+// that it works, and is tested, the same for the paths of any OS anywhere.
+type pathSyntax struct {
+	Sep byte
+	// Fold compares paths case-insensitively
+	Fold bool
+}
+
+var (
+	unixPaths    = pathSyntax{Sep: '/'}
+	windowsPaths = pathSyntax{Sep: '\\', Fold: true}
+	// localPaths are those of the OS siteware runs on
+	localPaths = pathSyntax{Sep: filepath.Separator, Fold: runtime.GOOS == "windows"}
+)
+
+func (s pathSyntax) toSlash(p string) string {
+	return strings.Replace(p, string(s.Sep), "/", -1)
+}
+
+func (s pathSyntax) fromSlash(p string) string {
+	return strings.Replace(p, "/", string(s.Sep), -1)
+}
+
+// rel returns the path of p below root, slash separated. Rather than
+// trimming root off p as is, both are cleaned first, as on Windows the two
+// can differ in case or separators.
+func (s pathSyntax) rel(root, p string) (string, error) {
+	root, p = path.Clean(s.toSlash(root)), path.Clean(s.toSlash(p))
+	equal := func(a, b string) bool { return a == b || s.Fold && strings.EqualFold(a, b) }
+	if equal(root, p) {
+		return ".", nil
+	}
+	prefix := root
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if len(p) > len(prefix) && equal(p[:len(prefix)], prefix) {
+		return p[len(prefix):], nil
+	}
+	return "", fmt.Errorf("%s is not below %s", p, root)
+}
+
+// pageOutputPath maps a page path relative to the source directory to the
+// path of the generated file relative to the output directory.
+func (s pathSyntax) pageOutputPath(rel string) string {
+	rel = config.OutputName(localizePath(s.toSlash(rel)))
+	ext := path.Ext(rel)
+	if config.IsMarkdown(rel) {
+		rel = strings.TrimSuffix(rel, ext) + ".html"
+		ext = ".html"
+	}
+	if config.Config.PrettyURLs() && config.IsHTML(rel) && !strings.EqualFold(path.Base(rel), "index"+ext) {
+		rel = path.Join(strings.TrimSuffix(rel, ext), "index.html")
+	}
+	return s.fromSlash(rel)
+}
+
+// sourceRel returns the path of p relative to root, slash separated for
+// matching and for URLs.
+func sourceRel(root, p string) (string, error) {
+	return localPaths.rel(root, p)
+}
+
+// pageOutputPath maps a page path relative to the source directory to the
+// path of the generated file relative to the output directory.
+func pageOutputPath(rel string) string {
+	return localPaths.pageOutputPath(rel)
+}
+
+// outputURL turns a path relative to the output directory into a site path.
+// With pretty URLs index pages are linked by their directory.
+func outputURL(rel string) string {
+	u := path.Join("/", filepath.ToSlash(rel))
+	if config.Config.PrettyURLs() && path.Base(u) == "index.html" {
+		u = strings.TrimSuffix(u, "index.html")
+	}
+	return u
+}
+
+// pageURLs returns the RelPermalink and the Permalink of the file at rel,
+// relative to the output directory. Like relURL and absURL, both carry the
+// path of the BaseURL.
+func pageURLs(rel string) (string, string) {
+	u := outputURL(rel)
+	return config.RelURL(u), config.AbsURL(u)
+}
+
+// siteURLPath strips the path of the BaseURL off a root-relative URL, which
+// leaves the path within the site, like outputURL returns. Other URLs are
+// returned as they are.
+func siteURLPath(u string) string {
+	prefix := ""
+	if base, err := url.Parse(config.Config.BaseURL); err == nil {
+		prefix = strings.TrimSuffix(base.Path, "/")
+	}
+	switch {
+	case prefix == "":
+		return u
+	case u == prefix:
+		return "/"
+	case strings.HasPrefix(u, prefix+"/"):
+		return strings.TrimPrefix(u, prefix)
+	}
+	return u
+}
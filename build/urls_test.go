@@ -0,0 +1,131 @@
+package build
+
+import (
+	"github.com/Varjelus/siteware/config"
+	"path/filepath"
+	"testing"
+)
+
+// pathCase is a path mapping fixture, of Unix paths unless it names
+// another OS. Every case runs on every OS.
+type pathCase struct {
+	os   string
+	in   []string
+	want string
+	err  bool
+}
+
+func (c pathCase) syntax() pathSyntax {
+	if c.os == "windows" {
+		return windowsPaths
+	}
+	return unixPaths
+}
+
+// withConfig runs f with cfg as the configuration.
+func withConfig(cfg config.Master, f func()) {
+	saved := config.Config
+	config.Config = cfg
+	defer func() { config.Config = saved }()
+	f()
+}
+
+func TestSourceRel(t *testing.T) {
+	cases := []pathCase{
+		{in: []string{"/site/src", "/site/src/blog/post.md"}, want: "blog/post.md"},
+		{in: []string{"/site/src/", "/site/src/blog"}, want: "blog"},
+		{in: []string{"/site/src", "/site/src"}, want: "."},
+		{in: []string{"site/src", "site/src/a b/c.md"}, want: "a b/c.md"},
+		{os: "windows", in: []string{`C:\site\src`, `C:\site\src\blog\post.md`}, want: "blog/post.md"},
+		{os: "windows", in: []string{`c:\Site\src`, `C:\site\SRC\blog\post.md`}, want: "blog/post.md"},
+		{os: "windows", in: []string{`C:/site/src`, `C:\site\src\blog\post.md`}, want: "blog/post.md"},
+		{os: "windows", in: []string{`C:\site\src\`, `C:\site\src\index.md`}, want: "index.md"},
+		{os: "windows", in: []string{`\\server\share\src`, `\\server\share\src\a\b.md`}, want: "a/b.md"},
+		{os: "windows", in: []string{`C:\site\src`, `D:\site\src\a.md`}, err: true},
+		{in: []string{"/site/src", "/site/srcs/a.md"}, err: true},
+		{in: []string{`C:\site\src`, `C:\site\src\a.md`}, err: true},
+	}
+	for _, c := range cases {
+		got, err := c.syntax().rel(c.in[0], c.in[1])
+		if c.err {
+			if err == nil {
+				t.Errorf("rel(%q, %q) = %q, want an error", c.in[0], c.in[1], got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("rel(%q, %q) = %q, %v, want %q", c.in[0], c.in[1], got, err, c.want)
+		}
+	}
+}
+
+func TestPageOutputPath(t *testing.T) {
+	ugly := []pathCase{
+		{in: []string{"index.md"}, want: "index.html"},
+		{in: []string{"blog/post.md"}, want: "blog/post.html"},
+		{in: []string{"blog/post.MD"}, want: "blog/post.html"},
+		{in: []string{"about.html"}, want: "about.html"},
+		{os: "windows", in: []string{`blog\post.md`}, want: "blog/post.html"},
+		{os: "windows", in: []string{`blog\2024\post.md`}, want: "blog/2024/post.html"},
+		{os: "windows", in: []string{`notes.d\post.md`}, want: "notes.d/post.html"},
+		{in: []string{`notes.d/post\a.md`}, want: `notes.d/post\a.html`},
+	}
+	pretty := []pathCase{
+		{in: []string{"blog/post.md"}, want: "blog/post/index.html"},
+		{in: []string{"blog/index.md"}, want: "blog/index.html"},
+		{os: "windows", in: []string{`blog\post.md`}, want: "blog/post/index.html"},
+		{os: "windows", in: []string{`blog\index.html`}, want: "blog/index.html"},
+	}
+	run := func(cases []pathCase) {
+		for _, c := range cases {
+			s := c.syntax()
+			if got, want := s.pageOutputPath(c.in[0]), s.fromSlash(c.want); got != want {
+				t.Errorf("pageOutputPath(%q) = %q, want %q", c.in[0], got, want)
+			}
+		}
+	}
+	withConfig(config.Master{}, func() { run(ugly) })
+	no := false
+	withConfig(config.Master{UglyURLs: &no}, func() { run(pretty) })
+}
+
+func TestPageURLs(t *testing.T) {
+	no := false
+	cases := []struct {
+		baseURL      string
+		ugly         bool
+		rel          string
+		relPermalink string
+		permalink    string
+	}{
+		{"https://example.com/", true, "blog/post.html", "/blog/post.html", "https://example.com/blog/post.html"},
+		{"https://example.com/proj/", true, "blog/post.html", "/proj/blog/post.html", "https://example.com/proj/blog/post.html"},
+		{"https://example.com/proj", true, "index.html", "/proj/index.html", "https://example.com/proj/index.html"},
+		{"https://example.com/proj/", false, "blog/post/index.html", "/proj/blog/post/", "https://example.com/proj/blog/post/"},
+		{"https://example.com/proj/", false, "index.html", "/proj/", "https://example.com/proj/"},
+		{"", true, "about.html", "/about.html", "/about.html"},
+	}
+	for _, c := range cases {
+		cfg := config.Master{BaseURL: c.baseURL}
+		if !c.ugly {
+			cfg.UglyURLs = &no
+		}
+		withConfig(cfg, func() {
+			rel, abs := pageURLs(filepath.FromSlash(c.rel))
+			if rel != c.relPermalink || abs != c.permalink {
+				t.Errorf("pageURLs(%q) with BaseURL %q = %q, %q, want %q, %q", c.rel, c.baseURL, rel, abs, c.relPermalink, c.permalink)
+			}
+			// The path within the site is the same for every BaseURL
+			if got, want := siteURLPath(rel), outputURL(filepath.FromSlash(c.rel)); got != want {
+				t.Errorf("siteURLPath(%q) with BaseURL %q = %q, want %q", rel, c.baseURL, got, want)
+			}
+		})
+	}
+	withConfig(config.Master{BaseURL: "https://example.com/proj/"}, func() {
+		for _, u := range []string{"/project/a.html", "/other/", "https://example.com/proj/a.html"} {
+			if got := siteURLPath(u); got != u {
+				t.Errorf("siteURLPath(%q) = %q, want it unchanged", u, got)
+			}
+		}
+	})
+}
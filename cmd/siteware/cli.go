@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// commandNames returns the registered commands in alphabetical order.
+func commandNames() []string {
+	names := make([]string, 0, len(Commands))
+	for name := range Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// usage prints the global flags and the list of commands.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [global flags] <command> [flags] [arguments]\n\nCommands:\n", os.Args[0])
+	for _, name := range commandNames() {
+		fmt.Fprintf(out, "  %-10s %s\n", name, Commands[name].Description)
+	}
+	fmt.Fprintln(out, "\nGlobal flags:")
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nRun \"%s help <command>\" for the flags of a command.\n", os.Args[0])
+}
+
+// commandFlags creates the flag set of a command with its help output.
+func commandFlags(name string, cmd command) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	if cmd.Flags != nil {
+		cmd.Flags(flags)
+	}
+	flags.Usage = func() {
+		out := flags.Output()
+		synopsis := name
+		if cmd.Flags != nil {
+			synopsis += " [flags]"
+		}
+		if cmd.Usage != "" {
+			synopsis += " " + cmd.Usage
+		}
+		fmt.Fprintf(out, "Usage: %s %s\n\n%s\n", os.Args[0], synopsis, cmd.Description)
+		if cmd.Flags != nil {
+			fmt.Fprintln(out, "\nFlags:")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+func help(args []string) error {
+	if len(args) == 0 {
+		flag.CommandLine.SetOutput(os.Stdout)
+		usage()
+		return nil
+	}
+	cmd, exist := Commands[args[0]]
+	if !exist {
+		usage()
+		return fmt.Errorf("Unknown command \"%s\"", args[0])
+	}
+	flags := commandFlags(args[0], cmd)
+	flags.SetOutput(os.Stdout)
+	flags.Usage()
+	return nil
+}
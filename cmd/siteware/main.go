@@ -0,0 +1,224 @@
+// Command siteware builds, serves and publishes siteware projects. Run
+// "siteware help" for its commands.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Varjelus/siteware/build"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/server"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type command struct {
+	// F runs the command with the arguments following its flags
+	F           func(args []string) error
+	Description string
+	// Flags registers the flags of the command, if it has any
+	Flags func(flags *flag.FlagSet)
+	// Usage lists positional arguments for help, e.g. "<path>"
+	Usage string
+}
+
+var Commands = make(map[string]command)
+
+// noArgs adapts a command without arguments.
+func noArgs(f func() error) func(args []string) error {
+	return func(args []string) error { return f() }
+}
+
+func init() {
+	Commands["init"] = command{
+		F:           noArgs(build.Initialize),
+		Description: "Initializes a new project with starter files at current directory.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.StringVar(&build.InitOptions.Starter, "starter", build.DefaultStarter, "starter kit: "+strings.Join(build.StarterNames(), ", "))
+		},
+	}
+	Commands["build"] = command{
+		F:           noArgs(build.BuildSites),
+		Description: "Builds files from current directory to the one specified in configuration.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.BoolVar(&config.Options.All, "all", false, "build every site of the workspace")
+			flags.BoolVar(&config.Options.Fetch, "fetch", false, "pull remote content from the fetch sources in configuration first")
+			addBuildFlags(flags)
+		},
+	}
+	Commands["watch"] = command{
+		F:           noArgs(server.Watch),
+		Description: "Builds files and rebuilds them whenever the sources change.",
+		Flags:       addBuildFlags,
+	}
+	Commands["bench"] = command{
+		F:           noArgs(build.Bench),
+		Description: "Renders the site repeatedly in memory and reports render times by template and page.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.IntVar(&build.BenchOptions.Runs, "runs", build.DefaultBenchRuns, "how many times to render the site")
+			flags.IntVar(&build.BenchOptions.Top, "top", build.DefaultBenchTop, "how many of the slowest pages to list, 0 for all")
+			addBuildFlags(flags)
+		},
+	}
+	Commands["graph"] = command{
+		F:           build.Graph,
+		Description: "Prints the templates and data files each page is rendered from.",
+		Usage:       "[page...]",
+		Flags: func(flags *flag.FlagSet) {
+			flags.StringVar(&build.GraphOptions.Format, "format", "text", "output format: "+strings.Join(build.GraphFormats, ", "))
+			addBuildFlags(flags)
+		},
+	}
+	Commands["check"] = command{
+		F:           noArgs(build.Check),
+		Description: "Validates configuration files and reports problems.",
+	}
+	Commands["a11y"] = command{
+		F:           noArgs(build.A11y),
+		Description: "Checks the built pages for missing alt text and labels, skipped headings and low contrast.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.StringVar(&build.A11yOptions.FailOn, "fail-on", "error", "fail on problems of this severity or higher: "+strings.Join(build.SeverityNames, ", "))
+		},
+	}
+	Commands["proof"] = command{
+		F:           noArgs(build.Proof),
+		Description: "Spell checks the text of the built pages and reports repeated words and phrases to avoid, by file and line.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.BoolVar(&build.ProofOptions.Sources, "sources", false, "check the Markdown pages of the source directory instead")
+		},
+	}
+	Commands["audit"] = command{
+		F:           noArgs(build.Audit),
+		Description: "Reports mixed content and insecure links in the built pages and suggests a Content-Security-Policy.",
+	}
+	Commands["check-links"] = command{
+		F:           noArgs(build.CheckLinks),
+		Description: "Reports links, images and anchors in the built pages that lead nowhere.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.BoolVar(&build.LinkCheckOptions.External, "external", false, "request outbound links too")
+			flags.BoolVar(&build.LinkCheckOptions.NoCache, "no-cache", false, "check outbound links again even if they worked recently")
+		},
+	}
+	Commands["clean"] = command{
+		F:           noArgs(build.Clean),
+		Description: "Clears the output directory, keeping the files listed in configuration.",
+	}
+	Commands["fetch"] = command{
+		F:           build.Fetch,
+		Description: "Pulls remote content into the source and data directories from the sources in configuration.",
+		Usage:       "[source...]",
+	}
+	Commands["diff"] = command{
+		F:           build.Diff,
+		Description: "Lists the output files added, changed or removed since a manifest written with build --manifest.",
+		Usage:       "<old-manifest> [new-manifest]",
+	}
+	Commands["deploy"] = command{
+		F:           noArgs(build.Deploy),
+		Description: "Publishes the output directory to the target specified in configuration.",
+	}
+	Commands["serve"] = command{
+		F:           noArgs(server.Serve),
+		Description: "Builds and serves the site with HTTP, reloading pages when sources change. Directories without a project are served as they are.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.IntVar(&server.ServeOptions.Port, "port", 0, "port to listen on (default from config or 8080)")
+			flags.StringVar(&server.ServeOptions.Addr, "addr", "", "address to bind to, e.g. 127.0.0.1 (default all interfaces)")
+			flags.StringVar(&server.ServeOptions.TLSCert, "tls-cert", "", "serve HTTPS and HTTP/2 with this certificate file")
+			flags.StringVar(&server.ServeOptions.TLSKey, "tls-key", "", "private key file of --tls-cert")
+			flags.BoolVar(&server.ServeOptions.SelfSigned, "tls-self-signed", false, "serve HTTPS with a generated certificate for localhost")
+			flags.BoolVar(&server.ServeOptions.Raw, "raw", false, "serve the project directory instead of the build output")
+			flags.BoolVar(&server.ServeOptions.Memory, "memory", false, "build into memory and serve from there, leaving the output directory alone")
+			flags.BoolVar(&server.ServeOptions.RebuildOnRequest, "rebuild-on-request", false, "rebuild before serving a page if the sources changed")
+			flags.StringVar(&server.ServeOptions.SPAFallback, "spa-fallback", "", "page to serve for paths that don't exist, e.g. index.html")
+			flags.BoolVar(&server.ServeOptions.Search, "search", false, "answer "+server.SearchPath+"?q= with matching pages as JSON")
+			addBuildFlags(flags)
+		},
+	}
+	Commands["publish"] = command{
+		F:           noArgs(build.Publish),
+		Description: "Builds the site and pushes the output repository to GitHub Pages.",
+		Flags:       addBuildFlags,
+	}
+	Commands["new"] = command{
+		F:           build.CreatePage,
+		Description: "Creates a source page from an archetype.",
+		Usage:       "<path>",
+		Flags: func(flags *flag.FlagSet) {
+			flags.StringVar(&build.NewPageOptions.Template, "template", "", "template for the page, added to the directory config")
+			flags.BoolVar(&build.NewPageOptions.Entry, "entry", false, "add an entry for the page to the directory config")
+		},
+	}
+	Commands["help"] = command{
+		F:           help,
+		Description: "Shows the commands, or the flags of one command.",
+		Usage:       "[command]",
+	}
+}
+
+func main() {
+	// Global flags come before the command
+	flag.Usage = usage
+	verbose := flag.Bool("verbose", false, "log every file processed")
+	quiet := flag.Bool("quiet", false, "log errors only")
+	logFormat := flag.String("log-format", "text", "log output format, text or json")
+	flag.StringVar(&config.ConfigPath, "config", "", "path of the master config file")
+	flag.StringVar(&config.Env, "env", "", "environment whose overlay of the master config to use, e.g. production")
+	flag.StringVar(&config.InputPath, "source", ".", "project directory")
+	flag.StringVar(&config.OutputPath, "output", "", "output directory, overriding the configuration")
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile to this file")
+	memProfile := flag.String("memprofile", "", "write a heap profile to this file when done")
+	flag.Parse()
+	if err := config.SetLogging(*verbose, *quiet, *logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	var err error
+	if config.InputPath, err = filepath.Abs(config.InputPath); err != nil {
+		config.ErrorLogger.Fatalf("Error resolving input path %s: %v\n", config.InputPath, err)
+	}
+	if config.OutputPath != "" {
+		if config.OutputPath, err = filepath.Abs(config.OutputPath); err != nil {
+			config.ErrorLogger.Fatalf("Error resolving output path %s: %v\n", config.OutputPath, err)
+		}
+	}
+
+	// Run a command
+	if flag.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Please provide a command")
+		usage()
+		os.Exit(2)
+	}
+	cmdStr := flag.Arg(0)
+	cmd, exist := Commands[cmdStr]
+	if !exist {
+		fmt.Fprintf(os.Stderr, "Unknown command \"%s\".\n", cmdStr)
+		usage()
+		os.Exit(2)
+	}
+	flags := commandFlags(cmdStr, cmd)
+	flags.Parse(flag.Args()[1:])
+	if err := config.SelectSite(); err != nil {
+		config.ErrorLogger.Fatalln(err)
+	}
+	stopProfiling, err := startProfiling(*cpuProfile, *memProfile)
+	if err != nil {
+		config.ErrorLogger.Fatalln(err)
+	}
+	err = cmd.F(flags.Args())
+	// Fatalln exits without running deferred calls
+	stopProfiling()
+	if err != nil {
+		config.ErrorLogger.Fatalln(err)
+	}
+}
+
+func addBuildFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&config.Options.Drafts, "drafts", false, "include pages marked as drafts")
+	flags.BoolVar(&config.Options.Future, "future", false, "include pages with a publish date in the future")
+	flags.BoolVar(&config.Options.Dev, "dev", false, "development build with stylesheet source maps, always on for watch and serve")
+	flags.StringVar(&config.Options.Report, "report", "", "write a JSON report of the build to this file")
+	flags.StringVar(&config.Options.Manifest, "manifest", "", "write the content hashes of the output files to this JSON file")
+	flags.StringVar(&config.Options.Site, "site", "", "build the site of this name in the "+config.SitesDirName+" directory of a workspace")
+	flags.DurationVar(&config.Options.CacheTTL, "cache-ttl", build.DefaultRemoteCacheTTL, "how long to reuse data templates fetched with getJSON and getCSV, 0 to fetch it again")
+}
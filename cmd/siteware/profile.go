@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling starts CPU profiling to cpuPath if set. The returned
+// function stops it and writes a heap profile to memPath if set.
+func startProfiling(cpuPath, memPath string) (func(), error) {
+	var cpuFile *os.File
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("Error starting CPU profile: %v", err)
+		}
+		cpuFile = f
+	}
+
+	return func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+		if memPath == "" {
+			return
+		}
+		f, err := os.Create(memPath)
+		if err != nil {
+			config.ErrorLogger.Printf("Error creating heap profile: %v\n", err)
+			return
+		}
+		defer f.Close()
+		// Up to date statistics of what is still allocated
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			config.ErrorLogger.Printf("Error writing heap profile: %v\n", err)
+		}
+	}, nil
+}
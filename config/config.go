@@ -0,0 +1,342 @@
+// Package config reads the master config and the directory configs of a
+// project, and holds the paths and options builds run with.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Master is the master config of a project, siteware.master.json or one
+// of the other ConfigExts.
+type Master struct {
+	Output      string
+	Concurrency int
+	// ImageConcurrency limits how many images are processed at once,
+	// defaulting to Concurrency
+	ImageConcurrency int
+	// ImageMemory is roughly how many megabytes decoded images may take
+	// at once, 1024 by default
+	ImageMemory int
+	Port        int
+	Addr        string
+	// Absolute URL the site is deployed at
+	BaseURL string
+	// Drafts and Future publish drafts and pages dated in the future, like
+	// the flags of the same name. Mostly useful in an environment overlay.
+	Drafts bool
+	Future bool
+	Robots *Robots
+	Deploy *Deploy
+	// Fetch names the sources the fetch command pulls content from
+	Fetch map[string]Fetch
+	// Names in the output directory left alone when clearing it
+	Preserve []string
+	// Taxonomies maps taxonomy names to their settings. Defaults to tags
+	// and categories.
+	Taxonomies map[string]Taxonomy
+	// Minify enables minifying generated pages and static stylesheets and
+	// scripts
+	Minify *Minify
+	// PostProcess passes the generated pages through HTML processors
+	PostProcess *PostProcess
+	// Injections are snippets added to every generated page
+	Injections []Injection
+	// Compress writes gzip and Brotli variants of the output files
+	Compress *Compress
+	// Languages lists the language codes of a multilingual site, the
+	// default language first
+	Languages []string
+	// Serve sets headers and error pages of the serve command
+	Serve *Serve
+	// Sass configures compiling stylesheets, which needs Dart Sass
+	Sass *Sass
+	// Video enables poster frames of videos, which needs ffmpeg
+	Video *Video
+	// Images maps image directories, relative to the static directory, to
+	// named derivatives like the directory config setting does
+	Images map[string]map[string]Thumbnail
+	// ImageCDN links derivatives to an image CDN instead of generating
+	// them
+	ImageCDN *ImageCDN
+	// ImageExts are the extensions of the images derivatives are made of,
+	// see assets.DefaultImageExts
+	ImageExts []string
+	// ContentExts are the extensions of the pages of the source directory
+	// rendered as templates, besides Markdown. See DefaultContentExts.
+	ContentExts []string
+	// Exclude lists patterns of files of the source directory that aren't
+	// copied to the output, matching names or paths relative to the source
+	// directory. Defaults to build.DefaultExclude.
+	Exclude []string
+	// Redirects and Headers are written in the formats of the Hosts,
+	// "netlify" or "vercel", and applied by serve. Headers maps URL path
+	// patterns to response headers.
+	Redirects []Redirect
+	Headers   map[string]map[string]string
+	Hosts     []string
+	// Menus maps menu names to their entries, exposed with those pages
+	// add in front matter as .Site.Menus
+	Menus map[string][]*Menu
+	// OpenGraph sets the site name and defaults of build.ogTags
+	OpenGraph *OpenGraph
+	// GitHubPages writes .nojekyll and CNAME and configures publish
+	GitHubPages *GitHubPages
+	// LinkCheck configures checking outbound links with check-links
+	LinkCheck *LinkCheck
+	// Proof configures the spell checker and style lint of the proof
+	// command
+	Proof *Proof
+	// Hooks are shell commands run before and after builds
+	Hooks *Hooks
+	// Ignore lists gitignore style patterns, relative to the project
+	// directory, of files and directories the build skips entirely
+	Ignore []string
+	// Symlinks is "follow" to publish what links point to, the default,
+	// "copy" to recreate the links in the output or "ignore"
+	Symlinks string
+	// Theme is a directory, relative to the project, or a git URL whose
+	// templates and static files are used unless the project has its own
+	Theme string
+	// Slugs normalizes the names of published pages and files
+	Slugs *Slugs
+	// SummaryLength is how many words summaries taken from the content
+	// have, build.DefaultSummaryLength by default
+	SummaryLength int
+	// ThumbDir names the directory AutoThumbnail writes thumbnails to,
+	// next to the images. Defaults to ".thumbs".
+	ThumbDir string
+	// UglyURLs set to false writes about.html as about/index.html, so it
+	// is linked as /about/. Defaults to true.
+	UglyURLs *bool
+}
+
+// ThumbDirName is the name of the AutoThumbnail derivative.
+func (c Master) ThumbDirName() string {
+	if c.ThumbDir == "" {
+		return DefaultThumbDirName
+	}
+	return c.ThumbDir
+}
+
+// PrettyURLs reports whether pages get a directory of their own.
+func (c Master) PrettyURLs() bool {
+	return c.UglyURLs != nil && !*c.UglyURLs
+}
+
+// Dir is a directory config, the entries of its files by name.
+type Dir map[string]File
+
+// File is the directory config entry of a file.
+type File struct {
+	Template      string
+	Data          interface{}
+	AutoThumbnail map[string]Thumbnail
+	// Images maps image directories, relative to the static directory, to
+	// named derivatives such as "medium" or "square". Each derivative is
+	// written to a subdirectory of that name, AutoThumbnail being the one
+	// named after the ThumbDir setting.
+	Images      map[string]map[string]Thumbnail
+	Draft       bool
+	PublishDate time.Time
+	// Feed enables RSS and Atom feeds for a directory entry
+	Feed *Feed
+	// AutoIndex names a template to generate index.html with for a
+	// directory entry that has no index page
+	AutoIndex string
+	// Archive names a template to generate year and month archive pages
+	// with for a directory entry, listing the pages below it by date
+	Archive string
+	// Schema lists the schema.org types of a page for jsonld: "Article",
+	// "BreadcrumbList" or "ImageGallery"
+	Schema []string
+	// Password encrypts the rendered page, which the browser decrypts
+	// when given the password. "${NAME}" reads it from the environment.
+	Password string
+	// Aliases are old URL paths of a page, which get redirecting pages
+	Aliases []string
+	// Paginate splits the pages of the directory over listing pages of
+	// this many pages each, exposed to templates as .Paginator
+	Paginate int
+	// Order is how .NextPage and .PrevPage order a page among the others,
+	// "date", the default, or "name"
+	Order string
+}
+
+// BuildOptions are the flags of the build command.
+type BuildOptions struct {
+	Drafts bool
+	Future bool
+	// Dev builds are for local previews
+	Dev bool
+	// Report is where build writes its report as JSON
+	Report string
+	// Manifest is where build writes the hashes of the output files
+	Manifest string
+	// Site selects a site of a workspace, All builds every one
+	Site string
+	All  bool
+	// Fetch pulls remote content before building
+	Fetch bool
+	// CacheTTL is how long data fetched by templates is reused
+	CacheTTL time.Duration
+}
+
+// Config is the master config of the project being built, read by Load.
+var Config Master
+
+// Options are those given on the command line, which builds get with
+// their other options from build.CommandOptions.
+var Options BuildOptions
+
+// ConfigPath overrides the location of the master config file.
+var ConfigPath string
+var DefaultDirConfig = make(map[string]File)
+
+// DefaultEntryName is the directory config entry that applies to every file
+// without an entry of its own, in the directory and below it.
+const DefaultEntryName = "*"
+
+// InputPath is the project directory, the working directory unless --source
+// is given.
+var InputPath = "."
+
+// OutputPath overrides the Output directory of the master config.
+var OutputPath string
+
+const DefaultPort = 8080
+
+const StaticDirName = "static"
+const SourceDirName = "src"
+const TemplateDirName = "templates"
+const DirConfigBaseName = "siteware"
+const DefaultTemplateName = "default.template"
+const ContentTemplateName = "content"
+const ConfigBaseName = "siteware.master"
+const DefaultThumbDirName = ".thumbs"
+
+// LegacyThumbDirName is where thumbnails went before ThumbDir existed.
+const LegacyThumbDirName = "thumbnails"
+
+var DefaultPreserve = []string{".git", StaticDirName, ".gitignore", "CNAME"}
+
+// MasterPath returns the path of the master config file, either given
+// with --config or found in the project directory.
+func MasterPath() (string, error) {
+	if ConfigPath != "" {
+		if _, err := os.Stat(ConfigPath); err != nil {
+			return "", err
+		}
+		return ConfigPath, nil
+	}
+	return FindConfigFile(InputPath, ConfigBaseName)
+}
+
+// Load reads the master config into Config.
+func Load() error {
+	cfgPath, err := MasterPath()
+	if err != nil {
+		return fmt.Errorf("Error opening config file: %v", err)
+	}
+	var cfg Master
+	if err := DecodeMaster(cfgPath, &cfg); err != nil {
+		return fmt.Errorf("Error decoding config file %v", err)
+	}
+	// A relative Output is relative to the project, not the working directory
+	if OutputPath != "" {
+		cfg.Output = OutputPath
+	} else if cfg.Output != "" && !filepath.IsAbs(cfg.Output) {
+		cfg.Output = filepath.Join(InputPath, cfg.Output)
+	}
+	Config = cfg
+	return nil
+}
+
+// ReadDirConfig loads the config of a source directory. Configs cascade:
+// the DefaultEntryName entries of the parent directories apply to every
+// file below them, each level overriding single keys of the one above, and
+// the entry of a file overrides keys of the defaults.
+func ReadDirConfig(dir string) (Dir, error) {
+	dirs := []string{dir}
+	root := filepath.Join(InputPath, SourceDirName)
+	if rel, err := filepath.Rel(root, dir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		dirs = []string{root}
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			dirs = append(dirs, filepath.Join(dirs[len(dirs)-1], name))
+		}
+	}
+
+	var defaults interface{}
+	var entries map[string]interface{}
+	for _, d := range dirs {
+		path, err := FindConfigFile(d, DirConfigBaseName)
+		if err != nil {
+			if os.IsNotExist(err) {
+				entries = nil
+				continue
+			}
+			return nil, err
+		}
+		raw, err := ReadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		entries, _ = raw.(map[string]interface{})
+		if def, exist := entries[DefaultEntryName]; exist {
+			defaults = mergeConfig(defaults, def)
+		}
+	}
+	if defaults == nil && entries == nil {
+		// If there is no config file, use defaults
+		return DefaultDirConfig, nil
+	}
+
+	merged := make(map[string]interface{}, len(entries)+1)
+	for name, entry := range entries {
+		merged[name] = mergeConfig(defaults, entry)
+	}
+	if defaults != nil {
+		merged[DefaultEntryName] = defaults
+	}
+	var cfg Dir
+	if err := Convert(merged, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	return cfg, nil
+}
+
+// Lookup returns the entry for a file. Keys can be glob patterns such as
+// "*.md" or "post-*.html": an exact name wins over patterns, and the longest
+// matching pattern over shorter ones. Files matching nothing get the
+// directory defaults.
+func (c Dir) Lookup(name string) (File, bool) {
+	if fcfg, exist := c[name]; exist {
+		return fcfg, true
+	}
+	best := ""
+	for key := range c {
+		if key == DefaultEntryName || !IsGlob(key) {
+			continue
+		}
+		if match, _ := path.Match(key, name); !match {
+			continue
+		}
+		if len(key) > len(best) || (len(key) == len(best) && key < best) {
+			best = key
+		}
+	}
+	if best != "" {
+		return c[best], true
+	}
+	fcfg, exist := c[DefaultEntryName]
+	return fcfg, exist
+}
+
+// IsGlob reports whether a directory config key is a pattern.
+func IsGlob(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func ContainsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+const DataDirName = "data"
+
+// DecodeFile decodes a JSON, YAML or TOML file into v, picking the format by
+// the file extension.
+func DecodeFile(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err = json.Unmarshal(b, v); err != nil {
+			// Point at the offending spot, YAML and TOML errors already do
+			var offset int64 = -1
+			switch e := err.(type) {
+			case *json.SyntaxError:
+				offset = e.Offset
+			case *json.UnmarshalTypeError:
+				offset = e.Offset
+			}
+			if offset >= 0 {
+				line, col := lineCol(b, offset)
+				return fmt.Errorf("%s:%d:%d: %v", path, line, col, err)
+			}
+		}
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, v)
+	case ".toml":
+		err = toml.Unmarshal(b, v)
+	default:
+		return fmt.Errorf("%s: unsupported file format", path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// lineCol converts a byte offset into 1-based line and column numbers.
+func lineCol(b []byte, offset int64) (line, col int) {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	line, col = 1, 1
+	for _, c := range b[:offset] {
+		if c == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+// ConfigExts are the config file formats, in the order they are looked for.
+var ConfigExts = []string{".json", ".yaml", ".yml", ".toml"}
+
+// FindConfigFile returns the path of the config file called base plus one of
+// ConfigExts in dir. The error satisfies os.IsNotExist when there is none.
+func FindConfigFile(dir, base string) (string, error) {
+	for _, ext := range ConfigExts {
+		path := filepath.Join(dir, base+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", &os.PathError{Op: "open", Path: filepath.Join(dir, base+ConfigExts[0]), Err: os.ErrNotExist}
+}
+
+// IsConfigFile reports whether name is a config file called base.
+func IsConfigFile(name, base string) bool {
+	for _, ext := range ConfigExts {
+		if name == base+ext {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeConfigFile decodes a config file of any supported format into v.
+// YAML and TOML are converted to JSON first so keys match struct fields the
+// same case-insensitive way in every format.
+func DecodeConfigFile(path string, v interface{}) error {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return DecodeFile(path, v)
+	}
+	raw, err := ReadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	if err := Convert(raw, v); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// ReadConfigFile decodes a config file of any format into generic values
+// as encoding/json would produce them.
+func ReadConfigFile(path string) (interface{}, error) {
+	var raw interface{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		t := make(map[string]interface{})
+		if err := DecodeFile(path, &t); err != nil {
+			return nil, err
+		}
+		raw = t
+	} else if err := DecodeFile(path, &raw); err != nil {
+		return nil, err
+	}
+	return JSONCompatible(raw), nil
+}
+
+// Convert decodes generic config values into v, going through JSON
+// so the usual field matching applies.
+func Convert(raw interface{}, v interface{}) error {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// mergeConfig lays child over parent. Maps are merged key by key, matching
+// keys case-insensitively like encoding/json does, anything else in child
+// replaces the value of parent.
+func mergeConfig(parent, child interface{}) interface{} {
+	pm, ok := parent.(map[string]interface{})
+	if !ok {
+		return child
+	}
+	cm, ok := child.(map[string]interface{})
+	if !ok {
+		return child
+	}
+	m := make(map[string]interface{}, len(pm)+len(cm))
+	for k, v := range pm {
+		m[k] = v
+	}
+	for k, v := range cm {
+		for pk, pv := range pm {
+			if strings.EqualFold(pk, k) {
+				delete(m, pk)
+				v = mergeConfig(pv, v)
+				break
+			}
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// JSONCompatible converts the map[interface{}]interface{} values produced by
+// the YAML decoder into maps encoding/json can handle.
+func JSONCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = JSONCompatible(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = JSONCompatible(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = JSONCompatible(val)
+		}
+		return v
+	}
+	return v
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Run executes an external command in dir, passing its output through.
+func Run(dir string, env []string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// Env names the environment a build is for, selecting the overlay of the
+// master config for it: with --env production, siteware.master.production.json
+// is laid over siteware.master.json.
+var Env string
+
+// EnvConfigPath returns the overlay for Env of the master config at path.
+// Overlays can be in any format, not only that of the master config. The
+// error satisfies os.IsNotExist when there is none.
+func EnvConfigPath(path string) (string, error) {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return FindConfigFile(filepath.Dir(path), base+"."+Env)
+}
+
+// envRefRe matches ${NAME} and ${NAME:-default} in config strings, and
+// the escape $${ of a literal ${, e.g. of JavaScript template literals.
+var envRefRe = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expandEnv replaces the references of s, returning the names of the
+// variables missing.
+func expandEnv(s string) (string, []string) {
+	var missing []string
+	s = envRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		m := envRefRe.FindStringSubmatch(ref)
+		if value, exist := os.LookupEnv(m[1]); exist {
+			return value
+		}
+		if m[2] != "" {
+			return strings.TrimPrefix(m[2], ":-")
+		}
+		missing = append(missing, m[1])
+		return ref
+	})
+	return s, missing
+}
+
+// ExpandEnv replaces the ${NAME} references of a single value as
+// InterpolateEnv does, for values outside the master config.
+func ExpandEnv(s string) (string, error) {
+	s, missing := expandEnv(s)
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s unset", strings.Join(missing, ", "))
+	}
+	return s, nil
+}
+
+// InterpolateEnv replaces the ${NAME} references in the strings of raw
+// config values with environment variables, or with the default given as
+// ${NAME:-default} when unset. $${ stands for a literal ${. Every variable
+// missing is reported with the key using it.
+func InterpolateEnv(raw interface{}) (interface{}, error) {
+	var missing []string
+	var walk func(v interface{}, key string) interface{}
+	walk = func(v interface{}, key string) interface{} {
+		switch v := v.(type) {
+		case string:
+			s, names := expandEnv(v)
+			for _, name := range names {
+				missing = append(missing, fmt.Sprintf("%s: environment variable %s unset", key, name))
+			}
+			return s
+		case map[string]interface{}:
+			for k, val := range v {
+				name := k
+				if key != "" {
+					name = key + "." + k
+				}
+				v[k] = walk(val, name)
+			}
+		case []interface{}:
+			for i, val := range v {
+				v[i] = walk(val, fmt.Sprintf("%s[%d]", key, i))
+			}
+		}
+		return v
+	}
+	raw = walk(raw, "")
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, errors.New(strings.Join(missing, ", "))
+	}
+	return raw, nil
+}
+
+// DecodeMaster decodes the master config at path into v, with the
+// overlay of Env merged over it and environment variables interpolated.
+// Overlays only need the keys that differ.
+func DecodeMaster(path string, v interface{}) error {
+	raw, err := ReadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	if Env != "" {
+		overlay, err := EnvConfigPath(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s: no configuration for environment %s", path, Env)
+			}
+			return err
+		}
+		over, err := ReadConfigFile(overlay)
+		if err != nil {
+			return err
+		}
+		raw = mergeConfig(raw, over)
+	}
+	if raw, err = InterpolateEnv(raw); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if err := Convert(raw, v); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
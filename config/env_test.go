@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+	os.Setenv("SITEWARE_TEST_TOKEN", "secret")
+	defer os.Unsetenv("SITEWARE_TEST_TOKEN")
+	raw := map[string]interface{}{
+		"Token":  "${SITEWARE_TEST_TOKEN}",
+		"Branch": "${SITEWARE_TEST_UNSET:-main}",
+		"HTML":   []interface{}{"<script>log(`$${id}`)</script>"},
+	}
+	got, err := InterpolateEnv(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"Token":  "secret",
+		"Branch": "main",
+		"HTML":   []interface{}{"<script>log(`${id}`)</script>"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InterpolateEnv = %v, want %v", got, want)
+	}
+
+	if _, err := InterpolateEnv(map[string]interface{}{"HTML": "`${id}`"}); err == nil {
+		t.Error("InterpolateEnv of an unset variable succeeded")
+	}
+	if s, err := ExpandEnv("$${SITEWARE_TEST_TOKEN} ${SITEWARE_TEST_TOKEN}"); err != nil || s != "${SITEWARE_TEST_TOKEN} secret" {
+		t.Errorf("ExpandEnv = %q, %v", s, err)
+	}
+}
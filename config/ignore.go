@@ -0,0 +1,131 @@
+package config
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is one gitignore style pattern of config.Ignore.
+type ignoreRule struct {
+	pattern string
+	// negate re-includes what earlier rules ignored, written "!pattern"
+	negate bool
+	// dirOnly matches directories only, written with a trailing slash
+	dirOnly bool
+	// anchored patterns contain a slash and match paths from the project
+	// directory, others match names at any depth
+	anchored bool
+}
+
+func parseIgnoreRule(pattern string) ignoreRule {
+	var r ignoreRule
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	if strings.Contains(pattern, "/") {
+		r.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+	r.pattern = pattern
+	return r
+}
+
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchored {
+		match, _ := path.Match(r.pattern, path.Base(rel))
+		return match
+	}
+	return matchGlobPath(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchGlobPath matches path segments against pattern segments, where "**"
+// matches any number of segments.
+func matchGlobPath(pattern, segs []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchGlobPath(pattern[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if match, _ := path.Match(pattern[0], segs[0]); !match {
+			return false
+		}
+		pattern, segs = pattern[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// Ignored reports whether a file or directory of the project, given as a
+// path relative to the project directory, is skipped by the build. The
+// last matching rule decides, like in .gitignore files.
+func Ignored(rel string, isDir bool) bool {
+	// Patterns are written composed, names may come decomposed
+	rel = norm.NFC.String(filepath.ToSlash(rel))
+	result := false
+	for _, pattern := range Config.Ignore {
+		if r := parseIgnoreRule(pattern); r.match(rel, isDir) {
+			result = !r.negate
+		}
+	}
+	return result
+}
+
+// IgnoredPath is ignored for an absolute path under the project directory.
+func IgnoredPath(p string, info os.FileInfo) bool {
+	if len(Config.Ignore) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(InputPath, p)
+	if err != nil {
+		return false
+	}
+	return Ignored(rel, info.IsDir())
+}
+
+// RemoveIgnored deletes what the static sync copied of ignored files.
+func RemoveIgnored() error {
+	if len(Config.Ignore) == 0 {
+		return nil
+	}
+	destRoot := filepath.Join(Config.Output, StaticDirName)
+	return filepath.Walk(destRoot, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(Config.Output, p)
+		if err != nil {
+			return err
+		}
+		if p == destRoot || !Ignored(rel, info.IsDir()) {
+			return nil
+		}
+		DebugLogger.Printf("Remove ignored %s\n", rel)
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
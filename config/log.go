@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	LevelDebug logLevel = iota
+	LevelInfo
+	LevelError
+)
+
+func (l logLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	}
+	return "error"
+}
+
+// Logging settings, changed by the --verbose, --quiet and --log-format flags.
+var LogLevel = LevelInfo
+var LogFormat = "text"
+
+var logMu sync.Mutex
+
+// leveledLogger writes messages of one level, either as plain text lines
+// with a prefix or as JSON objects, one per line.
+type leveledLogger struct {
+	level  logLevel
+	prefix string
+	out    io.Writer
+}
+
+var DebugLogger = &leveledLogger{level: LevelDebug, prefix: "  ", out: os.Stdout}
+var InfoLogger = &leveledLogger{level: LevelInfo, prefix: "# ", out: os.Stdout}
+var ErrorLogger = &leveledLogger{level: LevelError, prefix: "Error: ", out: os.Stdout}
+
+func (l *leveledLogger) output(msg string, force bool) {
+	if l.level < LogLevel && !force {
+		return
+	}
+	msg = strings.TrimSuffix(msg, "\n")
+	now := time.Now()
+
+	logMu.Lock()
+	defer logMu.Unlock()
+	if LogFormat == "json" {
+		b, _ := json.Marshal(struct {
+			Time  time.Time `json:"time"`
+			Level string    `json:"level"`
+			Msg   string    `json:"msg"`
+		}{now, l.level.String(), msg})
+		fmt.Fprintf(l.out, "%s\n", b)
+		return
+	}
+	fmt.Fprintf(l.out, "%s%s %s\n", l.prefix, now.Format("15:04:05.000000"), msg)
+}
+
+func (l *leveledLogger) Printf(format string, v ...interface{}) {
+	l.output(fmt.Sprintf(format, v...), false)
+}
+
+func (l *leveledLogger) Println(v ...interface{}) {
+	l.output(fmt.Sprintln(v...), false)
+}
+
+// Fatalf logs regardless of the level and exits.
+func (l *leveledLogger) Fatalf(format string, v ...interface{}) {
+	l.output(fmt.Sprintf(format, v...), true)
+	os.Exit(1)
+}
+
+// Fatalln logs regardless of the level and exits.
+func (l *leveledLogger) Fatalln(v ...interface{}) {
+	l.output(fmt.Sprintln(v...), true)
+	os.Exit(1)
+}
+
+// SetLogging applies the logging flags.
+func SetLogging(verbose, quiet bool, format string) error {
+	switch {
+	case verbose:
+		LogLevel = LevelDebug
+	case quiet:
+		LogLevel = LevelError
+	}
+	switch format {
+	case "text", "json":
+		LogFormat = format
+	default:
+		return fmt.Errorf("unknown log format \"%s\"", format)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Compress writes precompressed variants of the output files next to
+// them, for hosts that serve those to browsers accepting them.
+type Compress struct {
+	// Gzip writes .gz and Brotli .br files
+	Gzip   bool
+	Brotli bool
+	// Exts are the extensions compressed, see assets.DefaultCompressExts
+	Exts []string
+	// MinSize skips smaller files, assets.DefaultCompressMinSize by default
+	MinSize int64
+}
+
+type Deploy struct {
+	// One of the keys in Deployers: "git", "rsync" or "s3"
+	Target string
+
+	// git, Message being a template like GitHubPages.Message
+	Remote  string
+	Branch  string
+	Message string
+
+	// rsync, e.g. "user@example.com:/var/www/site"
+	Destination string
+	SSHKey      string
+
+	// s3, any S3-compatible endpoint works
+	Bucket          string
+	Prefix          string
+	Region          string
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// LinkCheck configures checking outbound links with
+// check-links --external.
+type LinkCheck struct {
+	// External checks outbound links without the flag
+	External bool
+	// Allow lists hosts, or URL prefixes, assumed to work and never
+	// requested
+	Allow []string
+	// Timeout of one request in seconds, 10 by default
+	Timeout int
+	// Concurrency is how many requests run at once, 8 by default
+	Concurrency int
+	// CacheHours is how long a working link is not checked again, 24 by
+	// default. Broken links are checked on every run.
+	CacheHours int
+}
+
+func (c *LinkCheck) Allowed(u *url.URL) bool {
+	if c == nil {
+		return false
+	}
+	for _, a := range c.Allow {
+		if strings.Contains(a, "/") {
+			if strings.HasPrefix(u.String(), a) {
+				return true
+			}
+		} else if strings.EqualFold(u.Hostname(), a) {
+			return true
+		}
+	}
+	return false
+}
+
+type Feed struct {
+	Title       string
+	Description string
+	// Absolute URL of the site root, used to build item links. Defaults to
+	// the BaseURL of the master config.
+	Link   string
+	Author string
+	Limit  int
+}
+
+// Fetch pulls remote content into the project before building. Dest
+// is a path relative to the project directory, below src or data.
+type Fetch struct {
+	// One of the keys in Fetchers: "rest", "git" or "contentful"
+	Adapter string
+	Dest    string
+
+	// rest, a URL answering with JSON. Without Items the response is
+	// written to Dest as it is, otherwise Items is the dotted path of a
+	// list in it, e.g. "data.posts", whose entries become pages in Dest.
+	URL     string
+	Headers map[string]string
+	Items   string
+
+	// Entries turned into pages are named after their Name field, "slug"
+	// by default, and their Body field is the page content, "body" by
+	// default. Every other field goes into the front matter.
+	Name string
+	Body string
+
+	// git, a repository cloned into Dest and pulled later. Without Repo,
+	// Dest is a submodule of the project and is updated to its remote
+	// branch.
+	Repo   string
+	Branch string
+
+	// contentful, the entries of ContentType as pages, URL overriding
+	// build.DefaultContentfulURL. AccessToken may be "${VAR}" to read it from
+	// the environment.
+	Space       string
+	Environment string
+	ContentType string
+	AccessToken string
+}
+
+// GitHubPages sets up the output for GitHub Pages and the publish
+// command.
+type GitHubPages struct {
+	// CNAME is the custom domain written to the CNAME file
+	CNAME string
+	// Remote and Branch are pushed to, "origin" and "gh-pages" by default
+	Remote string
+	Branch string
+	// Message is a template of the commit message, see build.commitMessageData
+	Message string
+}
+
+// Hook is a shell command run before or after a build, in the
+// project directory. SITEWARE_SOURCE and SITEWARE_OUTPUT hold the project
+// and output paths.
+type Hook struct {
+	Command string
+	// IgnoreError reports a failing command as a warning instead of
+	// failing the build
+	IgnoreError bool
+}
+
+// Hooks lists the commands run around builds, in order.
+type Hooks struct {
+	PreBuild  []Hook
+	PostBuild []Hook
+}
+
+// Redirect sends requests for From to To. A trailing * in From matches
+// the rest of the path, which To can use as :splat.
+type Redirect struct {
+	From string
+	To   string
+	// Status is 301 by default
+	Status int
+}
+
+func (r Redirect) StatusCode() int {
+	if r.Status == 0 {
+		return 301
+	}
+	return r.Status
+}
+
+// ImageCDN leaves resizing to an image CDN or proxy: derivatives link
+// to it, made from the published originals, and builds generate no
+// thumbnails. The derivative settings still give their size, method,
+// format and quality.
+type ImageCDN struct {
+	// Service is "imgproxy" or "cloudinary", or empty to use URL
+	Service string
+	// Base is the URL of the imgproxy server, or of the Cloudinary cloud,
+	// e.g. "https://res.cloudinary.com/demo"
+	Base string
+	// URL is a template for other services, with the placeholders {src},
+	// the absolute URL of the original, {width}, {height}, {method},
+	// {format} and {quality}
+	URL string
+	// Key and Salt sign imgproxy URLs, hex encoded like imgproxy takes them
+	Key  string
+	Salt string
+}
+
+// Menu is an entry of the Menus setting, see build.menuEntry.
+type Menu struct {
+	Name     string
+	URL      string
+	Weight   int
+	Parent   string
+	Children []*Menu
+}
+
+// Minify selects what gets minified during a build.
+type Minify struct {
+	// HTML minifies generated pages, including inline styles and scripts
+	HTML bool
+	// CSS and JS minify stylesheets and scripts copied from static
+	CSS bool
+	JS  bool
+}
+
+// OpenGraph sets the site wide values of build.ogTags.
+type OpenGraph struct {
+	SiteName string
+	// Twitter is the @handle of the site
+	Twitter string
+	// Image is used for pages that don't set one
+	Image string
+	// ImageDerivative is the derivative used for images in directories
+	// that have it, "og" by default
+	ImageDerivative string
+}
+
+// PostProcess passes every generated page through a chain of
+// processors after rendering, before it is minified or encrypted.
+type PostProcess struct {
+	// Chain lists the names of build.HTMLProcessors in the order they run
+	Chain []string
+	// Analytics is the snippet the "analytics" processor adds at the end of
+	// the head, e.g. the script tag of an analytics service. Like every
+	// config string it reads ${NAME} from the environment, so template
+	// literals of scripts escape it as $${.
+	Analytics string
+}
+
+// Injection is a snippet added to every generated page, such as an
+// analytics or consent script.
+type Injection struct {
+	// Position is "head" for the end of the head or "body" for the end of
+	// the body
+	Position string
+	// HTML is the snippet, with ${ escaped as $${ like in Analytics
+	HTML string
+	// Env limits the snippet to builds for these environments, see --env.
+	// Without it the snippet is always added.
+	Env []string
+}
+
+// Proof configures the proof command.
+type Proof struct {
+	// Command replaces build.DefaultProofCommand
+	Command []string
+	// Language is the dictionary of the spell checker, build.DefaultProofLanguage
+	// by default
+	Language string
+	// Dictionaries are files, relative to the project, listing words one
+	// per line that are spelled right. Lines starting with # are comments.
+	Dictionaries []string
+	// Avoid lists words and phrases reported wherever they are used, such
+	// as "simply" or "obviously"
+	Avoid []string
+}
+
+// Sass configures the Dart Sass compiler run on .scss and .sass files.
+type Sass struct {
+	// Command is the sass executable, "sass" from PATH by default
+	Command string
+	// Style is "expanded" or "compressed"
+	Style string
+	// LoadPaths are searched for imports, relative to the project
+	LoadPaths []string
+}
+
+// Serve makes serve behave like the production hosting.
+type Serve struct {
+	// Headers maps URL path patterns to response headers, e.g.
+	// "/static/*": {"Cache-Control": "max-age=31536000"}
+	Headers map[string]map[string]string
+	// NotFound is the page served with 404 responses, 404.html by default
+	NotFound string
+	// SPAFallback is served for paths that don't exist, e.g. index.html
+	SPAFallback string
+	// Auth requires credentials for every request, e.g. to share a
+	// preview through a tunnel
+	Auth *ServeAuth
+}
+
+// ServeAuth protects served pages with HTTP basic authentication,
+// a token, or either. Passwords and tokens can name environment variables
+// as "${NAME}".
+type ServeAuth struct {
+	User     string
+	Password string
+	// Token is accepted as a bearer token or a ?token= query parameter.
+	// The query sets a cookie, so a shared link works for the whole visit.
+	Token string
+}
+
+type Robots struct {
+	UserAgent string
+	Allow     []string
+	Disallow  []string
+}
+
+type Taxonomy struct {
+	// Template renders the page listing the pages of one term
+	Template string
+	// TermsTemplate renders the page listing all terms of the taxonomy
+	TermsTemplate string
+}
+
+type Thumbnail struct {
+	Method string
+	Width  int
+	Height int
+	// OutputFormat is "webp", "avif", "jpeg" or "png". Empty keeps the
+	// format of the source image.
+	OutputFormat string
+	// Quality from 1 to 100 for lossy formats, 0 uses the encoder default
+	Quality int
+	// PNGCompression is "default", "none", "fast" or "best"
+	PNGCompression string
+	// Filter is the resampling filter, see assets.ResampleFilters. Defaults to
+	// "box", which is fast but soft.
+	Filter string
+	// Sharpen applies a sharpening of this strength after resizing, 0.5
+	// to 1 being subtle
+	Sharpen float64
+	// Watermark is composited onto the thumbnails, and onto the full size
+	// images with Watermark.Originals
+	Watermark Watermark
+	// StripEXIF removes metadata such as GPS position from the published
+	// full size images. Thumbnails never carry it.
+	StripEXIF bool
+}
+
+// Video enables poster frames and metadata of the videos in the
+// static directory. Videos are published as they are either way.
+type Video struct {
+	// Posters writes a JPEG frame of every video to a posters directory
+	// next to it
+	Posters bool
+	// PosterTime is where the frame is taken, in seconds or as hh:mm:ss
+	PosterTime string
+	// PosterCommand and ProbeCommand replace the ffmpeg and ffprobe
+	// commands, with the same placeholders as assets.DefaultPosterCommand. The
+	// probe command must print the JSON ffprobe does.
+	PosterCommand []string
+	ProbeCommand  []string
+}
+
+// Watermark composites an image or a line of text onto images. The
+// zero value adds nothing.
+type Watermark struct {
+	// Image is a path relative to the project directory
+	Image string
+	// Text is drawn in white when Image is empty, TextSize pixels high
+	Text     string
+	TextSize int
+	// Position is one of assets.WatermarkPositions, "bottomright" by default
+	Position string
+	// Opacity from 0 to 1, 0.5 by default
+	Opacity float64
+	// Margin from the edges in pixels, 10 by default
+	Margin int
+	// Originals marks the published full size images too, not only the
+	// thumbnails
+	Originals bool
+}
+
+func (c Watermark) Enabled() bool {
+	return c.Image != "" || c.Text != ""
+}
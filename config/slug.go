@@ -0,0 +1,74 @@
+package config
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+// Slugs normalizes the names of published files, and so their URLs.
+// Names are always converted to the composed Unicode form, since macOS
+// stores them decomposed and links are written composed.
+type Slugs struct {
+	// Transliterate replaces accented and other Latin letters with ASCII
+	// ones, such as ä with a and ß with ss
+	Transliterate bool
+	// Lowercase names
+	Lowercase bool
+	// Spaces replaces runs of whitespace, e.g. "-". Empty keeps them.
+	Spaces string
+}
+
+// Transliterations are the letters that don't decompose into an ASCII letter
+// and marks.
+var Transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'ø': "o", 'Ø': "O", 'œ': "oe", 'Œ': "OE",
+	'đ': "d", 'Đ': "D", 'ł': "l", 'Ł': "L", 'þ': "th", 'Þ': "TH", 'ð': "d", 'Ð': "D",
+	'ı': "i",
+}
+
+// Transliterate drops the marks of decomposed letters and spells out the
+// Transliterations. Other scripts are left alone.
+func Transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if t, exist := Transliterations[r]; exist {
+			b.WriteString(t)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return norm.NFC.String(b.String())
+}
+
+// SlugName normalizes one file name by the Slugs setting.
+func SlugName(name string) string {
+	name = norm.NFC.String(name)
+	cfg := Config.Slugs
+	if cfg == nil {
+		return name
+	}
+	if cfg.Transliterate {
+		name = Transliterate(name)
+	}
+	if cfg.Lowercase {
+		name = strings.ToLower(name)
+	}
+	if cfg.Spaces != "" {
+		name = strings.Join(strings.Fields(name), cfg.Spaces)
+	}
+	return name
+}
+
+// OutputName maps a slash separated path, relative to the project or the
+// source directory, to the name it is published under.
+func OutputName(rel string) string {
+	segs := strings.Split(rel, "/")
+	for i, seg := range segs {
+		segs[i] = SlugName(seg)
+	}
+	return strings.Join(segs, "/")
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Values of config.Symlinks
+const (
+	SymlinksFollow = "follow"
+	SymlinksCopy   = "copy"
+	SymlinksIgnore = "ignore"
+)
+
+// SymlinkModes are the values config.Symlinks accepts, the empty string
+// meaning SymlinksFollow.
+var SymlinkModes = []string{"", SymlinksFollow, SymlinksCopy, SymlinksIgnore}
+
+func SymlinkMode() string {
+	if Config.Symlinks == "" {
+		return SymlinksFollow
+	}
+	return Config.Symlinks
+}
+
+func IsSymlink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink != 0
+}
+
+// WalkSource walks a project directory like filepath.Walk. When following
+// symlinks, linked files and directories are visited as if they were under
+// the path of the link. Otherwise links are passed to fn as they are.
+func WalkSource(root string, fn filepath.WalkFunc) error {
+	if SymlinkMode() != SymlinksFollow {
+		return filepath.Walk(root, fn)
+	}
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkLinks(root, info, make(map[string]bool), fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walkLinks visits p, resolving it if it is a symlink. active holds the
+// real paths of the directories being walked, so a link back to one of
+// them is skipped instead of walked forever.
+func walkLinks(p string, info os.FileInfo, active map[string]bool, fn filepath.WalkFunc) error {
+	if IsSymlink(info) {
+		// Stat names the info after the link
+		target, err := os.Stat(p)
+		if err != nil {
+			return fn(p, info, err)
+		}
+		info = target
+	}
+	if !info.IsDir() {
+		return fn(p, info, nil)
+	}
+
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return fn(p, info, err)
+	}
+	if active[real] {
+		DebugLogger.Printf("Skipping symlink cycle at %s\n", p)
+		return nil
+	}
+	active[real] = true
+	defer delete(active, real)
+
+	if err := fn(p, info, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return fn(p, info, err)
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return fn(p, info, err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := filepath.Join(p, name)
+		fi, err := os.Lstat(child)
+		if err != nil {
+			err = fn(child, fi, err)
+		} else {
+			err = walkLinks(child, fi, active, fn)
+		}
+		if err == filepath.SkipDir {
+			// A file skipping its directory
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
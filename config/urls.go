@@ -0,0 +1,82 @@
+package config
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const MarkdownExt = ".md"
+
+// AbsURL turns a site path into an absolute URL using the configured BaseURL.
+// URLs that already carry a scheme are returned unchanged.
+func AbsURL(p string) string {
+	if IsAbsURL(p) {
+		return p
+	}
+	base := strings.TrimSuffix(Config.BaseURL, "/")
+	return base + joinURLPath("/", p)
+}
+
+// RelURL turns a site path into a root-relative URL, prefixed with the path
+// of the configured BaseURL so sites deployed at a subpath link correctly.
+func RelURL(p string) string {
+	if IsAbsURL(p) {
+		return p
+	}
+	prefix := "/"
+	if u, err := url.Parse(Config.BaseURL); err == nil && u.Path != "" {
+		prefix = u.Path
+	}
+	return joinURLPath(prefix, p)
+}
+
+func IsAbsURL(p string) bool {
+	u, err := url.Parse(p)
+	return err == nil && u.IsAbs()
+}
+
+// joinURLPath joins URL path segments, keeping a trailing slash on p.
+func joinURLPath(prefix, p string) string {
+	joined := path.Join(prefix, p)
+	if strings.HasSuffix(p, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// DefaultContentExts are the extensions of the pages rendered as templates,
+// besides Markdown.
+var DefaultContentExts = []string{".html", ".htm"}
+
+// ext is the extension of a slash separated or OS path. path.Ext alone
+// would look past the backslashes of Windows paths.
+func ext(p string) string {
+	return path.Ext(filepath.ToSlash(p))
+}
+
+// IsMarkdown reports whether p names a Markdown page, in any case.
+func IsMarkdown(p string) bool {
+	return strings.EqualFold(ext(p), MarkdownExt)
+}
+
+// IsContent reports whether p names a page of the source directory, with
+// one of the configured content extensions or Markdown, in any case.
+func IsContent(p string) bool {
+	exts := Config.ContentExts
+	if len(exts) == 0 {
+		exts = DefaultContentExts
+	}
+	return IsMarkdown(p) || ContainsFold(exts, ext(p))
+}
+
+// IsHTML reports whether p names a page published as HTML. Other content,
+// like XML or text, keeps its name and isn't minified.
+func IsHTML(p string) bool {
+	switch strings.ToLower(ext(p)) {
+	case ".html", ".htm", MarkdownExt:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SitesDirName holds the sites of a workspace, one project directory each
+// with its own master config, e.g. sites/blog and sites/docs.
+const SitesDirName = "sites"
+
+// WorkspacePath is the workspace directory while building one of its sites,
+// and empty for a plain project. Its templates directory is shared by the
+// sites, which override templates of the same name.
+var WorkspacePath string
+
+// WorkspaceSites lists the sites of the workspace at dir in order.
+func WorkspaceSites(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(dir, SitesDirName))
+	if err != nil {
+		return nil, err
+	}
+	var sites []string
+	for _, fi := range files {
+		if !fi.IsDir() {
+			continue
+		}
+		if _, err := FindConfigFile(filepath.Join(dir, SitesDirName, fi.Name()), ConfigBaseName); err == nil {
+			sites = append(sites, fi.Name())
+		}
+	}
+	return sites, nil
+}
+
+// SelectSite makes the site named with --site the project directory.
+func SelectSite() error {
+	if Options.Site == "" {
+		return nil
+	}
+	if strings.ContainsAny(Options.Site, `/\`) || Options.Site == ".." {
+		return fmt.Errorf("Invalid site name \"%s\"", Options.Site)
+	}
+	dir := filepath.Join(InputPath, SitesDirName, Options.Site)
+	if _, err := os.Stat(dir); err != nil {
+		sites, _ := WorkspaceSites(InputPath)
+		return fmt.Errorf("Unknown site \"%s\", the workspace has: %s", Options.Site, strings.Join(sites, ", "))
+	}
+	WorkspacePath, InputPath = InputPath, dir
+	return nil
+}
+
+// IsSubpath reports whether p is dir or below it.
+func IsSubpath(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,413 @@
+// Package output is where builds write the site to: the output directory
+// or memory, the staging directory builds are swapped in from, and the
+// report of what was written.
+package output
+
+import (
+	"bytes"
+	"github.com/Varjelus/siteware/config"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FS is what builds write the site to. Names are paths under
+// Config.Output, like those of the os package.
+type FS interface {
+	MkdirAll(name string, perm os.FileMode) error
+	// Create truncates or creates a file with the given permissions
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	Open(name string) (http.File, error)
+	Stat(name string) (os.FileInfo, error)
+	Walk(root string, fn filepath.WalkFunc) error
+}
+
+// Target is where the current build writes, set by build.Build from its
+// options: the disk, or a MemFS to keep the build in memory.
+var Target FS = OSFS{}
+
+// InMemory reports whether builds write to memory.
+func InMemory() bool {
+	_, memory := Target.(*MemFS)
+	return memory
+}
+
+// OSFS writes to the disk.
+type OSFS struct{}
+
+func (OSFS) MkdirAll(name string, perm os.FileMode) error { return os.MkdirAll(name, perm) }
+func (OSFS) Open(name string) (http.File, error)          { return os.Open(name) }
+func (OSFS) Stat(name string) (os.FileInfo, error)        { return os.Stat(name) }
+func (OSFS) Walk(root string, fn filepath.WalkFunc) error { return filepath.Walk(root, fn) }
+
+// Create and WriteFile replace files rather than truncating them, as the
+// files of a staging directory can be hard links to those of the output.
+func (OSFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	if err := unlinkFile(name); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+func (OSFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := unlinkFile(name); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, perm)
+}
+
+// unlinkFile removes name unless it is a directory or doesn't exist.
+func unlinkFile(name string) error {
+	if info, err := os.Lstat(name); err != nil || info.IsDir() {
+		return nil
+	}
+	return os.Remove(name)
+}
+
+// MemFS keeps files in memory by their cleaned path. Parent directories are
+// created as needed.
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string]*memEntry
+}
+
+type memEntry struct {
+	name    string
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string]*memEntry)}
+}
+
+// mkdirAll adds name and its parents as directories. The lock must be held.
+func (m *MemFS) mkdirAll(name string, perm os.FileMode) error {
+	for p := name; ; p = filepath.Dir(p) {
+		if e, exist := m.files[p]; exist {
+			if !e.mode.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: p, Err: os.ErrExist}
+			}
+			break
+		}
+		m.files[p] = &memEntry{name: filepath.Base(p), mode: os.ModeDir | perm, modTime: time.Now()}
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(filepath.Clean(name), perm)
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, exist := m.files[name]; exist && e.mode.IsDir() {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+	if err := m.mkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	m.files[name] = &memEntry{name: filepath.Base(name), data: data, mode: perm, modTime: time.Now()}
+	return nil
+}
+
+// memWriter stores what was written to it when closed.
+type memWriter struct {
+	bytes.Buffer
+	fs   *MemFS
+	name string
+	perm os.FileMode
+}
+
+func (w *memWriter) Close() error {
+	return w.fs.WriteFile(w.name, w.Bytes(), w.perm)
+}
+
+func (m *MemFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return &memWriter{fs: m, name: name, perm: perm}, nil
+}
+
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	name = filepath.Clean(name)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, exist := m.files[name]
+	if !exist {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return e.info(), nil
+}
+
+// ReadFile returns the contents of a file.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	name = filepath.Clean(name)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, exist := m.files[name]
+	if !exist || e.mode.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	}
+	return e.data, nil
+}
+
+func (m *MemFS) Open(name string) (http.File, error) {
+	name = filepath.Clean(name)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, exist := m.files[name]
+	if !exist {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	f := &memFile{Reader: bytes.NewReader(e.data), entry: *e}
+	if e.mode.IsDir() {
+		for _, child := range m.children(name) {
+			f.children = append(f.children, m.files[child].info())
+		}
+	}
+	return f, nil
+}
+
+// children lists the paths right under a directory in order. The lock must
+// be held.
+func (m *MemFS) children(dir string) []string {
+	var names []string
+	for p := range m.files {
+		if p != dir && filepath.Dir(p) == dir {
+			names = append(names, p)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Walk visits the tree under root in the order filepath.Walk does.
+func (m *MemFS) Walk(root string, fn filepath.WalkFunc) error {
+	root = filepath.Clean(root)
+	info, err := m.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = m.walk(root, info, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (m *MemFS) walk(p string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(p, info, nil)
+	}
+	if err := fn(p, info, nil); err != nil {
+		return err
+	}
+	m.mu.RLock()
+	children := m.children(p)
+	m.mu.RUnlock()
+	for _, child := range children {
+		fi, err := m.Stat(child)
+		if err != nil {
+			// Removed while walking
+			continue
+		}
+		err = m.walk(child, fi, fn)
+		if err == filepath.SkipDir {
+			if fi.IsDir() {
+				continue
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeAll deletes name and everything under it.
+func (m *MemFS) removeAll(name string) {
+	name = filepath.Clean(name)
+	prefix := name + string(filepath.Separator)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for p := range m.files {
+		if p == name || strings.HasPrefix(p, prefix) {
+			delete(m.files, p)
+		}
+	}
+}
+
+// importDir reads the tree at src into dest, replacing files of the same
+// name.
+func (m *MemFS) importDir(src, dest string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if info.IsDir() {
+			return m.MkdirAll(target, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return m.WriteFile(target, b, info.Mode().Perm())
+	})
+}
+
+func (e *memEntry) info() os.FileInfo {
+	return memInfo{name: e.name, size: int64(len(e.data)), mode: e.mode, modTime: e.modTime}
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() os.FileMode  { return i.mode }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memInfo) Sys() interface{}   { return nil }
+
+// memFile is an open file of a MemFS. Its data is a snapshot, so writes
+// after opening don't show.
+type memFile struct {
+	*bytes.Reader
+	entry    memEntry
+	children []os.FileInfo
+}
+
+func (f *memFile) Close() error               { return nil }
+func (f *memFile) Stat() (os.FileInfo, error) { return f.entry.info(), nil }
+
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.entry.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.entry.name, Err: os.ErrInvalid}
+	}
+	if count <= 0 {
+		list := f.children
+		f.children = nil
+		return list, nil
+	}
+	if len(f.children) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.children) {
+		count = len(f.children)
+	}
+	list := f.children[:count]
+	f.children = f.children[count:]
+	return list, nil
+}
+
+// Dir serves a directory of an FS like http.Dir serves one of
+// the disk.
+type Dir struct {
+	FS   FS
+	Root string
+}
+
+func (d Dir) Open(name string) (http.File, error) {
+	return d.FS.Open(filepath.Join(d.Root, filepath.FromSlash(path.Clean("/"+name))))
+}
+
+// ReadFile returns the contents of a file of the directory, given by its
+// slash separated path, e.g. "blog/index.html".
+func (d Dir) ReadFile(name string) ([]byte, error) {
+	f, err := d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrInvalid}
+	}
+	return ioutil.ReadAll(f)
+}
+
+// OnDisk runs a build step that only tools writing files can do, such as
+// syncing and compiling static files. With the output in memory the step
+// writes to a temporary directory, which is read into memory after dir, a
+// path relative to the output directory, is cleared. The build points the
+// output at the temporary directory meanwhile; what it returned to callers
+// keeps serving the memory.
+func OnDisk(dir string, step func() error) error {
+	mem, memory := Target.(*MemFS)
+	if !memory {
+		return step()
+	}
+	tmp, err := ioutil.TempDir("", "siteware-output")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	output := config.Config.Output
+	if err := func() error {
+		config.Config.Output, Target = tmp, OSFS{}
+		defer func() { config.Config.Output, Target = output, mem }()
+		return step()
+	}(); err != nil {
+		return err
+	}
+	mem.removeAll(filepath.Join(output, dir))
+	return mem.importDir(tmp, output)
+}
+
+// WriteExternal lets a command write dest, going through a temporary file
+// when the output is in memory.
+func WriteExternal(dest string, write func(path string) error) error {
+	if !InMemory() {
+		// Commands may write in place, and dest be linked from the output
+		if err := unlinkFile(dest); err != nil {
+			return err
+		}
+		return write(dest)
+	}
+	f, err := ioutil.TempFile("", "siteware-*"+filepath.Ext(dest))
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	defer os.Remove(tmp)
+	if err := write(tmp); err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	return Target.WriteFile(dest, b, 0644)
+}
@@ -0,0 +1,68 @@
+package output
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMemFS(t *testing.T) {
+	root := filepath.FromSlash("/site")
+	m := NewMemFS()
+	if err := m.WriteFile(filepath.Join(root, "index.html"), []byte("home"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := m.Create(filepath.Join(root, "blog", "post.html"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("post"))
+	// Created files appear when closed
+	if _, err := m.Stat(filepath.Join(root, "blog", "post.html")); !os.IsNotExist(err) {
+		t.Errorf("Stat before Close = %v, want not exist", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := m.ReadFile(filepath.Join(root, "blog", "post.html")); err != nil || string(b) != "post" {
+		t.Errorf("ReadFile = %q, %v, want %q", b, err, "post")
+	}
+	if _, err := m.ReadFile(filepath.Join(root, "blog")); !os.IsNotExist(err) {
+		t.Errorf("ReadFile of a directory = %v, want not exist", err)
+	}
+	f, err := m.Open(filepath.Join(root, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(f); string(b) != "home" {
+		t.Errorf("Open read %q, want %q", b, "home")
+	}
+	f.Close()
+
+	var walked []string
+	m.Walk(root, func(p string, info os.FileInfo, err error) error {
+		rel, _ := filepath.Rel(root, p)
+		walked = append(walked, filepath.ToSlash(rel))
+		return err
+	})
+	if want := []string{".", "blog", "blog/post.html", "index.html"}; !reflect.DeepEqual(walked, want) {
+		t.Errorf("Walk visited %q, want %q", walked, want)
+	}
+	if err := m.WriteFile(filepath.Join(root, "blog"), nil, 0644); err == nil {
+		t.Error("WriteFile over a directory succeeded")
+	}
+}
+
+func TestInMemory(t *testing.T) {
+	saved := Target
+	defer func() { Target = saved }()
+	if Target = (OSFS{}); InMemory() {
+		t.Error("InMemory with OSFS = true")
+	}
+	if Target = NewMemFS(); !InMemory() {
+		t.Error("InMemory with a MemFS = false")
+	}
+}
@@ -0,0 +1,70 @@
+package output
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Errors collects every failure of a build step instead of stopping at
+// the first one.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// WorkerPool runs submitted jobs on a bounded number of goroutines.
+type WorkerPool struct {
+	jobs chan func() error
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs Errors
+}
+
+// NewWorkerPool starts a pool with n workers. Zero or less means one worker
+// per CPU.
+func NewWorkerPool(n int) *WorkerPool {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	p := &WorkerPool{jobs: make(chan func() error)}
+	p.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				if err := job(); err != nil {
+					p.fail(err)
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// Submit queues a job, blocking while all workers are busy.
+func (p *WorkerPool) Submit(job func() error) {
+	p.jobs <- job
+}
+
+func (p *WorkerPool) fail(err error) {
+	p.mu.Lock()
+	p.errs = append(p.errs, err)
+	p.mu.Unlock()
+}
+
+// Wait stops accepting jobs, waits for the running ones and returns all
+// errors they produced.
+func (p *WorkerPool) Wait() error {
+	close(p.jobs)
+	p.wg.Wait()
+	if len(p.errs) == 0 {
+		return nil
+	}
+	return p.errs
+}
@@ -0,0 +1,108 @@
+package output
+
+import (
+	"encoding/json"
+	"github.com/Varjelus/siteware/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// phaseTiming is how long one step of a build took.
+type phaseTiming struct {
+	Name    string
+	Seconds float64
+}
+
+// BuildReport sums up what a build produced. It is logged at the end of
+// build and written as JSON with --report.
+type BuildReport struct {
+	mu sync.Mutex
+
+	Pages               int
+	ThumbnailsGenerated int
+	ThumbnailsSkipped   int
+	StaticFiles         int
+	// Bytes is the size of the whole output directory
+	Bytes    int64
+	Phases   []phaseTiming
+	Seconds  float64
+	Warnings []string
+}
+
+// Report is replaced at the start of every full build. Partial rebuilds
+// keep adding to the last one.
+var Report = &BuildReport{}
+
+func (r *BuildReport) AddPage() {
+	r.mu.Lock()
+	r.Pages++
+	r.mu.Unlock()
+}
+
+func (r *BuildReport) AddThumbnail(skipped bool) {
+	r.mu.Lock()
+	if skipped {
+		r.ThumbnailsSkipped++
+	} else {
+		r.ThumbnailsGenerated++
+	}
+	r.mu.Unlock()
+}
+
+// Warn logs a warning and keeps it for the report.
+func (r *BuildReport) Warn(msg string) {
+	config.ErrorLogger.Printf("Warning: %s\n", msg)
+	r.mu.Lock()
+	r.Warnings = append(r.Warnings, msg)
+	r.mu.Unlock()
+}
+
+// Phase runs f and records how long it took under name.
+func (r *BuildReport) Phase(name string, f func() error) error {
+	start := time.Now()
+	err := f()
+	r.mu.Lock()
+	r.Phases = append(r.Phases, phaseTiming{Name: name, Seconds: time.Since(start).Seconds()})
+	r.mu.Unlock()
+	return err
+}
+
+// Finish counts the output files and logs the summary.
+func (r *BuildReport) Finish(start time.Time) {
+	r.Seconds = time.Since(start).Seconds()
+	staticDir := filepath.Join(config.Config.Output, config.StaticDirName)
+	Target.Walk(config.Config.Output, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		r.Bytes += info.Size()
+		if strings.HasPrefix(path, staticDir+string(filepath.Separator)) {
+			r.StaticFiles++
+		}
+		return nil
+	})
+
+	config.InfoLogger.Printf("Built %d pages, %d static files, %d thumbnails (%d up to date), %d bytes in %.2fs\n",
+		r.Pages, r.StaticFiles, r.ThumbnailsGenerated, r.ThumbnailsSkipped, r.Bytes, r.Seconds)
+	for _, p := range r.Phases {
+		config.DebugLogger.Printf("%s: %.2fs\n", p.Name, p.Seconds)
+	}
+	if len(r.Warnings) > 0 {
+		config.InfoLogger.Printf("%d warnings\n", len(r.Warnings))
+	}
+}
+
+// Write saves the report as JSON.
+func (r *BuildReport) Write(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
@@ -0,0 +1,232 @@
+package output
+
+import (
+	"fmt"
+	"github.com/Varjelus/siteware/config"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// CopyFile copies src to dest with the given permissions.
+func CopyFile(src, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := Target.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := Target.Create(dest, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// VCSDirNames are preserved entries too large to copy into the staging
+// directory. They are moved over once the build succeeded instead.
+var VCSDirNames = []string{".git", ".hg", ".svn"}
+
+// PreservedNames returns the Preserve list of the master config.
+func PreservedNames() []string {
+	if config.Config.Preserve == nil {
+		return config.DefaultPreserve
+	}
+	return config.Config.Preserve
+}
+
+// Stage creates an empty directory next to the output directory for
+// a build to write to. The files of the preserved entries of the output are
+// hard-linked into it, so statics sync and thumbnails are only redone where
+// they changed without copying everything first. Builds replace files
+// rather than writing into them, which leaves the output as it was.
+func Stage(output string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return "", err
+	}
+	if err := recoverOutput(output); err != nil {
+		return "", err
+	}
+	// Next to the output so it can be renamed into place
+	stage, err := ioutil.TempDir(filepath.Dir(output), "."+filepath.Base(output)+"-build-")
+	if err != nil {
+		return "", err
+	}
+	for _, name := range PreservedNames() {
+		if config.ContainsFold(VCSDirNames, name) {
+			continue
+		}
+		src := filepath.Join(output, name)
+		if _, err := os.Lstat(src); err != nil {
+			continue
+		}
+		if err := linkTree(src, filepath.Join(stage, name)); err != nil {
+			os.RemoveAll(stage)
+			return "", fmt.Errorf("Error staging preserved %s: %v", src, err)
+		}
+	}
+	return stage, nil
+}
+
+// Swap replaces the output directory with the staging directory,
+// moving the preserved entries the build didn't write over first. Both
+// directories being on the same file system, the swap itself is two
+// renames: the output to the "-old" directory next to it, then the stage
+// to the output. Between the two the output doesn't exist, so a server of
+// it may answer 404 for that moment. Should the second rename fail, the old
+// output is put back, and should the process end in between, the next
+// Stage puts it back.
+func Swap(stage, output string) error {
+	info, err := os.Stat(output)
+	if os.IsNotExist(err) {
+		return os.Rename(stage, output)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(stage, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	var moved []string
+	for _, name := range PreservedNames() {
+		if _, err := os.Lstat(filepath.Join(stage, name)); err == nil {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(output, name)); err != nil {
+			continue
+		}
+		if err := os.Rename(filepath.Join(output, name), filepath.Join(stage, name)); err != nil {
+			restorePreserved(stage, output, moved)
+			return err
+		}
+		moved = append(moved, name)
+	}
+
+	old := stage + oldSuffix
+	if err := os.Rename(output, old); err != nil {
+		restorePreserved(stage, output, moved)
+		return err
+	}
+	if err := os.Rename(stage, output); err != nil {
+		// Put the previous output back as it was
+		if rerr := os.Rename(old, output); rerr != nil {
+			return fmt.Errorf("%v, and the previous output is left at %s: %v", err, old, rerr)
+		}
+		restorePreserved(stage, output, moved)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// oldSuffix names the previous output during a Swap.
+const oldSuffix = "-old"
+
+// recoverOutput puts back the previous output of a Swap that didn't
+// finish, which left the output missing. Leftovers next to an existing
+// output are removed.
+func recoverOutput(output string) error {
+	olds, err := filepath.Glob(filepath.Join(filepath.Dir(output), "."+filepath.Base(output)+"-build-*"+oldSuffix))
+	if err != nil || len(olds) == 0 {
+		return err
+	}
+	if _, err := os.Lstat(output); os.IsNotExist(err) {
+		// The latest is the output of the last finished build
+		sort.Slice(olds, func(i, j int) bool { return modTime(olds[i]).After(modTime(olds[j])) })
+		config.ErrorLogger.Printf("Restoring %s from the unfinished swap %s\n", output, olds[0])
+		if err := os.Rename(olds[0], output); err != nil {
+			return err
+		}
+		olds = olds[1:]
+	}
+	for _, old := range olds {
+		os.RemoveAll(old)
+	}
+	return nil
+}
+
+// restorePreserved moves preserved entries back after a failed swap.
+func restorePreserved(stage, output string, names []string) {
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(stage, name), filepath.Join(output, name)); err != nil {
+			config.ErrorLogger.Printf("Error restoring %s: %v\n", filepath.Join(output, name), err)
+		}
+	}
+}
+
+func modTime(name string) time.Time {
+	if info, err := os.Lstat(name); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// linkTree recreates a file or directory with hard links to its files,
+// keeping modification times so syncing and caches see them as unchanged.
+// Files are copied where links aren't supported.
+func linkTree(src, dest string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(target, info.Mode().Perm()|0700); err != nil {
+				return err
+			}
+		case config.IsSymlink(info):
+			return CopySymlink(path, target)
+		case info.Mode().IsRegular():
+			if err := os.Link(path, target); err == nil {
+				return nil
+			}
+			if err := CopyFile(path, target, info.Mode()); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+// CopySymlink recreates the link at src as dest. Memory has no links, so
+// there linked files are copied instead and linked directories left out.
+func CopySymlink(src, dest string) error {
+	if InMemory() {
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			Report.Warn(fmt.Sprintf("%s: linked directories aren't copied in memory", src))
+			return nil
+		}
+		return CopyFile(src, dest, info.Mode())
+	}
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	return os.Symlink(target, dest)
+}
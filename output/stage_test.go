@@ -0,0 +1,65 @@
+package output
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStageSwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "siteware-stage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "public")
+	static := filepath.Join(out, "static", "a.css")
+	if err := os.MkdirAll(filepath.Dir(static), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(static, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stage, err := Stage(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stage)
+	staged := filepath.Join(stage, "static", "a.css")
+	a, _ := os.Stat(static)
+	if b, err := os.Stat(staged); err != nil || !os.SameFile(a, b) {
+		t.Errorf("preserved file not linked into the stage: %v", err)
+	}
+	// Writing the stage leaves the output as it was until the swap
+	if err := (OSFS{}).WriteFile(staged, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(static); string(b) != "old" {
+		t.Errorf("output changed to %q before the swap", b)
+	}
+	if err := Swap(stage, out); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(static); string(b) != "new" {
+		t.Errorf("output is %q after the swap, want %q", b, "new")
+	}
+	if olds, _ := filepath.Glob(filepath.Join(dir, "*"+oldSuffix)); len(olds) != 0 {
+		t.Errorf("swap left %q", olds)
+	}
+
+	// A swap ended between its renames is undone by the next Stage
+	old := filepath.Join(dir, ".public-build-1"+oldSuffix)
+	if err := os.Rename(out, old); err != nil {
+		t.Fatal(err)
+	}
+	stage, err = Stage(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stage)
+	if b, _ := ioutil.ReadFile(static); string(b) != "new" {
+		t.Errorf("output not restored, reads %q", b)
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const LiveReloadPath = "/_siteware/livereload"
+
+var liveReloadScript = []byte(`<script>(function(){var s=new EventSource("` + LiveReloadPath + `");s.onmessage=function(){location.reload()};})();</script>`)
+
+// reloadHub fans reload events out to every connected browser.
+type reloadHub struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+var LiveReload = &reloadHub{clients: make(map[chan struct{}]struct{}), closed: make(chan struct{})}
+
+// Close ends every event stream, for shutting the server down.
+func (h *reloadHub) Close() {
+	h.once.Do(func() { close(h.closed) })
+}
+
+func (h *reloadHub) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	h.clients[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *reloadHub) unsubscribe(ch chan struct{}) {
+	h.mu.Lock()
+	delete(h.clients, ch)
+	h.mu.Unlock()
+}
+
+// Broadcast tells all connected pages to reload.
+func (h *reloadHub) Broadcast() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// A reload is already queued for this client
+		}
+	}
+}
+
+// ServeHTTP streams reload events as server-sent events.
+func (h *reloadHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	ch := h.subscribe()
+	defer h.unsubscribe(ch)
+
+	for {
+		select {
+		case <-ch:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-h.closed:
+			return
+		}
+	}
+}
+
+// injectLiveReload wraps a handler so HTML responses get the live reload
+// script appended before </body>.
+func injectLiveReload(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Partial responses can't be rewritten safely
+		r.Header.Del("Range")
+		iw := &injectWriter{ResponseWriter: w}
+		next.ServeHTTP(iw, r)
+		iw.Finish()
+	})
+}
+
+type injectWriter struct {
+	http.ResponseWriter
+	status int
+	html   bool
+	buf    bytes.Buffer
+}
+
+func (w *injectWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	w.html = strings.HasPrefix(w.Header().Get("Content-Type"), "text/html")
+	if w.html {
+		w.Header().Del("Content-Length")
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *injectWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.html {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *injectWriter) Finish() {
+	if !w.html {
+		return
+	}
+	body := w.buf.Bytes()
+	if i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>")); i >= 0 {
+		body = append(body[:i:i], append(liveReloadScript, body[i:]...)...)
+	} else {
+		body = append(body, liveReloadScript...)
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
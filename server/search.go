@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/Varjelus/siteware/build"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const SearchPath = "/__search"
+const SearchLimit = 20
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+type searchDoc struct {
+	URL   string
+	Title string
+	Text  string
+}
+
+type searchResult struct {
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	Snippet string `json:"snippet"`
+	score   int
+}
+
+// searchIndex holds the text of the served HTML pages in memory. It is
+// rebuilt on the first search after a rebuild of the site.
+type searchIndex struct {
+	mu    sync.Mutex
+	root  string
+	files output.FS
+	docs  []searchDoc
+	stale bool
+}
+
+var Search = &searchIndex{files: output.OSFS{}, stale: true}
+
+// Invalidate makes the next search reindex the pages.
+func (s *searchIndex) Invalidate() {
+	s.mu.Lock()
+	s.stale = true
+	s.mu.Unlock()
+}
+
+func (s *searchIndex) refresh() error {
+	var docs []searchDoc
+	err := s.files.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && strings.HasPrefix(info.Name(), ".") && path != s.root {
+			return filepath.SkipDir
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !info.Mode().IsRegular() || (ext != ".html" && ext != ".htm") {
+			return nil
+		}
+		f, err := s.files.Open(path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		doc := searchDoc{URL: build.NormalizeLink("/" + filepath.ToSlash(rel))}
+		if m := titleRe.FindSubmatch(b); m != nil {
+			doc.Title = strings.TrimSpace(html.UnescapeString(string(m[1])))
+		}
+		doc.Text = build.HtmlText(b)
+		docs = append(docs, doc)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.docs = docs
+	s.stale = false
+	return nil
+}
+
+// query returns the pages containing every word of q, best matches first.
+// Words in the title count more than words in the text.
+func (s *searchIndex) query(q string) ([]searchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stale {
+		if err := s.refresh(); err != nil {
+			return nil, err
+		}
+	}
+
+	words := strings.Fields(strings.ToLower(q))
+	results := []searchResult{}
+	if len(words) == 0 {
+		return results, nil
+	}
+	for _, doc := range s.docs {
+		title, text := strings.ToLower(doc.Title), strings.ToLower(doc.Text)
+		score := 0
+		for _, w := range words {
+			n := strings.Count(text, w) + 5*strings.Count(title, w)
+			if n == 0 {
+				score = 0
+				break
+			}
+			score += n
+		}
+		if score == 0 {
+			continue
+		}
+		results = append(results, searchResult{
+			URL:     doc.URL,
+			Title:   doc.Title,
+			Snippet: snippet(doc.Text, strings.Index(text, words[0]), 80),
+			score:   score,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
+	if len(results) > SearchLimit {
+		results = results[:SearchLimit]
+	}
+	return results, nil
+}
+
+// snippet cuts about width characters of text around position at.
+func snippet(text string, at, width int) string {
+	if at < 0 {
+		at = 0
+	}
+	start, end := at-width/2, at+width/2
+	if start < 0 {
+		start = 0
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+	// Don't cut multibyte characters
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	s := text[start:end]
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(text) {
+		s += "…"
+	}
+	return s
+}
+
+// ServeHTTP answers /__search?q=words with the matching pages as JSON.
+func (s *searchIndex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	results, err := s.query(q)
+	if err != nil {
+		config.ErrorLogger.Printf("Error indexing pages: %v\n", err)
+		http.Error(w, "Indexing failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(struct {
+		Query   string         `json:"query"`
+		Results []searchResult `json:"results"`
+	}{q, results})
+}
@@ -0,0 +1,376 @@
+// Package server serves sites over HTTP while developing them, rebuilding
+// and reloading pages as their sources change.
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/build"
+	"github.com/Varjelus/siteware/config"
+	"github.com/Varjelus/siteware/output"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const DefaultNotFoundPage = "404.html"
+
+// headerRule sets headers on responses for paths matching Pattern.
+type headerRule struct {
+	Pattern string
+	Headers map[string]string
+}
+
+// readHeadersFile parses a _headers file: unindented lines are path
+// patterns, followed by indented "Name: value" lines.
+func readHeadersFile(files http.FileSystem, name string) ([]headerRule, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []headerRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			rules = append(rules, headerRule{Pattern: trimmed, Headers: make(map[string]string)})
+			continue
+		}
+		parts := strings.SplitN(trimmed, ":", 2)
+		if len(rules) == 0 || len(parts) != 2 {
+			continue
+		}
+		rules[len(rules)-1].Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return rules, scanner.Err()
+}
+
+// siteHandler serves a directory with custom headers, a 404 page and an
+// optional fallback page for single page applications.
+type siteHandler struct {
+	root     http.FileSystem
+	files    http.Handler
+	rules    []headerRule
+	notFound string
+	fallback string
+}
+
+func newSiteHandler(root http.FileSystem) (*siteHandler, error) {
+	h := &siteHandler{
+		root:     root,
+		files:    http.FileServer(root),
+		notFound: DefaultNotFoundPage,
+		fallback: ServeOptions.SPAFallback,
+	}
+	rules, err := readHeadersFile(root, "/"+build.HeadersFileName)
+	if err != nil {
+		return nil, err
+	}
+	h.rules = rules
+	for _, pattern := range build.HeaderPatterns() {
+		h.rules = append(h.rules, headerRule{Pattern: pattern, Headers: config.Config.Headers[pattern]})
+	}
+	if cfg := config.Config.Serve; cfg != nil {
+		patterns := make([]string, 0, len(cfg.Headers))
+		for pattern := range cfg.Headers {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			h.rules = append(h.rules, headerRule{Pattern: pattern, Headers: cfg.Headers[pattern]})
+		}
+		if cfg.NotFound != "" {
+			h.notFound = cfg.NotFound
+		}
+		if h.fallback == "" {
+			h.fallback = cfg.SPAFallback
+		}
+	}
+	return h, nil
+}
+
+func (h *siteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if to, status, ok := build.Redirect(r.URL.Path); ok {
+		http.Redirect(w, r, to, status)
+		return
+	}
+	for _, rule := range h.rules {
+		if build.MatchURLPattern(rule.Pattern, r.URL.Path) {
+			for name, value := range rule.Headers {
+				w.Header().Set(name, value)
+			}
+		}
+	}
+
+	f, err := h.root.Open(path.Clean("/" + r.URL.Path))
+	if err == nil {
+		f.Close()
+	}
+	if err == nil || !os.IsNotExist(err) {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	if h.fallback != "" && h.serveFile(w, r, h.fallback, http.StatusOK) {
+		return
+	}
+	if h.serveFile(w, r, h.notFound, http.StatusNotFound) {
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// serveFile writes a file of the served directory with the given status,
+// reporting whether it exists.
+func (h *siteHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, status int) bool {
+	f, err := h.root.Open(path.Clean("/" + name))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	io.Copy(w, f)
+	return true
+}
+
+// How many ports after the default one serve tries when it is taken
+const PortAttempts = 10
+
+// ShutdownTimeout is how long serve waits for requests to finish on exit.
+const ShutdownTimeout = 5 * time.Second
+
+// listen opens the server port. A taken port is an error when the port was
+// chosen by the user, otherwise the next free one is used.
+func listen(addr string, port *int, explicit bool) (net.Listener, error) {
+	for i := 0; ; i++ {
+		ln, err := net.Listen("tcp", net.JoinHostPort(addr, strconv.Itoa(*port)))
+		if err == nil {
+			return ln, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, fmt.Errorf("Error listening on port %d: %v", *port, err)
+		}
+		if explicit {
+			return nil, fmt.Errorf("Port %d is already in use, choose another one with --port", *port)
+		}
+		if i == PortAttempts {
+			return nil, fmt.Errorf("Ports %d to %d are already in use, choose a free one with --port", *port-PortAttempts, *port)
+		}
+		config.InfoLogger.Printf("Port %d is in use, trying %d\n", *port, *port+1)
+		*port++
+	}
+}
+
+// runServer serves HTTP, or HTTPS when cert is set, on ln until the process
+// gets SIGINT or SIGTERM, then lets running requests finish.
+func runServer(handler http.Handler, ln net.Listener, cert, key string) error {
+	srv := &http.Server{Handler: handler}
+	// Live reload streams never end on their own
+	srv.RegisterOnShutdown(LiveReload.Close)
+
+	errc := make(chan error, 1)
+	go func() {
+		if cert != "" {
+			errc <- srv.ServeTLS(ln, cert, key)
+		} else {
+			errc <- srv.Serve(ln)
+		}
+	}()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errc:
+		return err
+	case sig := <-sigc:
+		config.InfoLogger.Printf("Got %v, shutting down...\n", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("Error shutting down: %v", err)
+	}
+	config.InfoLogger.Println("Server stopped")
+	return nil
+}
+
+// AuthCookieName holds the token after it was given in the query.
+const AuthCookieName = "siteware-token"
+
+// requireAuth answers requests without valid credentials with 401.
+func requireAuth(next http.Handler, cfg config.ServeAuth) (http.Handler, error) {
+	password, token := cfg.Password, cfg.Token
+	if password == "" && token == "" {
+		return nil, errors.New("serve authentication needs a Password or a Token")
+	}
+	equal := func(given, want string) bool {
+		return want != "" && subtle.ConstantTimeCompare([]byte(given), []byte(want)) == 1
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Any user name goes when none is configured
+		if user, pass, ok := r.BasicAuth(); ok && (cfg.User == "" || equal(user, cfg.User)) && equal(pass, password) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if token != "" {
+			if q := r.URL.Query().Get("token"); equal(q, token) {
+				http.SetCookie(w, &http.Cookie{Name: AuthCookieName, Value: q, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+				next.ServeHTTP(w, r)
+				return
+			}
+			if equal(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if c, err := r.Cookie(AuthCookieName); err == nil && equal(c.Value, token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if password != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="siteware", charset="UTF-8"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}), nil
+}
+
+// serveOptions are set from the serve command flags.
+type serveOptions struct {
+	Port int
+	Addr string
+	// Search enables the search endpoint
+	Search bool
+	// TLS certificate and key files, or a generated certificate for
+	// localhost with SelfSigned
+	TLSCert    string
+	TLSKey     string
+	SelfSigned bool
+	// SPAFallback is served for paths that don't exist
+	SPAFallback string
+	// Raw serves the project directory instead of the build output
+	Raw bool
+	// RebuildOnRequest checks the sources for changes before serving
+	// each page
+	RebuildOnRequest bool
+	// Memory keeps the build in memory instead of the output directory
+	Memory bool
+}
+
+var ServeOptions serveOptions
+
+func Serve() error {
+	port, addr := &ServeOptions.Port, &ServeOptions.Addr
+
+	// Rebuild and reload pages on changes when serving a project, and
+	// serve what the build produced unless asked for the project itself
+	root := config.InputPath
+	var files output.FS = output.OSFS{}
+	project := false
+	if _, err := config.MasterPath(); err == nil {
+		project = true
+		opts := build.CommandOptions()
+		opts.Flags.Dev = true
+		if ServeOptions.Memory {
+			opts.Output = output.NewMemFS()
+		}
+		site, err := build.Build(opts)
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := watchChanges(); err != nil {
+				config.ErrorLogger.Println(err)
+			}
+		}()
+		if !ServeOptions.Raw {
+			root, files = site.Root, site.FS
+		}
+	}
+
+	// Flags override the config file
+	if *port == 0 {
+		*port = config.Config.Port
+	}
+	// Only the default port is swapped for a free one when taken
+	explicitPort := *port != 0
+	if *port == 0 {
+		*port = config.DefaultPort
+	}
+	if *addr == "" {
+		*addr = config.Config.Addr
+	}
+	host := *addr
+	if host == "" {
+		host = "localhost"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(LiveReloadPath, LiveReload)
+	site, err := newSiteHandler(output.Dir{FS: files, Root: root})
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", build.HeadersFileName, err)
+	}
+	var handler http.Handler = site
+	if project && ServeOptions.RebuildOnRequest {
+		handler = rebuildOnRequest(handler)
+	}
+	mux.Handle("/", injectLiveReload(handler))
+	if ServeOptions.Search {
+		Search.root, Search.files = root, files
+		mux.Handle(SearchPath, Search)
+	}
+
+	cert, key := ServeOptions.TLSCert, ServeOptions.TLSKey
+	if (cert == "") != (key == "") {
+		return errors.New("--tls-cert and --tls-key must be given together")
+	}
+	if ServeOptions.SelfSigned && cert == "" {
+		if cert, key, err = selfSignedCert(); err != nil {
+			return fmt.Errorf("Error creating certificate: %v", err)
+		}
+	}
+
+	var server http.Handler = mux
+	if config.Config.Serve != nil && config.Config.Serve.Auth != nil {
+		if server, err = requireAuth(mux, *config.Config.Serve.Auth); err != nil {
+			return err
+		}
+	}
+
+	ln, err := listen(*addr, port, explicitPort)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if cert != "" {
+		// HTTP/2 is enabled automatically over TLS
+		scheme = "https"
+	}
+	config.InfoLogger.Printf("Serving files at %s://%s. Press Ctrl+C to terminate.\n", scheme, net.JoinHostPort(host, strconv.Itoa(*port)))
+	return runServer(server, ln, cert, key)
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Varjelus/siteware/assets"
+	"github.com/Varjelus/siteware/build"
+	"github.com/Varjelus/siteware/config"
+	"github.com/fsnotify/fsnotify"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long to wait for more events before rebuilding. Editors tend to write
+// a file in several steps.
+const WatchDebounce = 200 * time.Millisecond
+
+// SourceDirs are the project directories a build reads.
+var SourceDirs = []string{config.SourceDirName, config.StaticDirName, assets.AssetDirName, config.TemplateDirName, config.DataDirName, build.I18nDirName, build.ShortcodeDirName}
+
+// buildMu keeps rebuilds from the watcher and from requests apart.
+var buildMu sync.Mutex
+
+type rebuildKind int
+
+const (
+	rebuildNone rebuildKind = iota
+	rebuildStatic
+	rebuildTemplates
+	rebuildHTML
+	rebuildAll
+)
+
+func Watch() error {
+	opts := build.CommandOptions()
+	opts.Flags.Dev = true
+	if _, err := build.Build(opts); err != nil {
+		return err
+	}
+	return watchChanges()
+}
+
+// watchChanges blocks, rebuilding the site whenever the sources change.
+func watchChanges() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("Error creating file watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	// The project root itself is watched for the master config
+	if err := watcher.Add(config.InputPath); err != nil {
+		return fmt.Errorf("Error watching %s: %v", config.InputPath, err)
+	}
+	for _, name := range SourceDirs {
+		if err := watchTree(watcher, filepath.Join(config.InputPath, name)); err != nil {
+			return fmt.Errorf("Error watching %s: %v", name, err)
+		}
+	}
+	if config.WorkspacePath != "" {
+		if err := watchTree(watcher, filepath.Join(config.WorkspacePath, config.TemplateDirName)); err != nil {
+			return fmt.Errorf("Error watching workspace templates: %v", err)
+		}
+	}
+	// Cloned themes don't change, local ones may be worked on alongside
+	if config.Config.Theme != "" && !build.IsGitURL(config.Config.Theme) {
+		if theme, err := build.ThemeDir(); err == nil {
+			for _, name := range []string{config.TemplateDirName, config.StaticDirName} {
+				if err := watchTree(watcher, filepath.Join(theme, name)); err != nil {
+					return fmt.Errorf("Error watching theme: %v", err)
+				}
+			}
+		}
+	}
+
+	config.InfoLogger.Println("Watching for changes. Press Ctrl+C to terminate.")
+
+	var pending rebuildKind
+	timer := time.NewTimer(WatchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case event := <-watcher.Events:
+			kind := classifyChange(event.Name)
+			if kind == rebuildNone {
+				continue
+			}
+			// fsnotify is not recursive, pick up new directories as they appear
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						config.ErrorLogger.Printf("Error watching %s: %v\n", event.Name, err)
+					}
+				}
+			}
+			if kind > pending {
+				pending = kind
+			}
+			timer.Reset(WatchDebounce)
+		case err := <-watcher.Errors:
+			config.ErrorLogger.Printf("Watcher: %v\n", err)
+		case <-timer.C:
+			rebuild(pending)
+			pending = rebuildNone
+		}
+	}
+}
+
+// watchTree adds root and every directory below it to the watcher.
+func watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		return watcher.Add(path)
+	})
+}
+
+// classifyChange decides how much of the site has to be rebuilt after the
+// file at path changed.
+func classifyChange(path string) rebuildKind {
+	if config.WorkspacePath != "" && config.IsSubpath(filepath.Join(config.WorkspacePath, config.TemplateDirName), path) {
+		return rebuildTemplates
+	}
+	if config.Config.Theme != "" && !build.IsGitURL(config.Config.Theme) {
+		if theme, err := build.ThemeDir(); err == nil {
+			if config.IsSubpath(filepath.Join(theme, config.TemplateDirName), path) {
+				return rebuildTemplates
+			}
+			if config.IsSubpath(filepath.Join(theme, config.StaticDirName), path) {
+				return rebuildStatic
+			}
+		}
+	}
+	rel, err := filepath.Rel(config.InputPath, path)
+	if err != nil {
+		return rebuildNone
+	}
+	// Editor swap files and the like are usually ignored
+	isDir := false
+	if fi, err := os.Stat(path); err == nil {
+		isDir = fi.IsDir()
+	}
+	if config.Ignored(rel, isDir) {
+		return rebuildNone
+	}
+	if config.IsConfigFile(rel, config.ConfigBaseName) || (config.Env != "" && config.IsConfigFile(rel, config.ConfigBaseName+"."+config.Env)) {
+		return rebuildAll
+	}
+	if config.IsConfigFile(filepath.Base(rel), config.DirConfigBaseName) {
+		// Directory configs also drive thumbnail generation
+		return rebuildAll
+	}
+	parts := strings.SplitN(rel, string(filepath.Separator), 2)
+	switch parts[0] {
+	case config.StaticDirName, assets.AssetDirName:
+		return rebuildStatic
+	case config.TemplateDirName:
+		return rebuildTemplates
+	case config.SourceDirName, config.DataDirName, build.I18nDirName, build.ShortcodeDirName:
+		return rebuildHTML
+	}
+	return rebuildNone
+}
+
+func rebuild(kind rebuildKind) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	start := time.Now()
+	switch kind {
+	case rebuildAll:
+		config.InfoLogger.Println("Configuration changed, rebuilding...")
+		if err := config.Load(); err != nil {
+			config.ErrorLogger.Println(err)
+			return
+		}
+		if err := build.SyncStatic(); err != nil {
+			config.ErrorLogger.Printf("Error syncing static files: %v\n", err)
+			return
+		}
+		if err := build.GenerateHTML(); err != nil {
+			config.ErrorLogger.Printf("Error generating HTML: %v\n", err)
+			return
+		}
+		if err := assets.GenerateThumbnails(); err != nil {
+			config.ErrorLogger.Printf("Error generating thumbnails: %v\n", err)
+			return
+		}
+		if err := assets.GeneratePosters(); err != nil {
+			config.ErrorLogger.Printf("Error generating video posters: %v\n", err)
+			return
+		}
+	case rebuildStatic:
+		config.InfoLogger.Println("Syncing statics...")
+		if err := build.SyncStatic(); err != nil {
+			config.ErrorLogger.Printf("Error syncing static files: %v\n", err)
+			return
+		}
+		if err := assets.GenerateThumbnails(); err != nil {
+			config.ErrorLogger.Printf("Error generating thumbnails: %v\n", err)
+			return
+		}
+		if err := assets.GeneratePosters(); err != nil {
+			config.ErrorLogger.Printf("Error generating video posters: %v\n", err)
+			return
+		}
+	case rebuildTemplates:
+		config.InfoLogger.Println("Swapping templates...")
+		if err := build.SwapTemplates(); err != nil {
+			config.ErrorLogger.Printf("Error generating HTML: %v\n", err)
+			return
+		}
+	case rebuildHTML:
+		config.InfoLogger.Println("Generating HTML files...")
+		if err := build.GenerateHTML(); err != nil {
+			config.ErrorLogger.Printf("Error generating HTML: %v\n", err)
+			return
+		}
+	default:
+		return
+	}
+	build.LastBuild = start
+	config.InfoLogger.Printf("Rebuilt in %v\n", time.Since(start))
+	Search.Invalidate()
+	LiveReload.Broadcast()
+}
+
+// sourcesChangedSince reports whether a source file or the master config
+// was modified after t.
+func sourcesChangedSince(t time.Time) bool {
+	if cfgPath, err := config.MasterPath(); err == nil {
+		if fi, err := os.Stat(cfgPath); err == nil && fi.ModTime().After(t) {
+			return true
+		}
+		if overlay, err := config.EnvConfigPath(cfgPath); err == nil && config.Env != "" {
+			if fi, err := os.Stat(overlay); err == nil && fi.ModTime().After(t) {
+				return true
+			}
+		}
+	}
+	changed := errors.New("changed")
+	for _, name := range SourceDirs {
+		err := filepath.Walk(filepath.Join(config.InputPath, name), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.ModTime().After(t) {
+				return changed
+			}
+			return nil
+		})
+		if err == changed {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuildOnRequest rebuilds the site before serving a page whenever the
+// sources changed since the last build, so a page is never stale even if
+// the watcher hasn't caught up yet.
+func rebuildOnRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ext := strings.ToLower(path.Ext(r.URL.Path))
+		buildMu.Lock()
+		last := build.LastBuild
+		buildMu.Unlock()
+		if (ext == "" || ext == ".html" || ext == ".htm") && sourcesChangedSince(last) {
+			rebuild(rebuildAll)
+		}
+		next.ServeHTTP(w, r)
+	})
+}